@@ -0,0 +1,108 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam"
+)
+
+// capacityCommand asks a running controller how many more nodes with the given
+// labels can be assigned podCIDRs.
+type capacityCommand struct {
+	Server  string            `long:"server" default:"http://localhost:8081" description:"URL of the web server of the controller."`
+	Labels  map[string]string `long:"labels" key-value-delimiter:"=" description:"Label of the new nodes (key=value). Can be repeated."`
+	Output  string            `long:"output" short:"o" default:"table" choice:"table" choice:"json" description:"Output format."`
+	Timeout time.Duration     `long:"timeout" default:"10s" description:"Timeout of the query (duration string)."`
+}
+
+// Execute implements flags.Commander.
+func (c *capacityCommand) Execute(_ []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	report, err := c.query(ctx)
+	if err != nil {
+		return err
+	}
+	if c.Output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return printCapacityReport(os.Stdout, report)
+}
+
+func (c *capacityCommand) query(ctx context.Context) (*ipam.CapacityReport, error) {
+	query := url.Values{"labels": []string{labels.Set(c.Labels).String()}}
+	endpoint := strings.TrimSuffix(c.Server, "/") + "/debug/ipam/capacity?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the capacity: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to query the capacity: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	report := &ipam.CapacityReport{}
+	if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+		return nil, fmt.Errorf("failed to decode the capacity: %w", err)
+	}
+	return report, nil
+}
+
+// printCapacityReport prints the ClusterCIDRs in the order they are used,
+// followed by the totals.
+func printCapacityReport(w io.Writer, report *ipam.CapacityReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTERCIDR\tNODE SELECTOR\tIPV4\tIPV6\tNODES")
+	for _, clusterCIDR := range report.ClusterCIDRs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", clusterCIDR.Name, clusterCIDR.NodeSelector,
+			formatCIDRSetCapacity(clusterCIDR.IPv4), formatCIDRSetCapacity(clusterCIDR.IPv6), clusterCIDR.AllocatableNodes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d more node(s) can be allocated (IPv4: %d, IPv6: %d)\n",
+		report.AllocatableNodes, report.IPv4Nodes, report.IPv6Nodes)
+	return err
+}
+
+func formatCIDRSetCapacity(capacity *ipam.CIDRSetCapacity) string {
+	if capacity == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%d/%d free)", capacity.CIDR, capacity.FreeCIDRs, capacity.MaxCIDRs)
+}
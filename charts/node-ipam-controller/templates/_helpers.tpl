@@ -90,4 +90,13 @@ Leader Election
 {{- if .Values.leaderElection.resourceName }}
 - --leader-elect-resource-name={{ .Values.leaderElection.resourceName }}
 {{- end }}
+{{- if .Values.leaderElection.coordinated }}
+- --leader-elect-coordinated=true
+{{- end }}
+{{- if .Values.leaderElection.warmStandby }}
+- --leader-elect-warm-standby=true
+{{- end }}
+{{- if .Values.leaderElection.shards }}
+- --leader-elect-shards={{ .Values.leaderElection.shards }}
+{{- end }}
 {{- end }}
\ No newline at end of file
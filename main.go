@@ -26,12 +26,17 @@ import (
 
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/component-base/logs"
+	"k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
 
 	"sigs.k8s.io/node-ipam-controller/pkg/leaderelection"
 	"sigs.k8s.io/node-ipam-controller/pkg/signals"
 	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
 
 	"github.com/jessevdk/go-flags"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -49,22 +54,63 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// tracerShutdownTimeout is how long to wait for the pending spans to be exported on exit.
+const tracerShutdownTimeout = 5 * time.Second
+
+// Version is the version of the controller, set at build time.
+var Version = "v0.0.0-dev"
+
 type config struct {
 	ApiServerURL string `long:"apiserver" description:"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster." env:"IPAM_API_SERVER_URL"`
 	Kubeconfig   string `long:"kubeconfig" description:"Path to a kubeconfig. Only required if out-of-cluster." env:"IPAM_KUBECONFIG"`
 	// deprecated, use BindingAddr. Will be removed in future release.
 	HealthProbeAddr   string `long:"health-probe-address" default:"" description:"Specifies the TCP address for the health server to listen on." env:"IPAM_HEALTH_PROBE_ADDR"`
 	WebserverBindAddr string `long:"webserver-bind-address" default:":8081" description:"Specifies the TCP address for the probes and metric server to listen on." env:"IPAM_WEBSERVER_BIND_ADDR"`
-	LeaderElectionCfg leaderelection.Config
+	EnableProfiling   bool   `long:"enable-profiling" description:"Enable profiling via the net/http/pprof handlers at /debug/pprof/ on the web server." env:"IPAM_ENABLE_PROFILING"`
+	// CIDR usage warnings and exhaustion forecast.
+	UsageWarningThresholds []float64     `long:"cidr-usage-warning-thresholds" default:"80" default:"95" description:"Usage percentages of a ClusterCIDR range above which a Warning event is emitted on the ClusterCIDR. Can be repeated." env:"IPAM_CIDR_USAGE_WARNING_THRESHOLDS" env-delim:","`
+	UsageForecastWindow    time.Duration `long:"cidr-usage-forecast-window" default:"1h" description:"Period over which the allocation rate is measured to forecast the exhaustion of a ClusterCIDR range (duration string)." env:"IPAM_CIDR_USAGE_FORECAST_WINDOW"`
+	// ManagePodCIDRUnassignedTaint makes the controller taint the nodes waiting for a podCIDR.
+	ManagePodCIDRUnassignedTaint bool `long:"manage-pod-cidr-unassigned-taint" description:"Taint the nodes that cannot be assigned a podCIDR with node.kubernetes.io/pod-cidr-unassigned:NoSchedule and remove the taint once the podCIDR is set." env:"IPAM_MANAGE_POD_CIDR_UNASSIGNED_TAINT"`
+	// SetClusterCIDRLabel makes the controller label the nodes with their ClusterCIDR.
+	SetClusterCIDRLabel bool `long:"set-cluster-cidr-label" description:"Label the nodes with the name of the ClusterCIDR their podCIDRs were allocated from (networking.x-k8s.io/cluster-cidr), in addition to the annotation." env:"IPAM_SET_CLUSTER_CIDR_LABEL"`
+	// AllocationDecisionLogVerbosity is the log verbosity of the allocation decision records.
+	AllocationDecisionLogVerbosity int `long:"allocation-decision-log-verbosity" default:"4" description:"Log verbosity at which the decision record of every podCIDR allocation is logged." env:"IPAM_ALLOCATION_DECISION_LOG_VERBOSITY"`
+	// ShutdownGracePeriod bounds the time the work in progress is drained on shutdown.
+	ShutdownGracePeriod time.Duration `long:"shutdown-grace-period" default:"5s" description:"Time the node and ClusterCIDR syncs in progress are given to complete on shutdown or when the leadership is lost, before they are cancelled and the lease is released (duration string). Should stay below the termination grace period of the pod." env:"IPAM_SHUTDOWN_GRACE_PERIOD"`
+	// ControllerName selects the ClusterCIDRs of this instance of the controller.
+	ControllerName string `long:"controller-name" default:"networking.x-k8s.io/node-ipam-controller" description:"Name of the controller. Only the ClusterCIDRs with this spec.controllerName, or without one for the default name, and the nodes they select are managed." env:"IPAM_CONTROLLER_NAME"`
+	// ManagedNodeSelector limits the nodes managed by the controller.
+	ManagedNodeSelector string `long:"managed-node-selector" description:"Label selector of the nodes managed by the controller, all the nodes if empty. Other nodes are not watched and never assigned podCIDRs." env:"IPAM_MANAGED_NODE_SELECTOR"`
+	// Publication of the remaining node capacity per node selector.
+	CapacityConfigMapName      string `long:"capacity-configmap-name" description:"Name of the ConfigMap the remaining node capacity of every node selector is published to. The capacity is not published if empty." env:"IPAM_CAPACITY_CONFIGMAP_NAME"`
+	CapacityConfigMapNamespace string `long:"capacity-configmap-namespace" default:"kube-system" description:"Namespace of the capacity ConfigMap." env:"IPAM_CAPACITY_CONFIGMAP_NAMESPACE"`
+	// Snapshot of the allocation table for fast startup.
+	SnapshotConfigMapName      string        `long:"snapshot-configmap-name" description:"Name of the ConfigMap the allocation table is periodically persisted to, so that a new leader only rebuilds the nodes that changed since. The table is not persisted if empty." env:"IPAM_SNAPSHOT_CONFIGMAP_NAME"`
+	SnapshotConfigMapNamespace string        `long:"snapshot-configmap-namespace" default:"kube-system" description:"Namespace of the snapshot ConfigMap." env:"IPAM_SNAPSHOT_CONFIGMAP_NAMESPACE"`
+	SnapshotInterval           time.Duration `long:"snapshot-interval" default:"5m" description:"Interval between two snapshots of the allocation table (duration string)." env:"IPAM_SNAPSHOT_INTERVAL"`
+	// StickyAllocationWindow gives re-registering nodes their previous podCIDRs back.
+	StickyAllocationWindow time.Duration `long:"sticky-allocation-window" default:"0s" description:"Time the podCIDRs of a deleted node are remembered, so that a node registering again with the same name or providerID gets them back if they are still free (duration string). 0 disables it." env:"IPAM_STICKY_ALLOCATION_WINDOW"`
+	// PerFamilyClusterCIDRs selects the IPv4 and IPv6 ClusterCIDRs of a node independently.
+	PerFamilyClusterCIDRs bool `long:"per-family-cluster-cidrs" description:"Allocate the IPv4 and the IPv6 podCIDR of a node from the best matching ClusterCIDR of each family, which may differ. Can not be combined with leader-elect-shards." env:"IPAM_PER_FAMILY_CLUSTER_CIDRS"`
+	// RecordAllocationIntent records the reserved CIDRs on the node before patching its podCIDRs.
+	RecordAllocationIntent bool `long:"record-allocation-intent" description:"Record the CIDRs reserved for a node in an annotation before patching its podCIDRs, so that they stay reserved if the outcome of the patch is unknown. Costs an additional node patch per allocation." env:"IPAM_RECORD_ALLOCATION_INTENT"`
+	// OpenTelemetry tracing.
+	TracingEndpoint               string `long:"tracing-endpoint" description:"OTLP gRPC endpoint (host:port) the traces are exported to. Tracing is disabled if empty." env:"IPAM_TRACING_ENDPOINT"`
+	TracingSamplingRatePerMillion int32  `long:"tracing-sampling-rate-per-million" default:"1000000" description:"Number of node and ClusterCIDR syncs to trace per million." env:"IPAM_TRACING_SAMPLING_RATE_PER_MILLION"`
+	LeaderElectionCfg             leaderelection.Config
+	// Capacity is the subcommand querying the capacity of a running controller.
+	Capacity capacityCommand `command:"capacity" description:"Show how many more nodes with the given labels can be assigned podCIDRs by a running controller."`
 }
 
-func (c *config) load() error {
+// load parses the flags and runs the subcommand, if any. It returns whether a
+// subcommand was run, in which case the controller must not be started.
+func (c *config) load() (bool, error) {
 	// allows using true/false in the parameters
-	_, err := flags.NewParser(c, flags.Default|flags.AllowBoolValues).ParseArgs(os.Args)
-	if err != nil {
-		return err
-	}
-	return nil
+	parser := flags.NewParser(c, flags.Default|flags.AllowBoolValues)
+	parser.SubcommandsOptional = true
+	_, err := parser.ParseArgs(os.Args[1:])
+	return parser.Active != nil, err
 }
 
 func main() {
@@ -73,8 +119,9 @@ func main() {
 
 	nodeIpamCfg := config{LeaderElectionCfg: leaderelection.Config{
 		EnableLeaderElection: true,
+		BinaryVersion:        Version,
 	}}
-	err := nodeIpamCfg.load()
+	ranCommand, err := nodeIpamCfg.load()
 	if err != nil {
 		var flagError *flags.Error
 		if errors.As(err, &flagError) {
@@ -83,9 +130,16 @@ func main() {
 			}
 			os.Exit(1)
 		}
+		if ranCommand {
+			// The error of the subcommand is already printed by the parser.
+			os.Exit(1)
+		}
 		fmt.Fprintf(os.Stderr, "unable to parse config: %q", err)
 		os.Exit(1)
 	}
+	if ranCommand {
+		os.Exit(0)
+	}
 
 	logs.InitLogs()
 	if err := logsapi.ValidateAndApply(c, nil); err != nil {
@@ -97,7 +151,7 @@ func main() {
 	defer cancel()
 	logger := klog.FromContext(ctx)
 
-	server.StartWebServer(ctx, bindingAddress(nodeIpamCfg))
+	webServer := server.StartWebServer(ctx, bindingAddress(nodeIpamCfg), nodeIpamCfg.EnableProfiling)
 
 	kubeClientCfg, err := clientcmd.BuildConfigFromFlags(nodeIpamCfg.ApiServerURL, nodeIpamCfg.Kubeconfig)
 	if err != nil {
@@ -105,25 +159,88 @@ func main() {
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
+	tracerProvider, err := newTracerProvider(ctx, nodeIpamCfg)
+	if err != nil {
+		logger.Error(err, "failed to create tracer provider")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+		defer cancel()
+		if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+			logger.Error(err, "failed to shut down tracer provider")
+		}
+	}()
+	// Propagate the trace context to the API server.
+	kubeClientCfg.Wrap(tracing.WrapperFor(tracerProvider))
+
 	kubeClient, err := kubernetes.NewForConfig(kubeClientCfg)
 	if err != nil {
 		logger.Error(err, "failed to build kubernetes clientset")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
-	if nodeIpamCfg.LeaderElectionCfg.EnableLeaderElection {
+	switch {
+	case nodeIpamCfg.LeaderElectionCfg.EnableLeaderElection && nodeIpamCfg.LeaderElectionCfg.Shards > 0:
+		logger.Info("Sharded leader election is enabled.", "shards", nodeIpamCfg.LeaderElectionCfg.Shards)
+		// shardsDone is closed once the leases of the shards are released.
+		shardsDone := make(chan struct{})
+		startShards := func(ctx context.Context, allocator ipam.CIDRAllocator) {
+			go func() {
+				defer close(shardsDone)
+				if err := leaderelection.RunShards(ctx, kubeClient, nodeIpamCfg.LeaderElectionCfg, webServer, allocator); err != nil {
+					logger.Error(err, "failed to run sharded leader election")
+					klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+				}
+			}()
+		}
+		runControllers(kubeClient, kubeClientCfg, webServer, allocatorParams(nodeIpamCfg, tracerProvider), startShards)(ctx)
+		cancel()
+		<-shardsDone
+	case nodeIpamCfg.LeaderElectionCfg.EnableLeaderElection && nodeIpamCfg.LeaderElectionCfg.WarmStandby:
+		logger.Info("Leader election with warm standby is enabled.")
+		// The lease is held until the allocator drained its work, once
+		// controllersStopped is closed. electionDone is closed once the lease
+		// is released.
+		controllersStopped, electionDone := make(chan struct{}), make(chan struct{})
+		startLeaderElection := func(ctx context.Context, allocator ipam.CIDRAllocator) {
+			go func() {
+				defer close(electionDone)
+				promote := func(ctx context.Context) {
+					allocator.Promote(ctx)
+					<-controllersStopped
+				}
+				if err := leaderelection.StartLeaderElection(ctx, kubeClient, nodeIpamCfg.LeaderElectionCfg, webServer, cancel, promote); err != nil {
+					logger.Error(err, "failed to run leader election")
+					klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+				}
+			}()
+		}
+		runControllers(kubeClient, kubeClientCfg, webServer, allocatorParams(nodeIpamCfg, tracerProvider), startLeaderElection)(ctx)
+		close(controllersStopped)
+		cancel()
+		<-electionDone
+	case nodeIpamCfg.LeaderElectionCfg.EnableLeaderElection:
 		logger.Info("Leader election is enabled.")
-		leaderelection.StartLeaderElection(
-			ctx, kubeClient, nodeIpamCfg.LeaderElectionCfg, cancel, runControllers(kubeClient, kubeClientCfg),
+		err := leaderelection.StartLeaderElection(
+			ctx, kubeClient, nodeIpamCfg.LeaderElectionCfg, webServer, cancel, runControllers(kubeClient, kubeClientCfg, webServer, allocatorParams(nodeIpamCfg, tracerProvider), nil),
 		)
-	} else {
+		if err != nil {
+			logger.Error(err, "failed to run leader election")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	default:
 		logger.Info("Leader election is disabled.")
-		runControllers(kubeClient, kubeClientCfg)(ctx)
+		runControllers(kubeClient, kubeClientCfg, webServer, allocatorParams(nodeIpamCfg, tracerProvider), nil)(ctx)
 	}
 }
 
-// runControllers creates a function that starts Node Ipam Controller.
-func runControllers(kubeClient kubernetes.Interface, cfg *rest.Config) func(context.Context) {
+// runControllers creates a function that starts Node Ipam Controller. If set,
+// onStart is called with the allocator before it runs.
+func runControllers(
+	kubeClient kubernetes.Interface, cfg *rest.Config, webServer *server.WebServer, allocatorParams ipam.CIDRAllocatorParams,
+	onStart func(context.Context, ipam.CIDRAllocator),
+) func(context.Context) {
 	return func(ctx context.Context) {
 		logger := klog.FromContext(ctx)
 		cidrClient, err := clientset.NewForConfig(cfg)
@@ -133,23 +250,21 @@ func runControllers(kubeClient kubernetes.Interface, cfg *rest.Config) func(cont
 		}
 
 		const defaultResync = 30 * time.Second
-		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, defaultResync)
+		// Only the nodes are watched, filter them on the server side.
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResync,
+			kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = allocatorParams.ManagedNodeSelector
+			}),
+		)
 		sharedInformerFactory := informers.NewSharedInformerFactory(cidrClient, defaultResync)
 
-		nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-		if err != nil {
-			logger.Error(err, "failed to list existing nodes")
-			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
-		}
-
 		nodeIpamController, err := ipam.NewMultiCIDRRangeAllocator(
 			ctx,
 			kubeClient,
 			cidrClient.NetworkingV1().ClusterCIDRs(),
 			kubeInformerFactory.Core().V1().Nodes(),
 			sharedInformerFactory.Networking().V1().ClusterCIDRs(),
-			ipam.CIDRAllocatorParams{},
-			nodes,
+			allocatorParams,
 			nil,
 		)
 		if err != nil {
@@ -157,13 +272,67 @@ func runControllers(kubeClient kubernetes.Interface, cfg *rest.Config) func(cont
 			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 		}
 
+		nodeIpamController.AddHealthChecks(webServer)
+		nodeIpamController.AddDebugHandlers(webServer)
+
 		kubeInformerFactory.Start(ctx.Done())
 		sharedInformerFactory.Start(ctx.Done())
 
+		if onStart != nil {
+			onStart(ctx, nodeIpamController)
+		}
 		nodeIpamController.Run(ctx)
 	}
 }
 
+// allocatorParams returns the parameters of the Node IPAM controller set by the flags.
+func allocatorParams(cfg config, tracerProvider oteltrace.TracerProvider) ipam.CIDRAllocatorParams {
+	shards, standby := 0, false
+	if cfg.LeaderElectionCfg.EnableLeaderElection {
+		shards = cfg.LeaderElectionCfg.Shards
+		// All the replicas allocate when sharded.
+		standby = shards == 0 && cfg.LeaderElectionCfg.WarmStandby
+	}
+	return ipam.CIDRAllocatorParams{
+		UsageWarningThresholds:         cfg.UsageWarningThresholds,
+		UsageForecastWindow:            cfg.UsageForecastWindow,
+		TracerProvider:                 tracerProvider,
+		ManagePodCIDRUnassignedTaint:   cfg.ManagePodCIDRUnassignedTaint,
+		SetClusterCIDRLabel:            cfg.SetClusterCIDRLabel,
+		AllocationDecisionLogVerbosity: cfg.AllocationDecisionLogVerbosity,
+		CapacityConfigMapName:          cfg.CapacityConfigMapName,
+		CapacityConfigMapNamespace:     cfg.CapacityConfigMapNamespace,
+		ManagedNodeSelector:            cfg.ManagedNodeSelector,
+		ControllerName:                 cfg.ControllerName,
+		Shards:                         shards,
+		Standby:                        standby,
+		ShutdownGracePeriod:            cfg.ShutdownGracePeriod,
+		SnapshotConfigMapName:          cfg.SnapshotConfigMapName,
+		SnapshotConfigMapNamespace:     cfg.SnapshotConfigMapNamespace,
+		SnapshotInterval:               cfg.SnapshotInterval,
+		StickyAllocationWindow:         cfg.StickyAllocationWindow,
+		PerFamilyClusterCIDRs:          cfg.PerFamilyClusterCIDRs,
+		RecordAllocationIntent:         cfg.RecordAllocationIntent,
+	}
+}
+
+// newTracerProvider returns a tracer provider exporting to the configured OTLP
+// endpoint, or a no-op one if no endpoint is configured.
+func newTracerProvider(ctx context.Context, cfg config) (tracing.TracerProvider, error) {
+	if cfg.TracingEndpoint == "" {
+		return tracing.NewNoopTracerProvider(), nil
+	}
+
+	return tracing.NewProvider(ctx,
+		&tracingapi.TracingConfiguration{
+			Endpoint:               &cfg.TracingEndpoint,
+			SamplingRatePerMillion: &cfg.TracingSamplingRatePerMillion,
+		},
+		nil,
+		[]resource.Option{resource.WithAttributes(semconv.ServiceName("node-ipam-controller"))},
+	)
+}
+
 func bindingAddress(cfg config) string {
 	if cfg.HealthProbeAddr != "" {
 		return cfg.HealthProbeAddr
@@ -21,6 +21,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// DefaultControllerName is the name of the controller managing the
+// ClusterCIDRs that do not set a controllerName.
+const DefaultControllerName = "networking.x-k8s.io/node-ipam-controller"
+
 // ClusterCIDR represents a single configuration for per-Node Pod CIDR
 // allocations when the MultiCIDRRangeAllocator is enabled (see the config for
 // kube-controller-manager).  A cluster may have any number of ClusterCIDR
@@ -48,6 +52,7 @@ func (in *ClusterCIDR) Default() {}
 
 // ClusterCIDRSpec defines the desired state of ClusterCIDR.
 // +kubebuilder:validation:XValidation:message="A CIDR must be specified for ipv4 or ipv6.",rule="self.ipv4 != \"\" || self.ipv6 != \"\""
+// +kubebuilder:validation:XValidation:message="allocationStrategy.pairFamilies requires both ipv4 and ipv6.",rule="!has(self.allocationStrategy) || !has(self.allocationStrategy.pairFamilies) || !self.allocationStrategy.pairFamilies || (has(self.ipv4) && self.ipv4 != \"\" && has(self.ipv6) && self.ipv6 != \"\")"
 type ClusterCIDRSpec struct {
 	// nodeSelector defines which nodes the config is applicable to.
 	// An empty or nil nodeSelector selects all nodes.
@@ -83,6 +88,86 @@ type ClusterCIDRSpec struct {
 	// +kubebuilder:validation:XValidation:message="IPv6 cannot be changed.",rule="oldSelf == self"
 	// +kubebuilder:validation:XValidation:message="IPv6 must be a valid IPv6 CIDR.",rule="self == '' || (isCIDR(self) && cidr(self).ip().family() == 6)"
 	IPv6 string `json:"ipv6,omitempty"`
+
+	// controllerName is the name of the controller that allocates from this
+	// ClusterCIDR, as a domain-prefixed path (e.g. "example.com/gpu-ipam").
+	// Several controllers can run in a cluster, each one only uses the
+	// ClusterCIDRs with its name. ClusterCIDRs without a controllerName are
+	// used by the controller named "networking.x-k8s.io/node-ipam-controller".
+	// This field is optional and immutable.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:XValidation:message="ControllerName cannot be changed.",rule="oldSelf == self"
+	ControllerName string `json:"controllerName,omitempty"`
+
+	// reuseCooldownSeconds is how long, in seconds, a podCIDR released by a
+	// node is quarantined before it can be allocated to another node, so that
+	// the routes, conntrack entries and cached pod IPs of the former node
+	// expire first. Released podCIDRs are reusable immediately if unset.
+	// The quarantine is kept in the memory of the controller only: podCIDRs
+	// released before a restart or a leader change are reusable immediately.
+	// This field is optional and immutable.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:XValidation:message="ReuseCooldownSeconds cannot be changed.",rule="oldSelf == self"
+	ReuseCooldownSeconds int32 `json:"reuseCooldownSeconds,omitempty"`
+
+	// allocationStrategy defines how the podCIDR of a node is picked among the
+	// free ones. Nodes get the next free podCIDR, round-robin, if unset.
+	// This field is optional and immutable.
+	// +optional
+	// +kubebuilder:validation:XValidation:message="AllocationStrategy cannot be changed.",rule="oldSelf == self"
+	AllocationStrategy *AllocationStrategy `json:"allocationStrategy,omitempty"`
+}
+
+// AllocationStrategyType is the way the podCIDR of a node is picked in a
+// ClusterCIDR.
+// +kubebuilder:validation:Enum=Sequential;Hash;Ordinal;NodeIPDerived
+type AllocationStrategyType string
+
+const (
+	// AllocationStrategySequential allocates the next free podCIDR,
+	// round-robin.
+	AllocationStrategySequential AllocationStrategyType = "Sequential"
+	// AllocationStrategyHash allocates the podCIDR at the index given by the
+	// hash of the node name.
+	AllocationStrategyHash AllocationStrategyType = "Hash"
+	// AllocationStrategyOrdinal allocates the podCIDR at the index given by
+	// the value of a node label, such as a rack slot.
+	AllocationStrategyOrdinal AllocationStrategyType = "Ordinal"
+	// AllocationStrategyNodeIPDerived allocates the podCIDR at the index given
+	// by the host part of the node InternalIP.
+	AllocationStrategyNodeIPDerived AllocationStrategyType = "NodeIPDerived"
+)
+
+// AllocationStrategy defines how the podCIDR of a node is picked. The
+// strategies other than Sequential derive the index of the podCIDR from the
+// node, the Hash and NodeIPDerived ones modulo the number of podCIDRs of the
+// range. If that podCIDR is not free, the next free one is allocated. Nodes
+// the index can not be derived from, such as nodes with an ordinal beyond the
+// range, are allocated sequentially.
+// +kubebuilder:validation:XValidation:message="ordinalLabel must be set with the Ordinal type only.",rule="(has(self.type) && self.type == \"Ordinal\") == (has(self.ordinalLabel) && self.ordinalLabel != \"\")"
+type AllocationStrategy struct {
+	// type is the allocation strategy, one of Sequential, Hash, Ordinal and
+	// NodeIPDerived. Defaults to Sequential.
+	// +optional
+	// +kubebuilder:default=Sequential
+	Type AllocationStrategyType `json:"type,omitempty"`
+
+	// ordinalLabel is the key of the node label holding the index of the
+	// podCIDR of the node, as a non-negative integer below the number of
+	// podCIDRs of the range. It is required with the Ordinal type and
+	// forbidden otherwise.
+	// +optional
+	OrdinalLabel string `json:"ordinalLabel,omitempty"`
+
+	// pairFamilies allocates the IPv4 and IPv6 podCIDRs of a node at the same
+	// index of their range, skipping the indices taken in either family, so
+	// that the podCIDR of a family is derivable from the other. The index is
+	// picked according to type, among the indices of the smaller range. It
+	// requires both ipv4 and ipv6.
+	// +optional
+	PairFamilies bool `json:"pairFamilies,omitempty"`
 }
 
 // ClusterCIDRList contains a list of ClusterCIDRs.
@@ -20,6 +20,7 @@ import (
 	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	unversionedvalidation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	netutils "k8s.io/utils/net"
 
@@ -50,6 +51,18 @@ func ValidateClusterCIDRSpec(spec *v1.ClusterCIDRSpec, fldPath *field.Path) fiel
 	if spec.NodeSelector != nil {
 		allErrs = append(allErrs, validateNodeSelector(spec.NodeSelector, fldPath.Child("nodeSelector"))...)
 	}
+	if spec.ControllerName != "" {
+		allErrs = append(allErrs, validation.IsDomainPrefixedPath(fldPath.Child("controllerName"), spec.ControllerName)...)
+	}
+	if spec.ReuseCooldownSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("reuseCooldownSeconds"), spec.ReuseCooldownSeconds, "must be greater than or equal to 0"))
+	}
+	if spec.AllocationStrategy != nil {
+		allErrs = append(allErrs, validateAllocationStrategy(spec.AllocationStrategy, fldPath.Child("allocationStrategy"))...)
+		if spec.AllocationStrategy.PairFamilies && (spec.IPv4 == "" || spec.IPv6 == "") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("allocationStrategy", "pairFamilies"), true, "requires both `ipv4` and `ipv6`"))
+		}
+	}
 
 	// Validate if CIDR is specified for at least one IP Family(IPv4/IPv6).
 	if spec.IPv4 == "" && spec.IPv6 == "" {
@@ -100,6 +113,30 @@ func validateCIDRConfig(configCIDR string, perNodeHostBits, maxMaskSize int32, i
 	return allErrs
 }
 
+// validateAllocationStrategy tests that the specified allocation strategy has valid data.
+func validateAllocationStrategy(strategy *v1.AllocationStrategy, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch strategy.Type {
+	case "", v1.AllocationStrategySequential, v1.AllocationStrategyHash, v1.AllocationStrategyNodeIPDerived:
+		if strategy.OrdinalLabel != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("ordinalLabel"), "may not be specified when `type` is not 'Ordinal'"))
+		}
+	case v1.AllocationStrategyOrdinal:
+		if strategy.OrdinalLabel == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("ordinalLabel"), "must be specified when `type` is 'Ordinal'"))
+		} else {
+			allErrs = append(allErrs, unversionedvalidation.ValidateLabelName(strategy.OrdinalLabel, fldPath.Child("ordinalLabel"))...)
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("type"), strategy.Type, []v1.AllocationStrategyType{
+			v1.AllocationStrategySequential, v1.AllocationStrategyHash, v1.AllocationStrategyOrdinal, v1.AllocationStrategyNodeIPDerived,
+		}))
+	}
+
+	return allErrs
+}
+
 // ValidateClusterCIDRUpdate tests if an update to a ClusterCIDR is valid.
 func ValidateClusterCIDRUpdate(update, old *v1.ClusterCIDR) field.ErrorList {
 	var allErrs field.ErrorList
@@ -115,6 +152,9 @@ func validateClusterCIDRUpdateSpec(update, old *v1.ClusterCIDRSpec, fldPath *fie
 	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(update.PerNodeHostBits, old.PerNodeHostBits, fldPath.Child("perNodeHostBits"))...)
 	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(update.IPv4, old.IPv4, fldPath.Child("ipv4"))...)
 	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(update.IPv6, old.IPv6, fldPath.Child("ipv6"))...)
+	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(update.ControllerName, old.ControllerName, fldPath.Child("controllerName"))...)
+	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(update.ReuseCooldownSeconds, old.ReuseCooldownSeconds, fldPath.Child("reuseCooldownSeconds"))...)
+	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(update.AllocationStrategy, old.AllocationStrategy, fldPath.Child("allocationStrategy"))...)
 
 	return allErrs
 }
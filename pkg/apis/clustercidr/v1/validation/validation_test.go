@@ -103,6 +103,31 @@ func TestValidateClusterCIDR(t *testing.T) {
 			cc:        makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/64", nil),
 			expectErr: false,
 		},
+		{
+			name:      "valid ClusterCIDR, controllerName",
+			cc:        withControllerName(makeClusterCIDR(8, "10.1.0.0/16", "", nil), "example.com/gpu-ipam"),
+			expectErr: false,
+		},
+		{
+			name:      "valid ClusterCIDR, reuseCooldownSeconds",
+			cc:        withReuseCooldownSeconds(makeClusterCIDR(8, "10.1.0.0/16", "", nil), 300),
+			expectErr: false,
+		},
+		{
+			name:      "valid ClusterCIDR, Hash allocationStrategy",
+			cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "", nil), v1.AllocationStrategyHash, ""),
+			expectErr: false,
+		},
+		{
+			name:      "valid ClusterCIDR, Ordinal allocationStrategy",
+			cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "", nil), v1.AllocationStrategyOrdinal, "example.com/rack-slot"),
+			expectErr: false,
+		},
+		{
+			name:      "valid DualStack ClusterCIDR, paired families",
+			cc:        withPairedFamilies(makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/112", nil)),
+			expectErr: false,
+		},
 		// Failure cases.
 		{
 			name:      "invalid ClusterCIDR, no IPv4 or IPv6 CIDR",
@@ -114,6 +139,41 @@ func TestValidateClusterCIDR(t *testing.T) {
 			cc:        makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/64", makeNodeSelector("NoUppercaseOrSpecialCharsLike=Equals", corev1.NodeSelectorOpIn, []string{"bar"})),
 			expectErr: true,
 		},
+		{
+			name:      "invalid ClusterCIDR, controllerName is not domain-prefixed",
+			cc:        withControllerName(makeClusterCIDR(8, "10.1.0.0/16", "", nil), "gpu-ipam"),
+			expectErr: true,
+		},
+		{
+			name:      "invalid ClusterCIDR, negative reuseCooldownSeconds",
+			cc:        withReuseCooldownSeconds(makeClusterCIDR(8, "10.1.0.0/16", "", nil), -1),
+			expectErr: true,
+		},
+		{
+			name:      "invalid ClusterCIDR, unknown allocationStrategy",
+			cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "", nil), "Random", ""),
+			expectErr: true,
+		},
+		{
+			name:      "invalid ClusterCIDR, Ordinal allocationStrategy without ordinalLabel",
+			cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "", nil), v1.AllocationStrategyOrdinal, ""),
+			expectErr: true,
+		},
+		{
+			name:      "invalid ClusterCIDR, Ordinal allocationStrategy with invalid ordinalLabel",
+			cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "", nil), v1.AllocationStrategyOrdinal, "rack slot"),
+			expectErr: true,
+		},
+		{
+			name:      "invalid ClusterCIDR, ordinalLabel with Hash allocationStrategy",
+			cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "", nil), v1.AllocationStrategyHash, "example.com/rack-slot"),
+			expectErr: true,
+		},
+		{
+			name:      "invalid SingleStack ClusterCIDR, paired families",
+			cc:        withPairedFamilies(makeClusterCIDR(8, "10.1.0.0/16", "", nil)),
+			expectErr: true,
+		},
 		// IPv4 tests.
 		{
 			name:      "invalid SingleStack IPv4 ClusterCIDR, invalid spec.IPv4",
@@ -214,6 +274,18 @@ func TestValidateClusterConfigUpdate(t *testing.T) {
 		name:      "Failed update, update spec.NodeSelector",
 		cc:        makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/64", makeNodeSelector("foo", corev1.NodeSelectorOpIn, []string{"bar2"})),
 		expectErr: true,
+	}, {
+		name:      "Failed update, update spec.ControllerName",
+		cc:        withControllerName(makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/64", makeNodeSelector("foo", corev1.NodeSelectorOpIn, []string{"bar"})), "example.com/gpu-ipam"),
+		expectErr: true,
+	}, {
+		name:      "Failed update, update spec.ReuseCooldownSeconds",
+		cc:        withReuseCooldownSeconds(makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/64", makeNodeSelector("foo", corev1.NodeSelectorOpIn, []string{"bar"})), 60),
+		expectErr: true,
+	}, {
+		name:      "Failed update, update spec.AllocationStrategy",
+		cc:        withAllocationStrategy(makeClusterCIDR(8, "10.1.0.0/16", "fd00:1:1::/64", makeNodeSelector("foo", corev1.NodeSelectorOpIn, []string{"bar"})), v1.AllocationStrategyHash, ""),
+		expectErr: true,
 	}}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -227,3 +299,23 @@ func TestValidateClusterConfigUpdate(t *testing.T) {
 		})
 	}
 }
+
+func withControllerName(cc *v1.ClusterCIDR, controllerName string) *v1.ClusterCIDR {
+	cc.Spec.ControllerName = controllerName
+	return cc
+}
+
+func withReuseCooldownSeconds(cc *v1.ClusterCIDR, seconds int32) *v1.ClusterCIDR {
+	cc.Spec.ReuseCooldownSeconds = seconds
+	return cc
+}
+
+func withAllocationStrategy(cc *v1.ClusterCIDR, strategyType v1.AllocationStrategyType, ordinalLabel string) *v1.ClusterCIDR {
+	cc.Spec.AllocationStrategy = &v1.AllocationStrategy{Type: strategyType, OrdinalLabel: ordinalLabel}
+	return cc
+}
+
+func withPairedFamilies(cc *v1.ClusterCIDR) *v1.ClusterCIDR {
+	cc.Spec.AllocationStrategy = &v1.AllocationStrategy{Type: v1.AllocationStrategySequential, PairFamilies: true}
+	return cc
+}
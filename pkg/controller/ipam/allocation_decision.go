@@ -0,0 +1,217 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Outcomes of the ClusterCIDRs considered for an allocation.
+const (
+	candidateSelected    = "Selected"
+	candidateTerminating = "Terminating"
+	candidateExhausted   = "Exhausted"
+	candidateOtherShard  = "OtherShard"
+	candidateOverlapping = "Overlapping"
+	candidateNotTried    = "NotTried"
+)
+
+// stickyRule is the rule of the decisions restoring the podCIDRs a node had
+// before it was released.
+const stickyRule = "previous podCIDRs of the node"
+
+// allocationDecision records how the ClusterCIDR of a node was chosen.
+type allocationDecision struct {
+	Node string      `json:"node"`
+	Time metav1.Time `json:"time"`
+	// ClusterCIDR is the selected ClusterCIDR, empty if the allocation failed.
+	ClusterCIDR string   `json:"clusterCIDR,omitempty"`
+	PodCIDRs    []string `json:"podCIDRs,omitempty"`
+	// Rule is the rule that ranked the selected ClusterCIDR before the next
+	// candidate, empty if it was the last one.
+	Rule string `json:"rule,omitempty"`
+	// Candidates are the ClusterCIDRs matching the node, in priority order.
+	Candidates []allocationCandidate `json:"candidates"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// allocationCandidate describes a ClusterCIDR considered for an allocation.
+type allocationCandidate struct {
+	ClusterCIDR     string `json:"clusterCIDR"`
+	NodeSelector    string `json:"nodeSelector"`
+	LabelMatchCount int    `json:"labelMatchCount"`
+	MaxAllocatable  int    `json:"maxAllocatable"`
+	NodeMaskSize    int    `json:"nodeMaskSize"`
+	CIDR            string `json:"cidr"`
+	// RankedBy is the rule that ranked the previous candidate before this one.
+	RankedBy string `json:"rankedBy,omitempty"`
+	Outcome  string `json:"outcome"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func newAllocationDecision(node *corev1.Node) *allocationDecision {
+	return &allocationDecision{
+		Node:       node.Name,
+		Time:       metav1.Now(),
+		Candidates: make([]allocationCandidate, 0),
+	}
+}
+
+// addCandidates records the ranked ClusterCIDRs, not tried yet.
+func (d *allocationDecision) addCandidates(ranked []*PriorityQueueItem) {
+	for i, pqItem := range ranked {
+		candidate := allocationCandidate{
+			ClusterCIDR:     pqItem.clusterCIDR.Name,
+			NodeSelector:    pqItem.selectorString,
+			LabelMatchCount: pqItem.labelMatchCount,
+			MaxAllocatable:  pqItem.maxAllocatable(),
+			NodeMaskSize:    pqItem.nodeMaskSize(),
+			CIDR:            pqItem.cidrLabel(),
+			Outcome:         candidateNotTried,
+		}
+		if i > 0 {
+			candidate.RankedBy = priorityRule(ranked[i-1], pqItem)
+		}
+		d.Candidates = append(d.Candidates, candidate)
+	}
+}
+
+// setOutcome records the outcome of the i-th candidate.
+func (d *allocationDecision) setOutcome(i int, outcome string, reason error) {
+	d.Candidates[i].Outcome = outcome
+	if reason != nil {
+		d.Candidates[i].Reason = reason.Error()
+	}
+}
+
+// selected records the ClusterCIDR allocated from, the i-th candidate.
+func (d *allocationDecision) selected(i int, podCIDRs []string) {
+	d.setOutcome(i, candidateSelected, nil)
+	d.ClusterCIDR = d.Candidates[i].ClusterCIDR
+	d.PodCIDRs = podCIDRs
+	if i+1 < len(d.Candidates) {
+		d.Rule = d.Candidates[i+1].RankedBy
+	}
+}
+
+// selectedPerFamily records the ClusterCIDRs allocated from, the candidates at
+// the given indices, see perFamilyCIDRs. clusterCIDR is formatted like the
+// ClusterCIDRAnnotationKey annotation.
+func (d *allocationDecision) selectedPerFamily(indices []int, clusterCIDR string, podCIDRs []string) {
+	for _, i := range indices {
+		d.setOutcome(i, candidateSelected, nil)
+	}
+	d.ClusterCIDR = clusterCIDR
+	d.PodCIDRs = podCIDRs
+	if i := indices[0]; i+1 < len(d.Candidates) {
+		d.Rule = d.Candidates[i+1].RankedBy
+	}
+}
+
+// restored records the podCIDRs restored to the node, see restoreStickyCIDRs.
+func (d *allocationDecision) restored(clusterCIDR string, podCIDRs []string) {
+	d.ClusterCIDR = clusterCIDR
+	d.PodCIDRs = podCIDRs
+	d.Rule = stickyRule
+}
+
+// summary describes the decision in a single line.
+func (d *allocationDecision) summary() string {
+	var b strings.Builder
+	if d.ClusterCIDR != "" {
+		fmt.Fprintf(&b, "Allocated %s from ClusterCIDR %s", strings.Join(d.PodCIDRs, ","), d.ClusterCIDR)
+	} else {
+		b.WriteString("No podCIDR allocated")
+	}
+	if d.Rule != "" {
+		fmt.Fprintf(&b, " (%s)", d.Rule)
+	}
+
+	var skipped []string
+	for _, candidate := range d.Candidates {
+		if candidate.Outcome == candidateTerminating || candidate.Outcome == candidateExhausted {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", candidate.ClusterCIDR, candidate.Outcome))
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, ", skipped %s", strings.Join(skipped, ", "))
+	}
+	fmt.Fprintf(&b, ", %d candidate(s) considered", len(d.Candidates))
+	return b.String()
+}
+
+// allocationDecisionStore keeps the last allocation decision of every node.
+type allocationDecisionStore struct {
+	// lock guards decisions.
+	lock      sync.Mutex
+	decisions map[string]*allocationDecision
+}
+
+func newAllocationDecisionStore() *allocationDecisionStore {
+	return &allocationDecisionStore{
+		decisions: make(map[string]*allocationDecision),
+	}
+}
+
+func (s *allocationDecisionStore) set(decision *allocationDecision) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.decisions[decision.Node] = decision
+}
+
+func (s *allocationDecisionStore) get(node string) (*allocationDecision, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	decision, ok := s.decisions[node]
+	return decision, ok
+}
+
+func (s *allocationDecisionStore) remove(node string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.decisions, node)
+}
+
+// recordDecision stores and logs the decision, and summarizes successful
+// allocations in an event on the node.
+func (r *multiCIDRRangeAllocator) recordDecision(ctx context.Context, node *corev1.Node, decision *allocationDecision, err error) {
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	r.decisions.set(decision)
+
+	klog.FromContext(ctx).V(r.allocatorParams.AllocationDecisionLogVerbosity).Info("Allocation decision", "node", klog.KObj(node), "decision", decision)
+	if err == nil && decision.ClusterCIDR != "" {
+		ref := &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       node.Name,
+			UID:        node.UID,
+		}
+		r.recorder.Event(ref, corev1.EventTypeNormal, "CIDRAllocationDecision", decision.summary())
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+func TestAllocationDecision(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	poolA := makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})
+	zonedPoolA := makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})
+	zonedPoolA.NodeSelectorTerms[0].MatchExpressions = append(zonedPoolA.NodeSelectorTerms[0].MatchExpressions,
+		corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"z1"}})
+
+	clusterCIDRs := []*v1.ClusterCIDR{
+		makeSyncedClusterCIDR("terminating", "10.0.0.0/16", "", 8, zonedPoolA),
+		// Room for a single node.
+		makeSyncedClusterCIDR("full", "10.10.0.0/28", "", 4, poolA),
+		makeSyncedClusterCIDR("small", "10.20.0.0/16", "", 8, poolA),
+		makeSyncedClusterCIDR("large", "10.30.0.0/15", "", 8, poolA),
+	}
+
+	otherNode := makeAllocatedNode("other-node", map[string]string{"pool": "a"}, "10.10.0.0/28")
+	node := makeNode("node", map[string]string{"pool": "a", "zone": "z1"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{otherNode, node}, clusterCIDRs...)
+	require.NoError(t, ra.bootstrap(ctx))
+	recorder := record.NewFakeRecorder(10)
+	ra.recorder = recorder
+	for _, clusterCIDRList := range ra.cidrMap {
+		for _, clusterCIDR := range clusterCIDRList {
+			if clusterCIDR.Name == "terminating" {
+				clusterCIDR.Terminating = true
+			}
+		}
+	}
+
+	require.NoError(t, ra.AllocateOrOccupyCIDR(ctx, node))
+
+	decision, ok := ra.decisions.get("node")
+	require.True(t, ok)
+	assert.Equal(t, "small", decision.ClusterCIDR)
+	assert.Equal(t, []string{"10.20.0.0/24"}, decision.PodCIDRs)
+	assert.Equal(t, priorityRuleMaxAllocatable, decision.Rule)
+	assert.Empty(t, decision.Error)
+
+	type outcome struct{ clusterCIDR, rankedBy, outcome string }
+	var outcomes []outcome
+	for _, candidate := range decision.Candidates {
+		outcomes = append(outcomes, outcome{candidate.ClusterCIDR, candidate.RankedBy, candidate.Outcome})
+	}
+	assert.Equal(t, []outcome{
+		{"terminating", "", candidateTerminating},
+		{"full", priorityRuleLabelMatchCount, candidateExhausted},
+		{"small", priorityRuleMaxAllocatable, candidateSelected},
+		{"large", priorityRuleMaxAllocatable, candidateNotTried},
+	}, outcomes)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Normal CIDRAllocationDecision Allocated 10.20.0.0/24 from ClusterCIDR small ("+priorityRuleMaxAllocatable+
+		"), skipped terminating (Terminating), full (Exhausted), 4 candidate(s) considered", <-recorder.Events)
+
+	mux := http.NewServeMux()
+	ra.AddDebugHandlers(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/ipam/decisions/node", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served allocationDecision
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, "small", served.ClusterCIDR)
+	assert.Len(t, served.Candidates, 4)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/ipam/decisions/other-node", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAllocationDecisionFailure(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	node := makeNode("node", map[string]string{"pool": "b"})
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node})
+	require.NoError(t, ra.bootstrap(ctx))
+
+	require.Error(t, ra.AllocateOrOccupyCIDR(ctx, node))
+
+	decision, ok := ra.decisions.get("node")
+	require.True(t, ok)
+	assert.Empty(t, decision.ClusterCIDR)
+	assert.Empty(t, decision.Candidates)
+	assert.Contains(t, decision.Error, errNoMatchingClusterCIDR.Error())
+}
+
+func TestPriorityRuleMatchesLess(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDRs := []*v1.ClusterCIDR{
+		makeSyncedClusterCIDR("a", "10.0.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})),
+		makeSyncedClusterCIDR("b", "10.1.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})),
+		makeSyncedClusterCIDR("c", "10.2.0.0/16", "", 6, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})),
+		makeSyncedClusterCIDR("d", "10.3.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a", "b"})),
+	}
+	node := makeNode("node", map[string]string{"pool": "a"})
+	ra := newBootstrapTestAllocator(t, ctx, nil, clusterCIDRs...)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	ranked, err := ra.rankedClusterCIDRs(node, ra.cidrMap)
+	require.NoError(t, err)
+	require.Len(t, ranked, 4)
+	for i := 1; i < len(ranked); i++ {
+		pq := PriorityQueue{ranked[i-1], ranked[i]}
+		assert.True(t, pq.Less(0, 1), "%s before %s", ranked[i-1].clusterCIDR.Name, ranked[i].clusterCIDR.Name)
+	}
+	var names, rules []string
+	for i, pqItem := range ranked {
+		names = append(names, pqItem.clusterCIDR.Name)
+		if i > 0 {
+			rules = append(rules, priorityRule(ranked[i-1], pqItem))
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "d", "c"}, names)
+	assert.Equal(t, []string{priorityRuleCIDR, priorityRuleSelector, priorityRuleMaxAllocatable}, rules)
+}
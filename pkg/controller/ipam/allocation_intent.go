@@ -0,0 +1,233 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	netutil "k8s.io/utils/net"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// AllocationIntentAnnotationKey is the annotation recording on a node the
+// podCIDRs reserved for it before they are patched. The patch setting the
+// podCIDRs removes it, so a node still carrying it after a crash or a patch of
+// unknown outcome tells the next leader which CIDRs may be in use.
+const AllocationIntentAnnotationKey = "networking.x-k8s.io/pod-cidrs-intent"
+
+// allocationIntent is the value of the AllocationIntentAnnotationKey
+// annotation.
+type allocationIntent struct {
+	// ClusterCIDR is the name of the ClusterCIDR of the podCIDRs, formatted
+	// like the ClusterCIDRAnnotationKey annotation.
+	ClusterCIDR string   `json:"clusterCIDR"`
+	PodCIDRs    []string `json:"podCIDRs"`
+}
+
+func newAllocationIntent(data multiCIDRNodeReservedCIDRs) allocationIntent {
+	return allocationIntent{
+		ClusterCIDR: clusterCIDRNames(data.clusterCIDRs),
+		PodCIDRs:    ipnetToStringList(data.allocatedCIDRs),
+	}
+}
+
+func (i allocationIntent) String() string {
+	value, _ := json.Marshal(i)
+	return string(value)
+}
+
+// nodeAllocationIntent returns the allocation intent recorded on the node, nil
+// if there is none.
+func nodeAllocationIntent(node *corev1.Node) (*allocationIntent, error) {
+	value, ok := node.Annotations[AllocationIntentAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	intent := &allocationIntent{}
+	if err := json.Unmarshal([]byte(value), intent); err != nil {
+		return nil, fmt.Errorf("invalid allocation intent %q on node %s: %w", value, node.Name, err)
+	}
+	return intent, nil
+}
+
+// recordsAllocationIntent returns whether the intent is recorded on the node.
+func recordsAllocationIntent(node *corev1.Node, intent allocationIntent) bool {
+	recorded, err := nodeAllocationIntent(node)
+	return err == nil && recorded != nil && recorded.ClusterCIDR == intent.ClusterCIDR && slices.Equal(recorded.PodCIDRs, intent.PodCIDRs)
+}
+
+// intentClusterCIDRs requires the caller to hold r.lock.
+// intentClusterCIDRs returns the ClusterCIDR of each CIDR of the allocation
+// intent, nil if one of them is not in the cidrMap.
+func intentClusterCIDRs(intent *allocationIntent, cidrMap map[string][]*cidrset.ClusterCIDR) []*cidrset.ClusterCIDR {
+	names := clusterCIDRNamesOf(intent.ClusterCIDR, len(intent.PodCIDRs))
+	if names == nil {
+		return nil
+	}
+	clusterCIDRs := make([]*cidrset.ClusterCIDR, 0, len(names))
+	for _, name := range names {
+		clusterCIDR := clusterCIDRByName(name, cidrMap)
+		if clusterCIDR == nil {
+			return nil
+		}
+		clusterCIDRs = append(clusterCIDRs, clusterCIDR)
+	}
+	return clusterCIDRs
+}
+
+// occupyIntent requires the caller to hold r.lock.
+// occupyIntent marks the CIDRs of the allocation intent recorded on the node
+// as used, so that they are not handed out to other nodes until the intent is
+// resolved. It returns the ClusterCIDR of each CIDR and the CIDRs of the
+// intent, nil if the node has none.
+func (r *multiCIDRRangeAllocator) occupyIntent(logger klog.Logger, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*cidrset.ClusterCIDR, []*net.IPNet, error) {
+	intent, err := nodeAllocationIntent(node)
+	if err != nil || intent == nil {
+		return nil, nil, err
+	}
+	if len(intent.PodCIDRs) == 0 {
+		return nil, nil, fmt.Errorf("allocation intent of node %s has no podCIDRs", node.Name)
+	}
+	clusterCIDRs := intentClusterCIDRs(intent, cidrMap)
+	if clusterCIDRs == nil {
+		return nil, nil, fmt.Errorf("clusterCIDR %s of the allocation intent of node %s is not loaded", intent.ClusterCIDR, node.Name)
+	}
+	cidrs := make([]*net.IPNet, 0, len(intent.PodCIDRs))
+	for _, cidr := range intent.PodCIDRs {
+		_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse CIDR %s of the allocation intent of node %s: %w", cidr, node.Name, err)
+		}
+		cidrs = append(cidrs, podCIDR)
+	}
+	for i, podCIDR := range cidrs {
+		if err := r.Occupy(clusterCIDRs[i], podCIDR); err != nil {
+			return nil, nil, err
+		}
+	}
+	logger.V(2).Info("Occupied the CIDRs of the allocation intent of node", "node", klog.KObj(node), "clusterCIDR", intent.ClusterCIDR, "podCIDRs", intent.PodCIDRs)
+	return clusterCIDRs, cidrs, nil
+}
+
+// releaseIntent requires the caller to hold r.lock.
+// releaseIntent releases the CIDRs of the allocation intent recorded on the
+// node that are not its podCIDRs.
+func (r *multiCIDRRangeAllocator) releaseIntent(logger klog.Logger, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) error {
+	intent, err := nodeAllocationIntent(node)
+	if err != nil || intent == nil {
+		return nil
+	}
+	clusterCIDRs := intentClusterCIDRs(intent, cidrMap)
+	if clusterCIDRs == nil {
+		return nil
+	}
+	for i, cidr := range intent.PodCIDRs {
+		if slices.Contains(node.Spec.PodCIDRs, cidr) {
+			continue
+		}
+		_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
+		if err != nil {
+			continue
+		}
+		logger.V(2).Info("Releasing CIDR of the allocation intent of node", "node", klog.KObj(node), "CIDR", cidr)
+		if err := r.Unreserve(logger, clusterCIDRs[i], podCIDR); err != nil {
+			return fmt.Errorf("failed to release cidr %q of the allocation intent of node %q: %w", cidr, node.Name, err)
+		}
+	}
+	return nil
+}
+
+// resumeAllocationIntent requires the caller to hold r.lock.
+// resumeAllocationIntent completes the allocation intent recorded on a node
+// without podCIDRs: its CIDRs may already be set on the node by a patch whose
+// outcome is unknown, so they are patched again rather than allocating new
+// ones. It returns false if the node has no intent to resume, an intent that
+// can not be resumed is dropped. It returns the PodCIDRAssigned condition to
+// report on the node, if any.
+func (r *multiCIDRRangeAllocator) resumeAllocationIntent(ctx context.Context, node *corev1.Node) (bool, *podCIDRAssignment, error) {
+	logger := klog.FromContext(ctx)
+	if _, ok := node.Annotations[AllocationIntentAnnotationKey]; !ok {
+		return false, nil, nil
+	}
+	clusterCIDRs, cidrs, err := r.occupyIntent(logger, node, r.cidrMap)
+	if err != nil {
+		logger.Info("Dropping the allocation intent of node", "node", klog.KObj(node), "err", err)
+		if err := r.clearAllocationIntent(ctx, node); err != nil {
+			return true, nil, err
+		}
+		return false, nil, nil
+	}
+
+	logger.Info("Resuming the allocation intent of node", "node", klog.KObj(node), "clusterCIDR", clusterCIDRNames(clusterCIDRs), "podCIDRs", cidrs)
+	assignment, err := r.updateCIDRsAllocation(ctx, multiCIDRNodeReservedCIDRs{
+		nodeReservedCIDRs: nodeReservedCIDRs{
+			nodeName:       node.Name,
+			allocatedCIDRs: cidrs,
+		},
+		clusterCIDRs: clusterCIDRs,
+	})
+	return true, assignment, err
+}
+
+// resolveAllocationIntent requires the caller to hold r.lock.
+// resolveAllocationIntent releases the CIDRs of the allocation intent recorded
+// on a node that has podCIDRs, unless they are its podCIDRs, and removes the
+// intent.
+func (r *multiCIDRRangeAllocator) resolveAllocationIntent(ctx context.Context, node *corev1.Node) error {
+	if _, ok := node.Annotations[AllocationIntentAnnotationKey]; !ok {
+		return nil
+	}
+	if err := r.releaseIntent(klog.FromContext(ctx), node, r.cidrMap); err != nil {
+		return err
+	}
+	return r.clearAllocationIntent(ctx, node)
+}
+
+// clearAllocationIntent removes the allocation intent from the node.
+func (r *multiCIDRRangeAllocator) clearAllocationIntent(ctx context.Context, node *corev1.Node) error {
+	klog.FromContext(ctx).V(2).Info("Removing the allocation intent of node", "node", klog.KObj(node))
+	_, err := r.patchNode(ctx, node.Name, nodeForCIDRMergePatch{
+		Metadata: &nodeMetadataForMergePatch{
+			Annotations: map[string]*string{AllocationIntentAnnotationKey: nil},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove the allocation intent of node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// clusterCIDRByName requires the caller to hold r.lock.
+// clusterCIDRByName returns the ClusterCIDR with the given name in the
+// cidrMap, nil if it is not loaded.
+func clusterCIDRByName(name string, cidrMap map[string][]*cidrset.ClusterCIDR) *cidrset.ClusterCIDR {
+	for _, clusterCIDRList := range cidrMap {
+		for _, clusterCIDR := range clusterCIDRList {
+			if clusterCIDR.Name == name {
+				return clusterCIDR
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2/ktesting"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+func withAllocationIntent(node *corev1.Node, intent allocationIntent) *corev1.Node {
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[AllocationIntentAnnotationKey] = intent.String()
+	return node
+}
+
+func updatedNode(t *testing.T, ra *multiCIDRRangeAllocator, name string) *corev1.Node {
+	t.Helper()
+	updatedNodes := ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy()
+	i := slices.IndexFunc(updatedNodes, func(node *corev1.Node) bool { return node.Name == name })
+	require.NotEqual(t, -1, i, name)
+	return updatedNodes[i]
+}
+
+func TestAllocationIntentRemovedOnAllocation(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	requests := map[bool]int{}
+	for _, recordIntent := range []bool{false, true} {
+		ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{makeNode("node", nil)}, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+		ra.allocatorParams.RecordAllocationIntent = recordIntent
+		require.NoError(t, ra.bootstrap(ctx))
+
+		require.NoError(t, ra.syncNode(ctx, "node"))
+		node := updatedNode(t, ra, "node")
+		assert.Equal(t, []string{"10.10.0.0/24"}, node.Spec.PodCIDRs)
+		assert.NotContains(t, node.Annotations, AllocationIntentAnnotationKey)
+		requests[recordIntent] = ra.client.(*test.FakeNodeHandler).RequestCount
+	}
+	// The intent and the podCIDRs are patched separately, only when the
+	// intent is recorded.
+	assert.Equal(t, requests[false]+1, requests[true])
+}
+
+func TestAllocationIntentResumed(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	// The podCIDRs patch of the node timed out before the restart.
+	intentNode := withAllocationIntent(makeNode("intent", nil), allocationIntent{ClusterCIDR: "cc", PodCIDRs: []string{"10.10.0.0/24"}})
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{intentNode, makeNode("new", nil)}, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// The CIDRs of the intent are not handed out to another node.
+	require.NoError(t, ra.syncNode(ctx, "new"))
+	assert.Equal(t, []string{"10.10.1.0/24"}, updatedNode(t, ra, "new").Spec.PodCIDRs)
+
+	require.NoError(t, ra.syncNode(ctx, "intent"))
+	node := updatedNode(t, ra, "intent")
+	assert.Equal(t, []string{"10.10.0.0/24"}, node.Spec.PodCIDRs)
+	assert.NotContains(t, node.Annotations, AllocationIntentAnnotationKey)
+}
+
+func TestAllocationIntentResolved(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	// The node got other podCIDRs than the ones of its intent.
+	node := withAllocationIntent(makeAllocatedNode("node", nil, "10.10.1.0/24"), allocationIntent{ClusterCIDR: "cc", PodCIDRs: []string{"10.10.7.0/24"}})
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	nodeSelector, err := ra.nodeSelectorKey(clusterCIDR)
+	require.NoError(t, err)
+	cidrSet := ra.cidrMap[nodeSelector][0].IPv4CIDRSet
+	_, intentCIDR, _ := utilnet.ParseCIDRSloppy("10.10.7.0/24")
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.1.0/24")
+
+	require.NoError(t, ra.syncNode(ctx, "node"))
+	assert.NotContains(t, updatedNode(t, ra, "node").Annotations, AllocationIntentAnnotationKey)
+	assert.False(t, cidrSet.CIDRAllocated(intentCIDR))
+	assert.True(t, cidrSet.CIDRAllocated(podCIDR))
+}
+
+func TestAllocationIntentDropped(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	node := withAllocationIntent(makeNode("node", nil), allocationIntent{ClusterCIDR: "deleted", PodCIDRs: []string{"10.20.0.0/24"}})
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+	require.NoError(t, ra.bootstrap(ctx))
+
+	require.NoError(t, ra.syncNode(ctx, "node"))
+	updated := updatedNode(t, ra, "node")
+	assert.Equal(t, []string{"10.10.0.0/24"}, updated.Spec.PodCIDRs)
+	assert.NotContains(t, updated.Annotations, AllocationIntentAnnotationKey)
+}
+
+func TestReleaseAllocationIntent(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	node := withAllocationIntent(makeNode("node", nil), allocationIntent{ClusterCIDR: "cc", PodCIDRs: []string{"10.10.3.0/24"}})
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	nodeSelector, err := ra.nodeSelectorKey(clusterCIDR)
+	require.NoError(t, err)
+	cidrSet := ra.cidrMap[nodeSelector][0].IPv4CIDRSet
+	_, intentCIDR, _ := utilnet.ParseCIDRSloppy("10.10.3.0/24")
+	assert.True(t, cidrSet.CIDRAllocated(intentCIDR))
+
+	// The node is deleted before the intent is resolved.
+	require.NoError(t, ra.ReleaseCIDR(ctx, node))
+	assert.False(t, cidrSet.CIDRAllocated(intentCIDR))
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	netutil "k8s.io/utils/net"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// allocationStrategyType returns the allocation strategy of the ClusterCIDR,
+// Sequential if unset.
+func allocationStrategyType(clusterCIDR *cidrset.ClusterCIDR) v1.AllocationStrategyType {
+	if clusterCIDR.AllocationStrategy == nil || clusterCIDR.AllocationStrategy.Type == "" {
+		return v1.AllocationStrategySequential
+	}
+	return clusterCIDR.AllocationStrategy.Type
+}
+
+// candidateProber returns the function probing the candidate CIDRs of the
+// cidrSet for the node. The CIDRs are probed from the index derived from the
+// node according to the allocation strategy of the ClusterCIDR, or
+// round-robin if the strategy is Sequential or the index can not be derived.
+func candidateProber(logger klog.Logger, node *corev1.Node, clusterCIDR *cidrset.ClusterCIDR, cidrSet *cidrset.MultiCIDRSet) func() (*net.IPNet, int, error) {
+	index, ok := preferredCIDRIndex(logger, node, clusterCIDR, cidrSet, cidrSet.MaxCIDRs)
+	if !ok {
+		return cidrSet.NextCandidate
+	}
+	return func() (*net.IPNet, int, error) {
+		candidate, evaluated, err := cidrSet.CandidateFrom(index)
+		// Resume after the candidate if it collides with another ClusterCIDR.
+		index += evaluated + 1
+		return candidate, evaluated, err
+	}
+}
+
+// pairsFamilies returns whether the IPv4 and IPv6 CIDRs of a node are
+// allocated at the same index of the sets of the ClusterCIDR.
+func pairsFamilies(clusterCIDR *cidrset.ClusterCIDR) bool {
+	return clusterCIDR.AllocationStrategy != nil && clusterCIDR.AllocationStrategy.PairFamilies &&
+		clusterCIDR.IPv4CIDRSet != nil && clusterCIDR.IPv6CIDRSet != nil
+}
+
+// allocatePairedCIDRs requires the caller to hold r.lock.
+// allocatePairedCIDRs allocates the IPv4 and IPv6 CIDRs at the same index of
+// the sets of the ClusterCIDR to the node, skipping the indices taken in
+// either set. The indices are probed from the one derived from the node
+// according to the allocation strategy of the ClusterCIDR, or round-robin.
+func (r *multiCIDRRangeAllocator) allocatePairedCIDRs(
+	ctx context.Context, node *corev1.Node, clusterCIDR *cidrset.ClusterCIDR, cidrMap map[string][]*cidrset.ClusterCIDR,
+) (cidrs []*net.IPNet, err error) {
+	logger := klog.FromContext(ctx)
+	_, span := r.tracer.Start(ctx, "allocatePairedCIDRs", trace.WithAttributes(
+		attribute.String("clusterCIDR", clusterCIDR.Name),
+		attribute.String("strategy", string(allocationStrategyType(clusterCIDR))),
+	))
+	evaluated := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("evaluated", evaluated))
+		if cidrs != nil {
+			span.SetAttributes(attribute.StringSlice("cidrs", ipnetToStringList(cidrs)))
+		}
+		endSpan(span, err)
+	}()
+
+	cidrSets := []*cidrset.MultiCIDRSet{clusterCIDR.IPv4CIDRSet, clusterCIDR.IPv6CIDRSet}
+	// Only the indices of the smaller set can be paired.
+	maxCIDRs := min(clusterCIDR.IPv4CIDRSet.MaxCIDRs, clusterCIDR.IPv6CIDRSet.MaxCIDRs)
+	start, derived := preferredCIDRIndex(logger, node, clusterCIDR, clusterCIDR.IPv4CIDRSet, maxCIDRs)
+	if !derived {
+		start = clusterCIDR.NextPairedIndex
+	}
+	start %= maxCIDRs
+
+	for ; evaluated < maxCIDRs; evaluated++ {
+		index := (start + evaluated) % maxCIDRs
+		pair := make([]*net.IPNet, 0, len(cidrSets))
+		for _, cidrSet := range cidrSets {
+			cidr, free, err := cidrSet.CIDRAt(index)
+			if err != nil {
+				return nil, err
+			}
+			if !free || r.cidrInAllocatedList(logger, cidr, cidrMap) || r.cidrOverlapWithAllocatedList(logger, cidr, cidrMap) {
+				break
+			}
+			pair = append(pair, cidr)
+		}
+		if len(pair) < len(cidrSets) {
+			continue
+		}
+
+		for j, cidr := range pair {
+			if err := r.Occupy(clusterCIDR, cidr); err != nil {
+				r.releaseReservedCIDRs(logger, pair[:j], []*cidrset.ClusterCIDR{clusterCIDR, clusterCIDR})
+				return nil, err
+			}
+		}
+		if !derived {
+			clusterCIDR.NextPairedIndex = (index + 1) % maxCIDRs
+		}
+		for _, cidrSet := range cidrSets {
+			cidrSet.UpdateEvaluatedCount(evaluated)
+		}
+		return pair, nil
+	}
+	return nil, &cidrset.CIDRRangeNoCIDRsRemainingErr{
+		CIDR: clusterCIDR.IPv4CIDRSet.Label + "," + clusterCIDR.IPv6CIDRSet.Label,
+	}
+}
+
+// preferredCIDRIndex returns the index, below maxCIDRs, of the CIDR of the
+// cidrSet derived from the node according to the allocation strategy of the
+// ClusterCIDR, false if there is none.
+func preferredCIDRIndex(logger klog.Logger, node *corev1.Node, clusterCIDR *cidrset.ClusterCIDR, cidrSet *cidrset.MultiCIDRSet, maxCIDRs int) (int, bool) {
+	switch allocationStrategyType(clusterCIDR) {
+	case v1.AllocationStrategyHash:
+		h := fnv.New64a()
+		h.Write([]byte(node.Name))
+		return int(h.Sum64() % uint64(maxCIDRs)), true
+	case v1.AllocationStrategyOrdinal:
+		label := clusterCIDR.AllocationStrategy.OrdinalLabel
+		value, ok := node.Labels[label]
+		if !ok {
+			logger.V(2).Info("Node has no ordinal label, allocating sequentially", "node", klog.KObj(node), "clusterCIDR", clusterCIDR.Name, "label", label)
+			return 0, false
+		}
+		ordinal, err := strconv.Atoi(value)
+		if err != nil || ordinal < 0 {
+			logger.V(2).Info("Node has an invalid ordinal label, allocating sequentially", "node", klog.KObj(node), "clusterCIDR", clusterCIDR.Name, "label", label, "value", value)
+			return 0, false
+		}
+		// Wrapping the ordinal around would give the node the podCIDR of
+		// another one.
+		if ordinal >= maxCIDRs {
+			logger.V(2).Info("Node has an ordinal label beyond the range, allocating sequentially", "node", klog.KObj(node), "clusterCIDR", clusterCIDR.Name, "label", label, "value", value, "maxCIDRs", maxCIDRs)
+			return 0, false
+		}
+		return ordinal, true
+	case v1.AllocationStrategyNodeIPDerived:
+		ip := nodeInternalIP(node, netutil.IsIPv6CIDR(cidrSet.ClusterCIDR))
+		if ip == nil {
+			logger.V(2).Info("Node has no InternalIP, allocating sequentially", "node", klog.KObj(node), "clusterCIDR", clusterCIDR.Name)
+			return 0, false
+		}
+		// MaxCIDRs is a power of two of at most 2^16, so the index is made of
+		// the lowest bits of the host part of the node IP.
+		return (int(ip[len(ip)-2])<<8 | int(ip[len(ip)-1])) % maxCIDRs, true
+	default:
+		return 0, false
+	}
+}
+
+// nodeInternalIP returns the first InternalIP of the node of the IP family,
+// or of the other family if there is none, nil if the node has no InternalIP.
+// IPv4 addresses are returned in their 4-byte representation.
+func nodeInternalIP(node *corev1.Node, isIPv6 bool) net.IP {
+	var other net.IP
+	for _, address := range node.Status.Addresses {
+		if address.Type != corev1.NodeInternalIP {
+			continue
+		}
+		ip := netutil.ParseIPSloppy(address.Address)
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if netutil.IsIPv6(ip) == isIPv6 {
+			return ip
+		}
+		if other == nil {
+			other = ip
+		}
+	}
+	return other
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+func withInternalIP(node *corev1.Node, internalIP string) *corev1.Node {
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: node.Name},
+		{Type: corev1.NodeInternalIP, Address: internalIP},
+	}
+	return node
+}
+
+func TestAllocationStrategy(t *testing.T) {
+	h := fnv.New64a()
+	h.Write([]byte("node"))
+	hashedPodCIDR := fmt.Sprintf("10.10.%d.0/24", h.Sum64()%256)
+
+	testCases := []struct {
+		name        string
+		strategy    v1.AllocationStrategy
+		node        *corev1.Node
+		allocated   []*corev1.Node
+		wantPodCIDR string
+	}{
+		{
+			name:        "sequential",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategySequential},
+			node:        withInternalIP(makeNode("node", nil), "192.168.3.21"),
+			wantPodCIDR: "10.10.0.0/24",
+		},
+		{
+			name:        "hash",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyHash},
+			node:        makeNode("node", nil),
+			wantPodCIDR: hashedPodCIDR,
+		},
+		{
+			name:        "ordinal",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot"},
+			node:        makeNode("node", map[string]string{"rack-slot": "7"}),
+			wantPodCIDR: "10.10.7.0/24",
+		},
+		{
+			name:        "ordinal beyond the range",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot"},
+			node:        makeNode("node", map[string]string{"rack-slot": "256"}),
+			allocated:   []*corev1.Node{makeAllocatedNode("other", nil, "10.10.7.0/24")},
+			wantPodCIDR: "10.10.0.0/24",
+		},
+		{
+			name:        "ordinal taken",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot"},
+			node:        makeNode("node", map[string]string{"rack-slot": "7"}),
+			allocated:   []*corev1.Node{makeAllocatedNode("other", nil, "10.10.7.0/24")},
+			wantPodCIDR: "10.10.8.0/24",
+		},
+		{
+			name:        "ordinal label missing",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot"},
+			node:        makeNode("node", nil),
+			wantPodCIDR: "10.10.0.0/24",
+		},
+		{
+			name:        "ordinal label invalid",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot"},
+			node:        makeNode("node", map[string]string{"rack-slot": "-1"}),
+			wantPodCIDR: "10.10.0.0/24",
+		},
+		{
+			name:        "node IP derived",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyNodeIPDerived},
+			node:        withInternalIP(makeNode("node", nil), "192.168.3.21"),
+			wantPodCIDR: "10.10.21.0/24",
+		},
+		{
+			name:        "node IP derived from an IP of the other family",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyNodeIPDerived},
+			node:        withInternalIP(makeNode("node", nil), "fd00::3:15"),
+			wantPodCIDR: "10.10.21.0/24",
+		},
+		{
+			name:        "node IP derived without InternalIP",
+			strategy:    v1.AllocationStrategy{Type: v1.AllocationStrategyNodeIPDerived},
+			node:        makeNode("node", nil),
+			wantPodCIDR: "10.10.0.0/24",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+			clusterCIDR.Spec.AllocationStrategy = &tc.strategy
+			nodes := append([]*corev1.Node{tc.node}, tc.allocated...)
+			ra := newBootstrapTestAllocator(t, ctx, nodes, clusterCIDR)
+			require.NoError(t, ra.bootstrap(ctx))
+
+			require.NoError(t, ra.syncNode(ctx, tc.node.Name))
+			assert.Equal(t, []string{tc.wantPodCIDR}, updatedNode(t, ra, tc.node.Name).Spec.PodCIDRs)
+		})
+	}
+}
+
+func TestPairedFamilies(t *testing.T) {
+	testCases := []struct {
+		name         string
+		strategy     v1.AllocationStrategy
+		nodes        []*corev1.Node
+		wantPodCIDRs map[string][]string
+	}{
+		{
+			name:     "sequential skips the indices taken in either family",
+			strategy: v1.AllocationStrategy{Type: v1.AllocationStrategySequential, PairFamilies: true},
+			nodes: []*corev1.Node{
+				makeAllocatedNode("diverged", nil, "10.10.0.0/24", "fd00:10::100/120"),
+				makeNode("node-a", nil),
+				makeNode("node-b", nil),
+			},
+			wantPodCIDRs: map[string][]string{
+				"node-a": {"10.10.2.0/24", "fd00:10::200/120"},
+				"node-b": {"10.10.3.0/24", "fd00:10::300/120"},
+			},
+		},
+		{
+			name:     "ordinal",
+			strategy: v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot", PairFamilies: true},
+			nodes: []*corev1.Node{
+				makeAllocatedNode("diverged", nil, "10.10.4.0/24", "fd00:10::500/120"),
+				makeNode("node-a", map[string]string{"rack-slot": "4"}),
+				makeNode("node-b", map[string]string{"rack-slot": "9"}),
+			},
+			wantPodCIDRs: map[string][]string{
+				"node-a": {"10.10.6.0/24", "fd00:10::600/120"},
+				"node-b": {"10.10.9.0/24", "fd00:10::900/120"},
+			},
+		},
+		{
+			name:     "ordinal beyond the range",
+			strategy: v1.AllocationStrategy{Type: v1.AllocationStrategyOrdinal, OrdinalLabel: "rack-slot", PairFamilies: true},
+			nodes: []*corev1.Node{
+				makeAllocatedNode("diverged", nil, "10.10.0.0/24", "fd00:10::100/120"),
+				makeNode("node-a", map[string]string{"rack-slot": "256"}),
+				makeNode("node-b", map[string]string{"rack-slot": "3"}),
+			},
+			wantPodCIDRs: map[string][]string{
+				"node-a": {"10.10.2.0/24", "fd00:10::200/120"},
+				"node-b": {"10.10.3.0/24", "fd00:10::300/120"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "fd00:10::/112", 8, nil)
+			clusterCIDR.Spec.AllocationStrategy = &tc.strategy
+			ra := newBootstrapTestAllocator(t, ctx, tc.nodes, clusterCIDR)
+			require.NoError(t, ra.bootstrap(ctx))
+
+			for _, name := range []string{"node-a", "node-b"} {
+				require.NoError(t, ra.syncNode(ctx, name))
+				assert.Equal(t, tc.wantPodCIDRs[name], updatedNode(t, ra, name).Spec.PodCIDRs, name)
+			}
+		})
+	}
+}
+
+func TestPairedFamiliesExhausted(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	// Two IPv4 and four IPv6 podCIDRs.
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/23", "fd00:10::/118", 8, nil)
+	clusterCIDR.Spec.AllocationStrategy = &v1.AllocationStrategy{Type: v1.AllocationStrategySequential, PairFamilies: true}
+	nodes := []*corev1.Node{
+		makeAllocatedNode("diverged", nil, "10.10.0.0/24", "fd00:10::100/120"),
+		makeNode("new", nil),
+	}
+	ra := newBootstrapTestAllocator(t, ctx, nodes, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// Each family has free podCIDRs, but at different indices, and the IPv6
+	// podCIDRs beyond the IPv4 range can not be paired.
+	require.Error(t, ra.syncNode(ctx, "new"))
+	cidrSets := clusterCIDRByName("cc", ra.cidrMap)
+	assert.Equal(t, 1, cidrSets.IPv4CIDRSet.AllocatedCount())
+	assert.Equal(t, 1, cidrSets.IPv6CIDRSet.AllocatedCount())
+}
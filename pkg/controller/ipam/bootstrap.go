@@ -0,0 +1,237 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+// bootstrapRetryInterval is the time to wait before retrying ClusterCIDRs
+// that could not be regenerated during bootstrap because of transient errors.
+const bootstrapRetryInterval = 5 * time.Second
+
+// BootstrapPhase describes how far the allocator got in rebuilding its
+// in-memory state. Nodes are only allocated once the phase is BootstrapPhaseComplete.
+type BootstrapPhase string
+
+const (
+	// BootstrapPhasePending means Run has not been called yet.
+	BootstrapPhasePending BootstrapPhase = "Pending"
+	// BootstrapPhaseWaitingForCacheSync means the allocator waits for the Node
+	// and ClusterCIDR informers to sync.
+	BootstrapPhaseWaitingForCacheSync BootstrapPhase = "WaitingForCacheSync"
+	// BootstrapPhaseLoadingClusterCIDRs means the allocator regenerates the
+	// cidrMap from the existing ClusterCIDRs.
+	BootstrapPhaseLoadingClusterCIDRs BootstrapPhase = "LoadingClusterCIDRs"
+	// BootstrapPhaseOccupyingNodeCIDRs means the allocator marks the podCIDRs
+	// of the existing nodes as used.
+	BootstrapPhaseOccupyingNodeCIDRs BootstrapPhase = "OccupyingNodeCIDRs"
+	// BootstrapPhaseComplete means the allocator state is rebuilt and the
+	// workers are started.
+	BootstrapPhaseComplete BootstrapPhase = "Complete"
+)
+
+// invalidClusterCIDRErr is returned when a ClusterCIDR can not be turned into
+// cidrSets. Retrying such a ClusterCIDR is useless until its spec changes.
+type invalidClusterCIDRErr struct {
+	name string
+	err  error
+}
+
+func (e *invalidClusterCIDRErr) Error() string {
+	return fmt.Sprintf("invalid ClusterCIDR %s: %v", e.name, e.err)
+}
+
+func (e *invalidClusterCIDRErr) Unwrap() error {
+	return e.err
+}
+
+// BootstrapPhase returns the phase the allocator bootstrap is currently in.
+func (r *multiCIDRRangeAllocator) BootstrapPhase() BootstrapPhase {
+	phase, ok := r.bootstrapPhase.Load().(BootstrapPhase)
+	if !ok {
+		return BootstrapPhasePending
+	}
+	return phase
+}
+
+func (r *multiCIDRRangeAllocator) setBootstrapPhase(logger klog.Logger, phase BootstrapPhase) {
+	logger.Info("Multi CIDR Range allocator bootstrap phase changed", "phase", phase)
+	r.bootstrapPhase.Store(phase)
+}
+
+// bootstrap rebuilds the allocator state from the informer caches. It requires
+// the Node and ClusterCIDR informers to be synced and blocks until every valid
+// ClusterCIDR is loaded and every existing podCIDR is occupied.
+func (r *multiCIDRRangeAllocator) bootstrap(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+
+	r.setBootstrapPhase(logger, BootstrapPhaseLoadingClusterCIDRs)
+	if err := r.loadClusterCIDRs(ctx); err != nil {
+		return fmt.Errorf("failed to load ClusterCIDRs: %w", err)
+	}
+
+	r.setBootstrapPhase(logger, BootstrapPhaseOccupyingNodeCIDRs)
+	if err := r.occupyExistingNodes(ctx); err != nil {
+		return fmt.Errorf("failed to occupy existing node CIDRs: %w", err)
+	}
+	if err := r.occupyUnmanagedNodes(ctx); err != nil {
+		return fmt.Errorf("failed to occupy unmanaged node CIDRs: %w", err)
+	}
+
+	r.setBootstrapPhase(logger, BootstrapPhaseComplete)
+	return nil
+}
+
+// loadClusterCIDRs regenerates the cidrMap from the ClusterCIDRs in the informer
+// cache and creates the default ClusterCIDR if it is configured. ClusterCIDRs
+// that fail because of API errors are retried until they succeed or ctx is
+// cancelled, invalid ClusterCIDRs are reported with an event and skipped.
+func (r *multiCIDRRangeAllocator) loadClusterCIDRs(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+
+	clusterCIDRs, err := r.clusterCIDRLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	ccList := &v1.ClusterCIDRList{}
+	for _, clusterCIDR := range clusterCIDRs {
+		// The informer handlers may not have seen the ClusterCIDRs yet.
+		r.clusterCIDROwners.update(clusterCIDR)
+		if !r.ownsClusterCIDR(clusterCIDR) {
+			logger.V(2).Info("Skipping ClusterCIDR of another controller", "clusterCIDR", klog.KObj(clusterCIDR), "controllerName", clusterCIDR.Spec.ControllerName)
+			continue
+		}
+		ccList.Items = append(ccList.Items, *clusterCIDR.DeepCopy())
+	}
+	createDefaultClusterCIDR(logger, ccList, r.allocatorParams)
+
+	pending := ccList.Items
+	err = wait.PollUntilContextCancel(ctx, bootstrapRetryInterval, true, func(ctx context.Context) (bool, error) {
+		var failed []v1.ClusterCIDR
+		for i := range pending {
+			clusterCIDR := &pending[i]
+			logger.Info("Regenerating existing ClusterCIDR", "clusterCIDR", klog.KObj(clusterCIDR))
+			err := r.reconcileBootstrap(ctx, clusterCIDR)
+			if err == nil {
+				continue
+			}
+
+			var invalidErr *invalidClusterCIDRErr
+			if errors.As(err, &invalidErr) {
+				logger.Error(err, "Skipping invalid ClusterCIDR")
+				r.recorder.Event(clusterCIDR, corev1.EventTypeWarning, "InvalidClusterCIDR encountered while regenerating ClusterCIDR during bootstrap.", err.Error())
+				continue
+			}
+
+			logger.Error(err, "Error while regenerating existing ClusterCIDR, will retry", "clusterCIDR", klog.KObj(clusterCIDR))
+			failed = append(failed, *clusterCIDR)
+		}
+
+		pending = failed
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.allocatorParams.ServiceCIDR != nil {
+		r.filterOutServiceRange(logger, r.allocatorParams.ServiceCIDR, r.cidrMap)
+	} else {
+		logger.Info("No Service CIDR provided. Skipping filtering out service addresses")
+	}
+
+	if r.allocatorParams.SecondaryServiceCIDR != nil {
+		r.filterOutServiceRange(logger, r.allocatorParams.SecondaryServiceCIDR, r.cidrMap)
+	} else {
+		logger.Info("No Secondary Service CIDR provided. Skipping filtering out secondary service addresses")
+	}
+
+	return nil
+}
+
+// occupyExistingNodes marks the podCIDRs of all the nodes in the informer cache
+// as used. The nodes whose podCIDRs did not change since the allocator
+// snapshot are occupied in the ClusterCIDR it records, the others are matched
+// against the ClusterCIDRs.
+func (r *multiCIDRRangeAllocator) occupyExistingNodes(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+	nodes, err := r.nodeLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	snapshot := r.loadSnapshot(ctx)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	restored, rebuilt := 0, 0
+	defer func() {
+		bootstrapNodes.WithLabelValues("snapshot").Set(float64(restored))
+		bootstrapNodes.WithLabelValues("rebuild").Set(float64(rebuilt))
+		if snapshot != nil {
+			logger.Info("Occupied the existing node CIDRs", "fromSnapshot", restored, "rebuilt", rebuilt)
+		}
+	}()
+
+	for _, node := range nodes {
+		if len(node.Spec.PodCIDRs) == 0 {
+			if _, ok := node.Annotations[AllocationIntentAnnotationKey]; !ok {
+				logger.V(4).Info("Node has no CIDR, ignoring", "node", klog.KObj(node))
+				continue
+			}
+			// The CIDRs of an unresolved allocation intent may be in use, they
+			// stay reserved until the node is synced and the intent resolved.
+			if _, _, err := r.occupyIntent(logger, node, r.cidrMap); err != nil {
+				logger.Info("Could not occupy the allocation intent of node, skipping", "node", klog.KObj(node), "error", err)
+			}
+			continue
+		}
+		if entry, ok := snapshot[node.Name]; ok && r.occupySnapshotEntry(node, entry) {
+			logger.V(4).Info("Node CIDR restored from the allocator snapshot", "node", klog.KObj(node), "podCIDRs", node.Spec.PodCIDRs)
+			restored++
+			continue
+		}
+		rebuilt++
+		logger.Info("Node has CIDR, occupying it in CIDR map", "node", klog.KObj(node), "podCIDRs", node.Spec.PodCIDRs)
+		if _, err := r.occupyCIDRs(logger, node, r.cidrMap); err != nil {
+			// This will happen if:
+			// 1. We find garbage in the podCIDRs field. Retrying is useless.
+			// 2. CIDR out of range: This means ClusterCIDR is not yet created
+			//    or the node is not managed by this IPAM controller
+			// This error will be information only, see https://github.com/kubernetes-sigs/node-ipam-controller/issues/27
+			logger.Info("Node CIDR has no associated ClusterCIDR, skipping", "node", klog.KObj(node), "error", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+	utilnet "k8s.io/utils/net"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+	clustercidrfake "sigs.k8s.io/node-ipam-controller/pkg/client/clientset/versioned/fake"
+	clustercidrinformer "sigs.k8s.io/node-ipam-controller/pkg/client/informers/externalversions"
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+// newBootstrapTestAllocator returns an allocator whose informer caches contain
+// the given nodes and ClusterCIDRs.
+func newBootstrapTestAllocator(t *testing.T, ctx context.Context, nodes []*corev1.Node, clusterCIDRs ...*v1.ClusterCIDR) *multiCIDRRangeAllocator {
+	t.Helper()
+
+	fakeNodeHandler := &test.FakeNodeHandler{
+		Existing:  nodes,
+		Clientset: fake.NewClientset(),
+	}
+
+	objects := make([]runtime.Object, 0, len(clusterCIDRs))
+	for _, clusterCIDR := range clusterCIDRs {
+		objects = append(objects, clusterCIDR)
+	}
+	cidrClient := clustercidrfake.NewSimpleClientset(objects...) //nolint:staticcheck // see https://github.com/kubernetes/kubernetes/issues/126850
+	informerFactory := clustercidrinformer.NewSharedInformerFactory(cidrClient, NoResyncPeriodFunc())
+	clusterCIDRInformer := informerFactory.Networking().V1().ClusterCIDRs()
+	for _, clusterCIDR := range clusterCIDRs {
+		require.NoError(t, clusterCIDRInformer.Informer().GetStore().Add(clusterCIDR))
+	}
+
+	allocator, err := NewMultiCIDRRangeAllocator(ctx, fakeNodeHandler, cidrClient.NetworkingV1().ClusterCIDRs(), test.FakeNodeInformer(fakeNodeHandler), clusterCIDRInformer, CIDRAllocatorParams{}, nil)
+	require.NoError(t, err)
+
+	ra := allocator.(*multiCIDRRangeAllocator)
+	ra.recorder = &record.FakeRecorder{}
+	return ra
+}
+
+func TestBootstrap(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	validCC := makeSyncedClusterCIDR("valid-cc", "10.10.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	invalidCC := makeClusterCIDR("invalid-cc", "", "", 8, nil)
+	invalidCC.Generation = 1
+
+	allocatedNode := makeAllocatedNode("allocated-node", map[string]string{"pool": "a"}, "10.10.3.0/24")
+	newNode := makeNode("new-node", map[string]string{"pool": "a"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{allocatedNode, newNode}, validCC, invalidCC)
+	assert.Equal(t, BootstrapPhasePending, ra.BootstrapPhase())
+
+	require.NoError(t, ra.bootstrap(ctx))
+	assert.Equal(t, BootstrapPhaseComplete, ra.BootstrapPhase())
+
+	// The invalid ClusterCIDR must not block the bootstrap.
+	require.Len(t, ra.cidrMap, 1)
+	for _, clusterCIDRs := range ra.cidrMap {
+		require.Len(t, clusterCIDRs, 1)
+		clusterCIDR := clusterCIDRs[0]
+		assert.Equal(t, "valid-cc", clusterCIDR.Name)
+		assert.Equal(t, map[string]bool{"allocated-node": true}, clusterCIDR.AssociatedNodes)
+
+		_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.3.0/24")
+		assert.True(t, clusterCIDR.IPv4CIDRSet.CIDRAllocated(podCIDR))
+	}
+
+	updated, err := ra.networkClient.Get(ctx, "valid-cc", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, updated.Finalizers, clusterCIDRFinalizer)
+}
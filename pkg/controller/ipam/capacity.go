@@ -0,0 +1,224 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// CapacityReport is the response of the /debug/ipam/capacity endpoint. It
+// answers how many more nodes with the given labels can be assigned podCIDRs.
+type CapacityReport struct {
+	Labels map[string]string `json:"labels"`
+	// ClusterCIDRs are the ClusterCIDRs new nodes with the labels would be
+	// allocated from, in the order they are tried.
+	ClusterCIDRs []ClusterCIDRCapacity `json:"clusterCIDRs"`
+	// AllocatableNodes is the number of nodes that can still be assigned podCIDRs.
+	AllocatableNodes int `json:"allocatableNodes"`
+	// IPv4Nodes and IPv6Nodes are the number of those nodes that would get a
+	// podCIDR of the family.
+	IPv4Nodes int `json:"ipv4Nodes"`
+	IPv6Nodes int `json:"ipv6Nodes"`
+}
+
+// ClusterCIDRCapacity is the remaining capacity of a ClusterCIDR.
+type ClusterCIDRCapacity struct {
+	Name         string           `json:"name"`
+	NodeSelector string           `json:"nodeSelector"`
+	IPv4         *CIDRSetCapacity `json:"ipv4,omitempty"`
+	IPv6         *CIDRSetCapacity `json:"ipv6,omitempty"`
+	// AllocatableNodes is the number of nodes that can still be allocated
+	// from the ClusterCIDR. A dual-stack node needs a podCIDR of each family,
+	// so it is the smallest free count of the families.
+	AllocatableNodes int `json:"allocatableNodes"`
+}
+
+// CIDRSetCapacity is the remaining capacity of the CIDR range of a family.
+type CIDRSetCapacity struct {
+	CIDR         string `json:"cidr"`
+	NodeMaskSize int    `json:"nodeMaskSize"`
+	MaxCIDRs     int    `json:"maxCIDRs"`
+	FreeCIDRs    int    `json:"freeCIDRs"`
+	// QuarantinedCIDRs are released CIDRs waiting for the reuse cooldown of
+	// the ClusterCIDR, they are not counted as free.
+	QuarantinedCIDRs int `json:"quarantinedCIDRs,omitempty"`
+}
+
+func (r *multiCIDRRangeAllocator) handleDebugCapacity(w http.ResponseWriter, req *http.Request) {
+	nodeLabels, err := labels.ConvertSelectorToLabelsMap(req.URL.Query().Get("labels"))
+	if err != nil {
+		writeDebugError(w, http.StatusBadRequest, fmt.Errorf("invalid labels: %w", err))
+		return
+	}
+
+	report, err := r.capacity(nodeLabels)
+	if err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeDebugJSON(w, http.StatusOK, report)
+}
+
+// capacity returns the ClusterCIDRs a new node with the labels would be
+// allocated from and how many such nodes can still be allocated. The
+// allocator state is only read.
+func (r *multiCIDRRangeAllocator) capacity(nodeLabels labels.Set) (*CapacityReport, error) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Labels: nodeLabels},
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	matching, err := r.orderedMatchingClusterCIDRs(node, true, r.cidrMap)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CapacityReport{
+		Labels:       nodeLabels,
+		ClusterCIDRs: make([]ClusterCIDRCapacity, 0, len(matching)),
+	}
+	total := nodeCapacity{perFamily: r.allocatorParams.PerFamilyClusterCIDRs}
+	for _, clusterCIDR := range matching {
+		capacity := clusterCIDRCapacity(clusterCIDR)
+		capacity.NodeSelector, _ = r.clusterCIDRSelectorKey(clusterCIDR)
+		report.ClusterCIDRs = append(report.ClusterCIDRs, capacity)
+		total.add(clusterCIDR, capacity)
+	}
+	report.AllocatableNodes, report.IPv4Nodes, report.IPv6Nodes = total.nodes(nil)
+
+	return report, nil
+}
+
+// nodeCapacity sums the capacity of the ClusterCIDRs a node may be allocated
+// from into a number of nodes.
+type nodeCapacity struct {
+	// perFamily is set with per-family selection, where the IPv4 and IPv6
+	// podCIDRs of a node may come from different ClusterCIDRs.
+	perFamily bool
+	// allocatableNodes, ipv4Nodes and ipv6Nodes sum the nodes allocatable
+	// from each ClusterCIDR, without per-family selection.
+	allocatableNodes, ipv4Nodes, ipv6Nodes int
+	// ipv4Free and ipv6Free sum the free CIDRs of each family, with
+	// per-family selection. hasIPv4 and hasIPv6 are set if any ClusterCIDR
+	// has a range of the family, the nodes then need a podCIDR of it.
+	ipv4Free, ipv6Free int
+	hasIPv4, hasIPv6   bool
+}
+
+func (c *nodeCapacity) add(clusterCIDR *cidrset.ClusterCIDR, capacity ClusterCIDRCapacity) {
+	if !c.perFamily {
+		c.allocatableNodes += capacity.AllocatableNodes
+		if capacity.IPv4 != nil {
+			c.ipv4Nodes += capacity.AllocatableNodes
+		}
+		if capacity.IPv6 != nil {
+			c.ipv6Nodes += capacity.AllocatableNodes
+		}
+		return
+	}
+
+	c.hasIPv4 = c.hasIPv4 || capacity.IPv4 != nil
+	c.hasIPv6 = c.hasIPv6 || capacity.IPv6 != nil
+	if pairsFamilies(clusterCIDR) {
+		// The CIDRs of both families are allocated together.
+		c.ipv4Free += capacity.AllocatableNodes
+		c.ipv6Free += capacity.AllocatableNodes
+		return
+	}
+	if capacity.IPv4 != nil {
+		c.ipv4Free += capacity.IPv4.FreeCIDRs
+	}
+	if capacity.IPv6 != nil {
+		c.ipv6Free += capacity.IPv6.FreeCIDRs
+	}
+}
+
+// nodes returns the number of nodes that can still be assigned podCIDRs and
+// how many of them get a podCIDR of each family. With per-family selection, a
+// node gets a podCIDR of every family of the ClusterCIDRs, so the number is
+// the smallest free count of the families. The families none of the
+// ClusterCIDRs has are taken from fallback, if set.
+func (c *nodeCapacity) nodes(fallback *nodeCapacity) (allocatable, ipv4Nodes, ipv6Nodes int) {
+	if !c.perFamily {
+		return c.allocatableNodes, c.ipv4Nodes, c.ipv6Nodes
+	}
+
+	hasIPv4, ipv4Free := c.hasIPv4, c.ipv4Free
+	hasIPv6, ipv6Free := c.hasIPv6, c.ipv6Free
+	if fallback != nil && !hasIPv4 {
+		hasIPv4, ipv4Free = fallback.hasIPv4, fallback.ipv4Free
+	}
+	if fallback != nil && !hasIPv6 {
+		hasIPv6, ipv6Free = fallback.hasIPv6, fallback.ipv6Free
+	}
+
+	switch {
+	case hasIPv4 && hasIPv6:
+		allocatable = min(ipv4Free, ipv6Free)
+	case hasIPv4:
+		allocatable = ipv4Free
+	case hasIPv6:
+		allocatable = ipv6Free
+	}
+	if hasIPv4 {
+		ipv4Nodes = allocatable
+	}
+	if hasIPv6 {
+		ipv6Nodes = allocatable
+	}
+	return allocatable, ipv4Nodes, ipv6Nodes
+}
+
+func clusterCIDRCapacity(clusterCIDR *cidrset.ClusterCIDR) ClusterCIDRCapacity {
+	capacity := ClusterCIDRCapacity{
+		Name: clusterCIDR.Name,
+		IPv4: cidrSetCapacity(clusterCIDR.IPv4CIDRSet),
+		IPv6: cidrSetCapacity(clusterCIDR.IPv6CIDRSet),
+	}
+	switch {
+	case capacity.IPv4 != nil && capacity.IPv6 != nil:
+		capacity.AllocatableNodes = min(capacity.IPv4.FreeCIDRs, capacity.IPv6.FreeCIDRs)
+	case capacity.IPv4 != nil:
+		capacity.AllocatableNodes = capacity.IPv4.FreeCIDRs
+	case capacity.IPv6 != nil:
+		capacity.AllocatableNodes = capacity.IPv6.FreeCIDRs
+	}
+	return capacity
+}
+
+func cidrSetCapacity(cidrSet *cidrset.MultiCIDRSet) *CIDRSetCapacity {
+	if cidrSet == nil {
+		return nil
+	}
+	quarantined := cidrSet.QuarantinedCount()
+	return &CIDRSetCapacity{
+		CIDR:             cidrSet.Label,
+		NodeMaskSize:     cidrSet.NodeMaskSize,
+		MaxCIDRs:         cidrSet.MaxCIDRs,
+		FreeCIDRs:        max(cidrSet.MaxCIDRs-cidrSet.AllocatedCount()-quarantined, 0),
+		QuarantinedCIDRs: quarantined,
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CapacityConfigMapKey is the key of the capacity ConfigMap holding the
+	// CapacitySummary as JSON.
+	CapacityConfigMapKey = "capacity.json"
+	// DefaultCapacityConfigMapNamespace is the default namespace of the
+	// capacity ConfigMap.
+	DefaultCapacityConfigMapNamespace = "kube-system"
+	// capacityPublishInterval is the minimum interval between two updates of
+	// the capacity ConfigMap, allocations and releases in between are coalesced.
+	capacityPublishInterval = time.Second
+	// capacityPublishRetryPeriod is how long to wait before retrying a failed
+	// update of the capacity ConfigMap.
+	capacityPublishRetryPeriod = 10 * time.Second
+)
+
+// CapacitySummary is the content of the capacity ConfigMap.
+type CapacitySummary struct {
+	// NodeSelectors lists the remaining capacity of every node selector of the
+	// ClusterCIDRs, sorted by node selector.
+	NodeSelectors []NodeSelectorCapacity `json:"nodeSelectors"`
+}
+
+// NodeSelectorCapacity is the remaining capacity of the ClusterCIDRs sharing a
+// node selector. Nodes matching the selector may also be allocated from the
+// ClusterCIDRs of less specific selectors, which are listed separately. With
+// per-family selection, the capacity of the families the ClusterCIDRs lack is
+// taken from the catch-all ClusterCIDRs.
+type NodeSelectorCapacity struct {
+	NodeSelector string `json:"nodeSelector"`
+	// ClusterCIDRs are the ClusterCIDRs with the node selector that are not
+	// terminating.
+	ClusterCIDRs []string `json:"clusterCIDRs"`
+	// AllocatableNodes is the number of nodes that can still be assigned
+	// podCIDRs from the ClusterCIDRs.
+	AllocatableNodes int `json:"allocatableNodes"`
+	// IPv4Nodes and IPv6Nodes are the number of those nodes that would get a
+	// podCIDR of the family.
+	IPv4Nodes int `json:"ipv4Nodes"`
+	IPv6Nodes int `json:"ipv6Nodes"`
+}
+
+// capacityChanged requests an update of the capacity ConfigMap. It does not
+// block and is a no-op if the ConfigMap is not published.
+func (r *multiCIDRRangeAllocator) capacityChanged() {
+	select {
+	case r.capacityUpdates <- struct{}{}:
+	default:
+	}
+}
+
+// runCapacityPublisher keeps the capacity ConfigMap up to date until the
+// context is cancelled.
+func (r *multiCIDRRangeAllocator) runCapacityPublisher(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.capacityUpdates:
+		}
+		if r.standby.Load() {
+			// The leader publishes the capacity, Promote requests an update.
+			continue
+		}
+
+		wait := capacityPublishInterval
+		if err := r.publishCapacity(ctx); err != nil {
+			logger.Error(err, "Failed to publish the remaining capacity, retrying",
+				"configMap", klog.KRef(r.allocatorParams.CapacityConfigMapNamespace, r.allocatorParams.CapacityConfigMapName))
+			r.capacityChanged()
+			wait = capacityPublishRetryPeriod
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// publishCapacity writes the remaining capacity of every node selector to the
+// capacity ConfigMap, creating it if needed.
+func (r *multiCIDRRangeAllocator) publishCapacity(ctx context.Context) error {
+	summary, err := json.Marshal(r.capacitySummary())
+	if err != nil {
+		return fmt.Errorf("failed to marshal the capacity summary: %w", err)
+	}
+
+	namespace, name := r.allocatorParams.CapacityConfigMapNamespace, r.allocatorParams.CapacityConfigMapName
+	configMaps := r.client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string]string{CapacityConfigMapKey: string(summary)},
+		}
+		_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if configMap.Data[CapacityConfigMapKey] == string(summary) {
+		return nil
+	}
+
+	configMap = configMap.DeepCopy()
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[CapacityConfigMapKey] = string(summary)
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// capacitySummary returns the remaining capacity of every node selector, from
+// the same MultiCIDRSet counters as the usage metrics.
+func (r *multiCIDRRangeAllocator) capacitySummary() CapacitySummary {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	summary := CapacitySummary{
+		NodeSelectors: make([]NodeSelectorCapacity, 0, len(r.cidrMap)),
+	}
+	totals := make(map[string]*nodeCapacity, len(r.cidrMap))
+	for nodeSelector, clusterCIDRs := range r.cidrMap {
+		selectorCapacity := NodeSelectorCapacity{
+			NodeSelector: nodeSelector,
+			ClusterCIDRs: make([]string, 0, len(clusterCIDRs)),
+		}
+		total := &nodeCapacity{perFamily: r.allocatorParams.PerFamilyClusterCIDRs}
+		for _, clusterCIDR := range clusterCIDRs {
+			if clusterCIDR.Terminating {
+				continue
+			}
+			selectorCapacity.ClusterCIDRs = append(selectorCapacity.ClusterCIDRs, clusterCIDR.Name)
+			total.add(clusterCIDR, clusterCIDRCapacity(clusterCIDR))
+		}
+		slices.Sort(selectorCapacity.ClusterCIDRs)
+		summary.NodeSelectors = append(summary.NodeSelectors, selectorCapacity)
+		totals[nodeSelector] = total
+	}
+
+	// With per-family selection, the nodes of a selector get the podCIDRs of
+	// the families its ClusterCIDRs lack from the catch-all ClusterCIDRs,
+	// which select every node.
+	var catchAll *nodeCapacity
+	if defaultSelector, err := nodeSelectorAsSelector(defaultNodeSelector()); err == nil {
+		catchAll = totals[defaultSelector.String()]
+	}
+	for i := range summary.NodeSelectors {
+		selectorCapacity := &summary.NodeSelectors[i]
+		selectorCapacity.AllocatableNodes, selectorCapacity.IPv4Nodes, selectorCapacity.IPv6Nodes = totals[selectorCapacity.NodeSelector].nodes(catchAll)
+	}
+	slices.SortFunc(summary.NodeSelectors, func(a, b NodeSelectorCapacity) int {
+		return strings.Compare(a.NodeSelector, b.NodeSelector)
+	})
+
+	return summary
+}
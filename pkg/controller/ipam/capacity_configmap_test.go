@@ -0,0 +1,84 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+func TestPublishCapacity(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	poolA := makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})
+	clusterCIDRs := []*v1.ClusterCIDR{
+		// 16 IPv4 and 4 IPv6 podCIDRs.
+		makeSyncedClusterCIDR("dual", "10.0.0.0/24", "fd00::/122", 4, poolA),
+		makeSyncedClusterCIDR("single", "10.1.0.0/28", "", 4, poolA),
+		makeSyncedClusterCIDR("pool-b", "10.2.0.0/24", "", 4, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"b"})),
+	}
+	node := makeAllocatedNode("node", map[string]string{"pool": "a"}, "10.0.0.0/28", "fd00::/124")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDRs...)
+	ra.allocatorParams.CapacityConfigMapNamespace = "kube-system"
+	ra.allocatorParams.CapacityConfigMapName = "node-ipam-capacity"
+	ra.capacityUpdates = make(chan struct{}, 1)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// The bootstrap changed the capacity.
+	assert.Len(t, ra.capacityUpdates, 1)
+	<-ra.capacityUpdates
+	require.NoError(t, ra.publishCapacity(ctx))
+	summary := publishedCapacity(ctx, t, ra)
+	require.Len(t, summary.NodeSelectors, 2)
+	assert.Equal(t, NodeSelectorCapacity{
+		NodeSelector:     summary.NodeSelectors[0].NodeSelector,
+		ClusterCIDRs:     []string{"dual", "single"},
+		AllocatableNodes: 4,
+		IPv4Nodes:        4,
+		IPv6Nodes:        3,
+	}, summary.NodeSelectors[0])
+	assert.Equal(t, []string{"pool-b"}, summary.NodeSelectors[1].ClusterCIDRs)
+	assert.Equal(t, 16, summary.NodeSelectors[1].AllocatableNodes)
+
+	// Releasing a podCIDR requests an update.
+	require.NoError(t, ra.ReleaseCIDR(ctx, node))
+	assert.Len(t, ra.capacityUpdates, 1)
+	require.NoError(t, ra.publishCapacity(ctx))
+	summary = publishedCapacity(ctx, t, ra)
+	assert.Equal(t, 5, summary.NodeSelectors[0].AllocatableNodes)
+	assert.Equal(t, 4, summary.NodeSelectors[0].IPv6Nodes)
+}
+
+func publishedCapacity(ctx context.Context, t *testing.T, ra *multiCIDRRangeAllocator) CapacitySummary {
+	t.Helper()
+
+	configMap, err := ra.client.CoreV1().ConfigMaps("kube-system").Get(ctx, "node-ipam-capacity", metav1.GetOptions{})
+	require.NoError(t, err)
+	var summary CapacitySummary
+	require.NoError(t, json.Unmarshal([]byte(configMap.Data[CapacityConfigMapKey]), &summary))
+	return summary
+}
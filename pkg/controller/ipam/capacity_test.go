@@ -0,0 +1,156 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+func TestCapacity(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	poolA := makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"})
+	clusterCIDRs := []*v1.ClusterCIDR{
+		// 16 IPv4 and 4 IPv6 podCIDRs.
+		makeSyncedClusterCIDR("dual", "10.0.0.0/24", "fd00::/122", 4, poolA),
+		// A single podCIDR.
+		makeSyncedClusterCIDR("single", "10.1.0.0/24", "", 8, poolA),
+		makeSyncedClusterCIDR("terminating", "10.2.0.0/24", "", 4, poolA),
+		makeSyncedClusterCIDR("other", "10.3.0.0/24", "", 4, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"b"})),
+	}
+	node := makeAllocatedNode("node", map[string]string{"pool": "a"}, "10.0.0.0/28", "fd00::/124")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDRs...)
+	require.NoError(t, ra.bootstrap(ctx))
+	for _, clusterCIDRList := range ra.cidrMap {
+		for _, clusterCIDR := range clusterCIDRList {
+			if clusterCIDR.Name == "terminating" {
+				clusterCIDR.Terminating = true
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	ra.AddDebugHandlers(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/ipam/capacity?labels=pool%3Da,zone%3Dz1", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var report CapacityReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+
+	assert.Equal(t, map[string]string{"pool": "a", "zone": "z1"}, report.Labels)
+	require.Len(t, report.ClusterCIDRs, 2)
+	single, dual := report.ClusterCIDRs[0], report.ClusterCIDRs[1]
+	assert.Equal(t, "single", single.Name)
+	assert.Equal(t, 1, single.AllocatableNodes)
+	assert.Nil(t, single.IPv6)
+	assert.Equal(t, "dual", dual.Name)
+	assert.Equal(t, &CIDRSetCapacity{CIDR: "10.0.0.0/24", NodeMaskSize: 28, MaxCIDRs: 16, FreeCIDRs: 15}, dual.IPv4)
+	assert.Equal(t, &CIDRSetCapacity{CIDR: "fd00::/122", NodeMaskSize: 124, MaxCIDRs: 4, FreeCIDRs: 3}, dual.IPv6)
+	// Dual-stack nodes are limited by the IPv6 range.
+	assert.Equal(t, 3, dual.AllocatableNodes)
+	assert.Equal(t, 4, report.AllocatableNodes)
+	assert.Equal(t, 4, report.IPv4Nodes)
+	assert.Equal(t, 3, report.IPv6Nodes)
+
+	// The query does not allocate.
+	for _, clusterCIDRList := range ra.cidrMap {
+		for _, clusterCIDR := range clusterCIDRList {
+			if clusterCIDR.Name == "dual" {
+				assert.Equal(t, 1, clusterCIDR.IPv4CIDRSet.AllocatedCount())
+				assert.Equal(t, 1, clusterCIDR.IPv6CIDRSet.AllocatedCount())
+			}
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/ipam/capacity?labels=pool%3Dc", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Empty(t, report.ClusterCIDRs)
+	assert.Zero(t, report.AllocatableNodes)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/ipam/capacity?labels=pool%3D%3D%3D", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCapacityExcludesQuarantinedCIDRs(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cooldown", "10.0.0.0/24", "", 4, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	clusterCIDR.Spec.ReuseCooldownSeconds = 300
+	node := makeAllocatedNode("node", map[string]string{"pool": "a"}, "10.0.0.0/28")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+	require.NoError(t, ra.ReleaseCIDR(ctx, node))
+
+	report, err := ra.capacity(map[string]string{"pool": "a"})
+	require.NoError(t, err)
+	require.Len(t, report.ClusterCIDRs, 1)
+	assert.Equal(t, &CIDRSetCapacity{CIDR: "10.0.0.0/24", NodeMaskSize: 28, MaxCIDRs: 16, FreeCIDRs: 15, QuarantinedCIDRs: 1}, report.ClusterCIDRs[0].IPv4)
+	status := clusterCIDRByName("cooldown", ra.cidrMap).IPv4CIDRSet.Status()
+	assert.Equal(t, []string{"10.0.0.0/28"}, status.QuarantinedCIDRs)
+	assert.Equal(t, "5m0s", status.ReuseCooldown)
+}
+
+func TestCapacityPerFamily(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	// 256 IPv4 podCIDRs for the nodes of rack a, 4 IPv6 podCIDRs for all nodes.
+	nodes := []*corev1.Node{withClusterCIDRAnnotation(makeAllocatedNode("node", map[string]string{"rack": "a"}, "10.10.0.0/24", "fd00:10::/120"), "rack-a,global-v6")}
+	ra := newBootstrapTestAllocator(t, ctx, nodes, makePerFamilyClusterCIDRs("fd00:10::/118")...)
+	ra.allocatorParams.PerFamilyClusterCIDRs = true
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// The nodes of rack a are limited by the IPv6 range they share.
+	report, err := ra.capacity(map[string]string{"rack": "a"})
+	require.NoError(t, err)
+	require.Len(t, report.ClusterCIDRs, 2)
+	assert.Equal(t, 255, report.ClusterCIDRs[0].AllocatableNodes)
+	assert.Equal(t, 3, report.ClusterCIDRs[1].AllocatableNodes)
+	assert.Equal(t, 3, report.AllocatableNodes)
+	assert.Equal(t, 3, report.IPv4Nodes)
+	assert.Equal(t, 3, report.IPv6Nodes)
+
+	// The other nodes only get an IPv6 podCIDR.
+	report, err = ra.capacity(map[string]string{"rack": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.AllocatableNodes)
+	assert.Zero(t, report.IPv4Nodes)
+	assert.Equal(t, 3, report.IPv6Nodes)
+
+	rackSelector, err := nodeSelectorAsSelector(makeNodeSelector("rack", corev1.NodeSelectorOpIn, []string{"a"}))
+	require.NoError(t, err)
+	defaultSelector, err := nodeSelectorAsSelector(defaultNodeSelector())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []NodeSelectorCapacity{
+		{NodeSelector: rackSelector.String(), ClusterCIDRs: []string{"rack-a"}, AllocatableNodes: 3, IPv4Nodes: 3, IPv6Nodes: 3},
+		{NodeSelector: defaultSelector.String(), ClusterCIDRs: []string{"global-v6"}, AllocatableNodes: 3, IPv6Nodes: 3},
+	}, ra.capacitySummary().NodeSelectors)
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	netutil "k8s.io/utils/net"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// validateControllerName checks that the controller name is a domain-prefixed
+// path, like the controllerName of the ClusterCIDRs.
+func validateControllerName(controllerName string) error {
+	if errs := validation.IsDomainPrefixedPath(field.NewPath("controllerName"), controllerName); len(errs) > 0 {
+		return fmt.Errorf("invalid controller name: %w", errs.ToAggregate())
+	}
+	return nil
+}
+
+// clusterCIDRControllerName returns the name of the controller the ClusterCIDR
+// belongs to.
+func clusterCIDRControllerName(clusterCIDR *v1.ClusterCIDR) string {
+	if clusterCIDR.Spec.ControllerName == "" {
+		return v1.DefaultControllerName
+	}
+	return clusterCIDR.Spec.ControllerName
+}
+
+// ownsClusterCIDR returns whether the allocator loads, finalizes and allocates
+// from the ClusterCIDR.
+func (r *multiCIDRRangeAllocator) ownsClusterCIDR(clusterCIDR *v1.ClusterCIDR) bool {
+	return clusterCIDRControllerName(clusterCIDR) == r.allocatorParams.ControllerName
+}
+
+// clusterCIDROwner holds what ownsNode needs to know about a ClusterCIDR of
+// any controller, parsed once per change of the ClusterCIDR.
+type clusterCIDROwner struct {
+	controllerName string
+	// catchAll is set for the ClusterCIDRs of the default node selector.
+	catchAll bool
+	// requirements are the requirements of the node selector.
+	requirements labels.Requirements
+	// rank describes the CIDRs of the ClusterCIDR to order the ClusterCIDRs
+	// selecting a node like the allocator does, see PriorityQueue.
+	rank *PriorityQueueItem
+}
+
+// equal returns whether both owners select and rank the nodes the same way.
+func (o *clusterCIDROwner) equal(other *clusterCIDROwner) bool {
+	return o.controllerName == other.controllerName &&
+		o.rank.selectorString == other.rank.selectorString &&
+		sameRankingCIDRSet(o.rank.clusterCIDR.IPv4CIDRSet, other.rank.clusterCIDR.IPv4CIDRSet) &&
+		sameRankingCIDRSet(o.rank.clusterCIDR.IPv6CIDRSet, other.rank.clusterCIDR.IPv6CIDRSet)
+}
+
+func sameRankingCIDRSet(a, b *cidrset.MultiCIDRSet) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Label == b.Label && a.NodeMaskSize == b.NodeMaskSize
+}
+
+// matchCount returns whether the node matches the node selector of the
+// ClusterCIDR and the number of matching requirements, like matchCIDRLabels.
+func (o *clusterCIDROwner) matchCount(node *corev1.Node) (bool, int) {
+	matchCnt := 0
+	for _, req := range o.requirements {
+		if req.Matches(labels.Set(node.Labels)) {
+			matchCnt++
+		}
+	}
+	return matchCnt == len(o.requirements), matchCnt
+}
+
+// clusterCIDROwnerCache holds the clusterCIDROwner of all the ClusterCIDRs,
+// kept up to date by the ClusterCIDR informer.
+type clusterCIDROwnerCache struct {
+	// lock guards owners.
+	lock   sync.RWMutex
+	owners map[string]*clusterCIDROwner
+}
+
+func newClusterCIDROwnerCache() *clusterCIDROwnerCache {
+	return &clusterCIDROwnerCache{owners: make(map[string]*clusterCIDROwner)}
+}
+
+// update parses the ClusterCIDR. Invalid ClusterCIDRs are not loaded by their
+// controller and are left out. It returns whether the owners of the nodes may
+// have changed.
+func (c *clusterCIDROwnerCache) update(clusterCIDR *v1.ClusterCIDR) bool {
+	owner, err := newClusterCIDROwner(clusterCIDR)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, existed := c.owners[clusterCIDR.Name]
+	if err != nil {
+		delete(c.owners, clusterCIDR.Name)
+		return existed
+	}
+	c.owners[clusterCIDR.Name] = owner
+	return !existed || !old.equal(owner)
+}
+
+// remove drops the ClusterCIDR and returns whether it was known.
+func (c *clusterCIDROwnerCache) remove(name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, existed := c.owners[name]
+	delete(c.owners, name)
+	return existed
+}
+
+func (c *clusterCIDROwnerCache) get(name string) (*clusterCIDROwner, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	owner, ok := c.owners[name]
+	return owner, ok
+}
+
+func newClusterCIDROwner(clusterCIDR *v1.ClusterCIDR) (*clusterCIDROwner, error) {
+	nodeSelector := clusterCIDR.Spec.NodeSelector
+	if nodeSelector == nil {
+		nodeSelector = defaultNodeSelector()
+	}
+	selector, err := nodeSelectorAsSelector(nodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := selector.Requirements()
+
+	rank := &cidrset.ClusterCIDR{Name: clusterCIDR.Name}
+	if clusterCIDR.Spec.IPv4 != "" {
+		if rank.IPv4CIDRSet, err = rankingCIDRSet(clusterCIDR.Spec.IPv4, clusterCIDR.Spec.PerNodeHostBits); err != nil {
+			return nil, err
+		}
+	}
+	if clusterCIDR.Spec.IPv6 != "" {
+		if rank.IPv6CIDRSet, err = rankingCIDRSet(clusterCIDR.Spec.IPv6, clusterCIDR.Spec.PerNodeHostBits); err != nil {
+			return nil, err
+		}
+	}
+	if rank.IPv4CIDRSet == nil && rank.IPv6CIDRSet == nil {
+		return nil, fmt.Errorf("clusterCIDR %s has no CIDR", clusterCIDR.Name)
+	}
+
+	defaultSelector, err := nodeSelectorAsSelector(defaultNodeSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterCIDROwner{
+		controllerName: clusterCIDRControllerName(clusterCIDR),
+		catchAll:       selector.String() == defaultSelector.String(),
+		requirements:   requirements,
+		rank: &PriorityQueueItem{
+			clusterCIDR:    rank,
+			selectorString: selector.String(),
+		},
+	}, nil
+}
+
+// rankingCIDRSet returns a MultiCIDRSet with only the fields the ClusterCIDRs
+// are ranked by, it can not allocate.
+func rankingCIDRSet(cidr string, perNodeHostBits int32) (*cidrset.MultiCIDRSet, error) {
+	_, clusterCIDR, err := netutil.ParseCIDRSloppy(cidr)
+	if err != nil {
+		return nil, err
+	}
+	clusterMaskSize, bits := clusterCIDR.Mask.Size()
+	nodeMaskSize := bits - int(perNodeHostBits)
+	if nodeMaskSize < clusterMaskSize {
+		return nil, fmt.Errorf("per-node CIDRs of %d host bits do not fit in %s", perNodeHostBits, cidr)
+	}
+	maxCIDRs := math.MaxInt
+	if nodeMaskSize-clusterMaskSize < 62 {
+		maxCIDRs = 1 << (nodeMaskSize - clusterMaskSize)
+	}
+	return &cidrset.MultiCIDRSet{
+		ClusterCIDR:  clusterCIDR,
+		NodeMaskSize: nodeMaskSize,
+		MaxCIDRs:     maxCIDRs,
+		Label:        clusterCIDR.String(),
+	}, nil
+}
+
+// ownsNode returns whether the allocator manages the podCIDRs of the node when
+// several controllers share the cluster. A node belongs to the controller of
+// the ClusterCIDR recorded on it, otherwise to the controller of the first
+// ClusterCIDR selecting it with a node selector, in the order the allocator
+// ranks them, so that all the controllers agree on the owner even when
+// ClusterCIDRs of several controllers select the node. Catch-all ClusterCIDRs
+// come after those. Nodes no ClusterCIDR selects belong to the default
+// controller, which reports them as unassigned.
+func (r *multiCIDRRangeAllocator) ownsNode(node *corev1.Node) bool {
+	if value := node.Annotations[ClusterCIDRAnnotationKey]; value != "" {
+		// The podCIDRs of a node come from the ClusterCIDRs of a single
+		// controller.
+		if owner, ok := r.clusterCIDROwners.get(splitClusterCIDRNames(value)[0]); ok {
+			return owner.controllerName == r.allocatorParams.ControllerName
+		}
+	}
+
+	r.clusterCIDROwners.lock.RLock()
+	defer r.clusterCIDROwners.lock.RUnlock()
+
+	var specific PriorityQueue
+	var ownCatchAll, otherCatchAll bool
+	for _, owner := range r.clusterCIDROwners.owners {
+		matches, matchCnt := owner.matchCount(node)
+		if !matches {
+			continue
+		}
+
+		switch {
+		case !owner.catchAll:
+			item := *owner.rank
+			item.labelMatchCount = matchCnt
+			specific = append(specific, &item)
+		case owner.controllerName == r.allocatorParams.ControllerName:
+			ownCatchAll = true
+		default:
+			otherCatchAll = true
+		}
+	}
+
+	switch {
+	case len(specific) > 0:
+		heap.Init(&specific)
+		return r.clusterCIDROwners.owners[specific[0].clusterCIDR.Name].controllerName == r.allocatorParams.ControllerName
+	case ownCatchAll || otherCatchAll:
+		return ownCatchAll
+	default:
+		return r.allocatorParams.ControllerName == v1.DefaultControllerName
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+func TestControllerName(t *testing.T) {
+	const gpuController = "example.com/gpu-ipam"
+
+	gpuNode := makeNode("gpu-node", map[string]string{"pool": "gpu"})
+	generalNode := makeNode("general-node", map[string]string{"pool": "general"})
+	otherNode := makeNode("other-node", map[string]string{"pool": "other"})
+	// Allocated from the GPU ClusterCIDR before being relabeled.
+	relabeledNode := makeNode("relabeled-node", map[string]string{"pool": "general"})
+	relabeledNode.Annotations = map[string]string{ClusterCIDRAnnotationKey: "gpu"}
+
+	testCases := []struct {
+		name             string
+		controllerName   string
+		wantClusterCIDRs []string
+		wantOwnedNodes   []string
+	}{
+		{
+			name:             "default controller",
+			controllerName:   v1.DefaultControllerName,
+			wantClusterCIDRs: []string{"catch-all", "general"},
+			wantOwnedNodes:   []string{"general-node", "other-node"},
+		},
+		{
+			name:             "named controller",
+			controllerName:   gpuController,
+			wantClusterCIDRs: []string{"gpu"},
+			wantOwnedNodes:   []string{"gpu-node", "relabeled-node"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+
+			gpu := makeSyncedClusterCIDR("gpu", "10.1.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"gpu"}))
+			gpu.Spec.ControllerName = gpuController
+			general := makeSyncedClusterCIDR("general", "10.2.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"general"}))
+			catchAll := makeSyncedClusterCIDR("catch-all", "10.3.0.0/16", "", 8, nil)
+
+			ra := newBootstrapTestAllocator(t, ctx, nil, gpu, general, catchAll)
+			ra.allocatorParams.ControllerName = tc.controllerName
+			require.NoError(t, ra.bootstrap(ctx))
+
+			var loaded []string
+			for _, info := range ra.clusterCIDRsDebugInfo() {
+				loaded = append(loaded, info.Name)
+			}
+			assert.Equal(t, tc.wantClusterCIDRs, loaded)
+
+			var owned []string
+			for _, node := range []*corev1.Node{gpuNode, generalNode, otherNode, relabeledNode} {
+				if ra.ownsNode(node) {
+					owned = append(owned, node.Name)
+				}
+			}
+			assert.Equal(t, tc.wantOwnedNodes, owned)
+
+			// ClusterCIDRs of other controllers are not finalized.
+			for _, clusterCIDR := range []*v1.ClusterCIDR{gpu, general, catchAll} {
+				require.NoError(t, ra.syncClusterCIDR(ctx, clusterCIDR.Name))
+				updated, err := ra.networkClient.Get(ctx, clusterCIDR.Name, metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, slices.Contains(tc.wantClusterCIDRs, clusterCIDR.Name),
+					slices.Contains(updated.Finalizers, clusterCIDRFinalizer), clusterCIDR.Name)
+			}
+		})
+	}
+}
+
+func TestOwnsNodeRanking(t *testing.T) {
+	const gpuController = "example.com/gpu-ipam"
+
+	testCases := []struct {
+		name       string
+		nodeLabels map[string]string
+		wantOwned  bool
+	}{
+		{
+			// Both match one label, the GPU ClusterCIDR has fewer CIDRs.
+			name:       "fewer allocatable pod CIDRs",
+			nodeLabels: map[string]string{"pool": "a"},
+			wantOwned:  false,
+		},
+		{
+			name:       "more matching labels",
+			nodeLabels: map[string]string{"pool": "a", "zone": "1"},
+			wantOwned:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+
+			large := makeSyncedClusterCIDR("a-large", "10.1.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+			zonal := makeSyncedClusterCIDR("c-zonal", "10.3.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+			zonal.Spec.NodeSelector.NodeSelectorTerms[0].MatchExpressions = append(zonal.Spec.NodeSelector.NodeSelectorTerms[0].MatchExpressions,
+				corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"1"}})
+			small := makeSyncedClusterCIDR("b-small", "10.2.0.0/20", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+			small.Spec.ControllerName = gpuController
+
+			ra := newBootstrapTestAllocator(t, ctx, nil, large, small, zonal)
+			require.NoError(t, ra.bootstrap(ctx))
+
+			assert.Equal(t, tc.wantOwned, ra.ownsNode(makeNode("node", tc.nodeLabels)))
+		})
+	}
+}
+
+func TestValidateControllerName(t *testing.T) {
+	assert.NoError(t, validateControllerName(v1.DefaultControllerName))
+	assert.Error(t, validateControllerName("gpu-ipam"))
+}
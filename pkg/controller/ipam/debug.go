@@ -0,0 +1,280 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
+)
+
+// defaultFreeCIDRsLimit is the number of free CIDRs listed by the free debug
+// endpoint when no limit is requested.
+const defaultFreeCIDRsLimit = 256
+
+// clusterCIDRsDebugInfo is the response of the /debug/ipam/clustercidrs endpoint.
+type clusterCIDRsDebugInfo struct {
+	BootstrapPhase BootstrapPhase         `json:"bootstrapPhase"`
+	ClusterCIDRs   []clusterCIDRDebugInfo `json:"clusterCIDRs"`
+}
+
+// clusterCIDRDebugInfo describes the in-memory state of a ClusterCIDR.
+type clusterCIDRDebugInfo struct {
+	Name            string                      `json:"name"`
+	NodeSelector    string                      `json:"nodeSelector"`
+	Terminating     bool                        `json:"terminating"`
+	AssociatedNodes []string                    `json:"associatedNodes"`
+	IPv4            *cidrset.MultiCIDRSetStatus `json:"ipv4,omitempty"`
+	IPv6            *cidrset.MultiCIDRSetStatus `json:"ipv6,omitempty"`
+}
+
+// nodeDebugInfo is the response of the /debug/ipam/nodes/{name} endpoint.
+type nodeDebugInfo struct {
+	Name     string   `json:"name"`
+	PodCIDRs []string `json:"podCIDRs"`
+	// ClusterCIDRs lists the ClusterCIDR each of the PodCIDRs was allocated
+	// from, in the same order, if the node is associated with any.
+	ClusterCIDRs []string `json:"clusterCIDRs,omitempty"`
+	// MatchingClusterCIDRs lists the ClusterCIDRs matching the node, in the
+	// order they are considered for allocation.
+	MatchingClusterCIDRs []string `json:"matchingClusterCIDRs"`
+}
+
+// freeCIDRsDebugInfo is the response of the /debug/ipam/free endpoint.
+type freeCIDRsDebugInfo struct {
+	ClusterCIDR string                 `json:"clusterCIDR"`
+	IPv4        *freeCIDRsSetDebugInfo `json:"ipv4,omitempty"`
+	IPv6        *freeCIDRsSetDebugInfo `json:"ipv6,omitempty"`
+}
+
+// freeCIDRsSetDebugInfo lists the free CIDRs of a MultiCIDRSet.
+type freeCIDRsSetDebugInfo struct {
+	CIDR      string   `json:"cidr"`
+	FreeCount int      `json:"freeCount"`
+	FreeCIDRs []string `json:"freeCIDRs"`
+}
+
+// AddDebugHandlers registers the JSON endpoints that expose the in-memory
+// state of the allocator:
+//   - /debug/ipam/clustercidrs lists the ClusterCIDRs with their CIDR sets.
+//   - /debug/ipam/nodes/{name} shows the ClusterCIDRs a node matches and is associated with.
+//   - /debug/ipam/free?clustercidr=<name>[&limit=<n>] lists the free CIDRs of a ClusterCIDR.
+//   - /debug/ipam/decisions/{name} shows the last allocation decision of a node.
+//   - /debug/ipam/capacity?labels=<key>=<value>,... shows how many more nodes with the labels can be allocated.
+func (r *multiCIDRRangeAllocator) AddDebugHandlers(registry server.HandlerRegistry) {
+	registry.Handle("GET /debug/ipam/clustercidrs", http.HandlerFunc(r.handleDebugClusterCIDRs))
+	registry.Handle("GET /debug/ipam/nodes/{name}", http.HandlerFunc(r.handleDebugNode))
+	registry.Handle("GET /debug/ipam/free", http.HandlerFunc(r.handleDebugFree))
+	registry.Handle("GET /debug/ipam/decisions/{name}", http.HandlerFunc(r.handleDebugDecision))
+	registry.Handle("GET /debug/ipam/capacity", http.HandlerFunc(r.handleDebugCapacity))
+}
+
+func (r *multiCIDRRangeAllocator) handleDebugClusterCIDRs(w http.ResponseWriter, _ *http.Request) {
+	info := clusterCIDRsDebugInfo{
+		BootstrapPhase: r.BootstrapPhase(),
+		ClusterCIDRs:   r.clusterCIDRsDebugInfo(),
+	}
+	writeDebugJSON(w, http.StatusOK, info)
+}
+
+// clusterCIDRsDebugInfo returns a snapshot of the cidrMap sorted by ClusterCIDR name.
+func (r *multiCIDRRangeAllocator) clusterCIDRsDebugInfo() []clusterCIDRDebugInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	infos := make([]clusterCIDRDebugInfo, 0)
+	for selector, clusterCIDRs := range r.cidrMap {
+		for _, clusterCIDR := range clusterCIDRs {
+			infos = append(infos, debugInfoForClusterCIDR(selector, clusterCIDR))
+		}
+	}
+	slices.SortFunc(infos, func(a, b clusterCIDRDebugInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return infos
+}
+
+// debugInfoForClusterCIDR requires the caller to hold r.lock.
+func debugInfoForClusterCIDR(selector string, clusterCIDR *cidrset.ClusterCIDR) clusterCIDRDebugInfo {
+	info := clusterCIDRDebugInfo{
+		Name:            clusterCIDR.Name,
+		NodeSelector:    selector,
+		Terminating:     clusterCIDR.Terminating,
+		AssociatedNodes: make([]string, 0, len(clusterCIDR.AssociatedNodes)),
+	}
+	for node, associated := range clusterCIDR.AssociatedNodes {
+		if associated {
+			info.AssociatedNodes = append(info.AssociatedNodes, node)
+		}
+	}
+	slices.Sort(info.AssociatedNodes)
+
+	if clusterCIDR.IPv4CIDRSet != nil {
+		status := clusterCIDR.IPv4CIDRSet.Status()
+		info.IPv4 = &status
+	}
+	if clusterCIDR.IPv6CIDRSet != nil {
+		status := clusterCIDR.IPv6CIDRSet.Status()
+		info.IPv6 = &status
+	}
+
+	return info
+}
+
+func (r *multiCIDRRangeAllocator) handleDebugNode(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("name")
+	node, err := r.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		writeDebugError(w, http.StatusNotFound, fmt.Errorf("node %s not found", name))
+		return
+	}
+	if err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	info, err := r.nodeDebugInfo(node)
+	if err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeDebugJSON(w, http.StatusOK, info)
+}
+
+// nodeDebugInfo returns the ClusterCIDRs matching the node and the ones its
+// PodCIDRs were allocated from.
+func (r *multiCIDRRangeAllocator) nodeDebugInfo(node *corev1.Node) (*nodeDebugInfo, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	matching, err := r.orderedMatchingClusterCIDRs(node, false, r.cidrMap)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &nodeDebugInfo{
+		Name:                 node.Name,
+		PodCIDRs:             node.Spec.PodCIDRs,
+		MatchingClusterCIDRs: make([]string, 0, len(matching)),
+	}
+	for _, clusterCIDR := range matching {
+		info.MatchingClusterCIDRs = append(info.MatchingClusterCIDRs, clusterCIDR.Name)
+	}
+	// A node without PodCIDRs, or one not associated with a ClusterCIDR yet,
+	// reports none.
+	if allocated, err := r.allocatedClusterCIDRs(node, r.cidrMap); err == nil {
+		for _, clusterCIDR := range allocated {
+			info.ClusterCIDRs = append(info.ClusterCIDRs, clusterCIDR.Name)
+		}
+	}
+
+	return info, nil
+}
+
+func (r *multiCIDRRangeAllocator) handleDebugFree(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("clustercidr")
+	if name == "" {
+		writeDebugError(w, http.StatusBadRequest, errors.New("the clustercidr query parameter is required"))
+		return
+	}
+	limit := defaultFreeCIDRsLimit
+	if l := req.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			writeDebugError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", l))
+			return
+		}
+	}
+
+	info := r.freeCIDRsDebugInfo(name, limit)
+	if info == nil {
+		writeDebugError(w, http.StatusNotFound, fmt.Errorf("ClusterCIDR %s not found", name))
+		return
+	}
+	writeDebugJSON(w, http.StatusOK, info)
+}
+
+// freeCIDRsDebugInfo returns up to limit free CIDRs per IP family of the
+// ClusterCIDR with the given name, or nil if there is no such ClusterCIDR.
+func (r *multiCIDRRangeAllocator) freeCIDRsDebugInfo(name string, limit int) *freeCIDRsDebugInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, clusterCIDRs := range r.cidrMap {
+		for _, clusterCIDR := range clusterCIDRs {
+			if clusterCIDR.Name == name {
+				return &freeCIDRsDebugInfo{
+					ClusterCIDR: name,
+					IPv4:        freeCIDRsForSet(clusterCIDR.IPv4CIDRSet, limit),
+					IPv6:        freeCIDRsForSet(clusterCIDR.IPv6CIDRSet, limit),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func freeCIDRsForSet(cidrSet *cidrset.MultiCIDRSet, limit int) *freeCIDRsSetDebugInfo {
+	if cidrSet == nil {
+		return nil
+	}
+	free, count := cidrSet.FreeCIDRs(limit)
+	return &freeCIDRsSetDebugInfo{
+		CIDR:      cidrSet.Label,
+		FreeCount: count,
+		FreeCIDRs: free,
+	}
+}
+
+func (r *multiCIDRRangeAllocator) handleDebugDecision(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("name")
+	decision, ok := r.decisions.get(name)
+	if !ok {
+		writeDebugError(w, http.StatusNotFound, fmt.Errorf("no allocation decision recorded for node %s", name))
+		return
+	}
+	writeDebugJSON(w, http.StatusOK, decision)
+}
+
+func writeDebugJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(body); err != nil {
+		klog.ErrorS(err, "Failed to write debug response")
+	}
+}
+
+func writeDebugError(w http.ResponseWriter, status int, err error) {
+	writeDebugJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestDebugHandlers(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("pool-a", "10.10.0.0/30", "", 0, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	node := makeAllocatedNode("node-a", map[string]string{"pool": "a"}, "10.10.0.1/32")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	mux := http.NewServeMux()
+	ra.AddDebugHandlers(mux)
+
+	get := func(path string, into any) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if into != nil {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), into))
+		}
+		return rec.Code
+	}
+
+	var clusterCIDRs clusterCIDRsDebugInfo
+	require.Equal(t, http.StatusOK, get("/debug/ipam/clustercidrs", &clusterCIDRs))
+	assert.Equal(t, BootstrapPhaseComplete, clusterCIDRs.BootstrapPhase)
+	require.Len(t, clusterCIDRs.ClusterCIDRs, 1)
+	assert.Equal(t, "pool-a", clusterCIDRs.ClusterCIDRs[0].Name)
+	assert.Equal(t, []string{"node-a"}, clusterCIDRs.ClusterCIDRs[0].AssociatedNodes)
+	require.NotNil(t, clusterCIDRs.ClusterCIDRs[0].IPv4)
+	assert.Equal(t, []string{"10.10.0.1/32"}, clusterCIDRs.ClusterCIDRs[0].IPv4.AllocatedCIDRs)
+	assert.Nil(t, clusterCIDRs.ClusterCIDRs[0].IPv6)
+
+	var nodeInfo nodeDebugInfo
+	require.Equal(t, http.StatusOK, get("/debug/ipam/nodes/node-a", &nodeInfo))
+	assert.Equal(t, []string{"pool-a"}, nodeInfo.ClusterCIDRs)
+	assert.Equal(t, []string{"pool-a"}, nodeInfo.MatchingClusterCIDRs)
+	assert.Equal(t, http.StatusNotFound, get("/debug/ipam/nodes/missing", nil))
+
+	var free freeCIDRsDebugInfo
+	require.Equal(t, http.StatusOK, get("/debug/ipam/free?clustercidr=pool-a&limit=2", &free))
+	require.NotNil(t, free.IPv4)
+	assert.Equal(t, 3, free.IPv4.FreeCount)
+	assert.Equal(t, []string{"10.10.0.0/32", "10.10.0.2/32"}, free.IPv4.FreeCIDRs)
+	assert.Equal(t, http.StatusBadRequest, get("/debug/ipam/free", nil))
+	assert.Equal(t, http.StatusBadRequest, get("/debug/ipam/free?clustercidr=pool-a&limit=x", nil))
+	assert.Equal(t, http.StatusNotFound, get("/debug/ipam/free?clustercidr=missing", nil))
+}
+
+func TestDebugNodePerFamily(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	nodes := []*corev1.Node{withClusterCIDRAnnotation(makeAllocatedNode("node", map[string]string{"rack": "a"}, "10.10.1.0/24", "fd00:10::100/120"), "rack-a,global-v6")}
+	ra := newBootstrapTestAllocator(t, ctx, nodes, makePerFamilyClusterCIDRs("fd00:10::/112")...)
+	ra.allocatorParams.PerFamilyClusterCIDRs = true
+	require.NoError(t, ra.bootstrap(ctx))
+
+	info, err := ra.nodeDebugInfo(nodes[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rack-a", "global-v6"}, info.ClusterCIDRs)
+}
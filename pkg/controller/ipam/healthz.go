@@ -0,0 +1,121 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
+)
+
+// workerStuckTimeout is how long a worker may process a single queue item
+// before the allocator is reported as not live. It is well above the time a
+// node patch with all its retries takes.
+const workerStuckTimeout = 2 * time.Minute
+
+// workerMonitor keeps track of the queue items that are being processed by
+// the workers, so that wedged workers can be detected.
+type workerMonitor struct {
+	clock clock.PassiveClock
+	// lock guards inFlight.
+	lock sync.Mutex
+	// inFlight maps the queue items that are being processed to the time
+	// their processing started.
+	inFlight map[string]time.Time
+}
+
+func newWorkerMonitor(clock clock.PassiveClock) *workerMonitor {
+	return &workerMonitor{
+		clock:    clock,
+		inFlight: make(map[string]time.Time),
+	}
+}
+
+// start records that the processing of key from the queue with the given
+// name started. The returned function must be called once it is done.
+func (m *workerMonitor) start(queue, key string) func() {
+	item := queue + "/" + key
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.inFlight[item] = m.clock.Now()
+
+	return func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		delete(m.inFlight, item)
+	}
+}
+
+// inFlightItems returns the items being processed, sorted.
+func (m *workerMonitor) inFlightItems() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return slices.Sorted(maps.Keys(m.inFlight))
+}
+
+// check returns an error if any item is processed for longer than timeout.
+func (m *workerMonitor) check(timeout time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.clock.Now()
+	var stuck []error
+	for item, started := range m.inFlight {
+		if elapsed := now.Sub(started); elapsed > timeout {
+			stuck = append(stuck, fmt.Errorf("item %s is processed since %s", item, elapsed.Round(time.Second)))
+		}
+	}
+	return errors.Join(stuck...)
+}
+
+// AddHealthChecks registers the liveness and readiness checks of the allocator.
+// The allocator is ready once the informers are synced and the bootstrap is
+// complete, and live as long as no worker is stuck on a single item.
+func (r *multiCIDRRangeAllocator) AddHealthChecks(registry server.CheckRegistry) {
+	registry.AddReadyzChecks(
+		server.NamedCheck("informer-sync", func(_ *http.Request) error {
+			if !r.nodesSynced() {
+				return errors.New("node informer not synced")
+			}
+			if !r.clusterCIDRSynced() {
+				return errors.New("ClusterCIDR informer not synced")
+			}
+			return nil
+		}),
+		server.NamedCheck("bootstrap", func(_ *http.Request) error {
+			if phase := r.BootstrapPhase(); phase != BootstrapPhaseComplete {
+				return fmt.Errorf("bootstrap phase is %s", phase)
+			}
+			return nil
+		}),
+	)
+	registry.AddHealthzChecks(
+		server.NamedCheck("workers", func(_ *http.Request) error {
+			return r.workers.check(workerStuckTimeout)
+		}),
+	)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/klog/v2/ktesting"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
+)
+
+type fakeCheckRegistry struct {
+	healthz map[string]server.HealthChecker
+	readyz  map[string]server.HealthChecker
+}
+
+func (f *fakeCheckRegistry) AddHealthzChecks(checks ...server.HealthChecker) {
+	for _, check := range checks {
+		f.healthz[check.Name()] = check
+	}
+}
+
+func (f *fakeCheckRegistry) AddReadyzChecks(checks ...server.HealthChecker) {
+	for _, check := range checks {
+		f.readyz[check.Name()] = check
+	}
+}
+
+func TestWorkerMonitor(t *testing.T) {
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	monitor := newWorkerMonitor(fakeClock)
+
+	doneNode := monitor.start("node", "node-1")
+	doneCIDR := monitor.start("cidr", "node-1")
+	require.NoError(t, monitor.check(time.Minute))
+
+	fakeClock.SetTime(fakeClock.Now().Add(2 * time.Minute))
+	err := monitor.check(time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "node/node-1")
+	assert.Contains(t, err.Error(), "cidr/node-1")
+
+	doneNode()
+	err = monitor.check(time.Minute)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "node/node-1")
+
+	doneCIDR()
+	require.NoError(t, monitor.check(time.Minute))
+}
+
+func TestAddHealthChecks(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	ra := newBootstrapTestAllocator(t, ctx, nil)
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	ra.workers = newWorkerMonitor(fakeClock)
+
+	registry := &fakeCheckRegistry{
+		healthz: make(map[string]server.HealthChecker),
+		readyz:  make(map[string]server.HealthChecker),
+	}
+	ra.AddHealthChecks(registry)
+	require.Contains(t, registry.readyz, "informer-sync")
+	require.Contains(t, registry.readyz, "bootstrap")
+	require.Contains(t, registry.healthz, "workers")
+
+	// The informers of the test allocator are never started.
+	assert.Error(t, registry.readyz["informer-sync"].Check(nil))
+
+	assert.Error(t, registry.readyz["bootstrap"].Check(nil))
+	require.NoError(t, ra.bootstrap(ctx))
+	assert.NoError(t, registry.readyz["bootstrap"].Check(nil))
+
+	done := ra.workers.start("node", "node-1")
+	assert.NoError(t, registry.healthz["workers"].Check(nil))
+	fakeClock.SetTime(fakeClock.Now().Add(workerStuckTimeout + time.Second))
+	assert.Error(t, registry.healthz["workers"].Check(nil))
+	done()
+	assert.NoError(t, registry.healthz["workers"].Check(nil))
+}
@@ -110,3 +110,12 @@ func makeClusterCIDR(name, ipv4CIDR, ipv6CIDR string, perNodeHostBits int32, nod
 		},
 	}
 }
+
+// makeSyncedClusterCIDR returns a ClusterCIDR as read from the API server,
+// with a generation and a resourceVersion.
+func makeSyncedClusterCIDR(name, ipv4CIDR, ipv6CIDR string, perNodeHostBits int32, nodeSelector *corev1.NodeSelector) *v1.ClusterCIDR {
+	clusterCIDR := makeClusterCIDR(name, ipv4CIDR, ipv6CIDR, perNodeHostBits, nodeSelector)
+	clusterCIDR.Generation = 1
+	clusterCIDR.ResourceVersion = "1"
+	return clusterCIDR
+}
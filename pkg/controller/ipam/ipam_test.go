@@ -401,8 +401,6 @@ func booststrapMultiCIDRRangeAllocator(
 	initialNode := makeNode("initial-node", labels)
 	_, err = client.CoreV1().Nodes().Create(ctx, initialNode, metav1.CreateOptions{})
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
-	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 	allocatorParams := CIDRAllocatorParams{
 		ClusterCIDRs:         clusterCIDRs,
@@ -418,7 +416,6 @@ func booststrapMultiCIDRRangeAllocator(
 		nodeInformer,
 		clusterCIDRInformer,
 		allocatorParams,
-		nodes,
 		nil,
 	)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
@@ -446,6 +443,13 @@ func makeNode(name string, labels map[string]string) *corev1.Node {
 	}
 }
 
+// makeAllocatedNode returns a node with the given podCIDRs.
+func makeAllocatedNode(name string, labels map[string]string, podCIDRs ...string) *corev1.Node {
+	node := makeNode(name, labels)
+	node.Spec.PodCIDRs = podCIDRs
+	return node
+}
+
 func nodeSelector(labels map[string][]string) *corev1.NodeSelector {
 	testNodeSelector := &corev1.NodeSelector{}
 
@@ -0,0 +1,258 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	nodeIpamSubsystem  = "node_ipam_controller"
+	workqueueSubsystem = "workqueue"
+)
+
+var (
+	nodeCIDRAllocationDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "node_cidr_allocation_duration_seconds",
+			Help:      "Histogram measuring the time from node creation until its podCIDRs are patched.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+	)
+	pendingNodes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "pending_nodes",
+			Help:      "Gauge measuring the number of nodes managed by this controller waiting for a podCIDR.",
+		},
+	)
+	nodeCIDRPatchErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "node_cidr_patch_errors_total",
+			Help:      "Counter measuring failed attempts to patch the podCIDRs of a node, by reason.",
+		},
+		[]string{"reason"},
+	)
+	cidrSetTimeToExhaustion = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "multicidrset_exhaustion_forecast_seconds",
+			Help:      "Gauge measuring the estimated time until all the CIDRs are allocated, based on the recent allocation rate. +Inf if the usage is not growing.",
+		},
+		[]string{"clusterCIDR", "clusterCIDRName"},
+	)
+	ownedShards = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "owned_shards",
+			Help:      "Gauge measuring the number of ClusterCIDR shards the replica allocates from when sharding is enabled.",
+		},
+	)
+	unmanagedNodes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "unmanaged_nodes",
+			Help:      "Gauge measuring the nodes relabeled out of the managed node selector whose podCIDRs are kept as used.",
+		},
+	)
+	shutdownInFlightItems = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "shutdown_in_flight_items",
+			Help:      "Gauge measuring the number of work items still in progress while the allocator shuts down.",
+		},
+	)
+	shutdownDrainDuration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "shutdown_drain_duration_seconds",
+			Help:      "Gauge measuring the time the last shutdown waited for the work items in progress.",
+		},
+	)
+	shutdownAbandonedItems = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "shutdown_abandoned_items_total",
+			Help:      "Counter measuring the work items cancelled because they did not complete within the shutdown grace period.",
+		},
+	)
+	snapshotSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "snapshot_size_bytes",
+			Help:      "Gauge measuring the size of the last allocator snapshot written.",
+		},
+	)
+	snapshotWriteErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "snapshot_write_errors_total",
+			Help:      "Counter measuring failed writes of the allocator snapshot, by reason.",
+		},
+		[]string{"reason"},
+	)
+	stickyReallocations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "sticky_reallocations_total",
+			Help:      "Counter measuring the nodes registering again within the sticky allocation window, by result (restored or unavailable).",
+		},
+		[]string{"result"},
+	)
+	bootstrapNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "bootstrap_nodes",
+			Help:      "Gauge measuring the nodes whose podCIDRs were occupied by the last bootstrap, by source (snapshot or rebuild).",
+		},
+		[]string{"source"},
+	)
+)
+
+// Workqueue metrics, matching the ones of k8s.io/component-base/metrics/prometheus/workqueue.
+var (
+	workqueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "depth",
+			Help:      "Current depth of workqueue.",
+		},
+		[]string{"name"},
+	)
+	workqueueAdds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "adds_total",
+			Help:      "Total number of adds handled by workqueue.",
+		},
+		[]string{"name"},
+	)
+	workqueueLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "queue_duration_seconds",
+			Help:      "How long in seconds an item stays in workqueue before being requested.",
+			Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 12),
+		},
+		[]string{"name"},
+	)
+	workqueueWorkDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "work_duration_seconds",
+			Help:      "How long in seconds processing an item from workqueue takes.",
+			Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 12),
+		},
+		[]string{"name"},
+	)
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "unfinished_work_seconds",
+			Help: "How many seconds of work has done that is in progress and hasn't been observed by work_duration. " +
+				"Large values indicate stuck threads. One can deduce the number of stuck threads by observing the rate at which this increases.",
+		},
+		[]string{"name"},
+	)
+	workqueueLongestRunningProcessor = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "longest_running_processor_seconds",
+			Help:      "How many seconds has the longest running processor for workqueue been running.",
+		},
+		[]string{"name"},
+	)
+	workqueueRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: workqueueSubsystem,
+			Name:      "retries_total",
+			Help:      "Total number of retries handled by workqueue.",
+		},
+		[]string{"name"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(nodeCIDRAllocationDuration)
+	prometheus.MustRegister(pendingNodes)
+	prometheus.MustRegister(nodeCIDRPatchErrors)
+	prometheus.MustRegister(cidrSetTimeToExhaustion)
+	prometheus.MustRegister(ownedShards)
+	prometheus.MustRegister(unmanagedNodes)
+	prometheus.MustRegister(shutdownInFlightItems)
+	prometheus.MustRegister(shutdownDrainDuration)
+	prometheus.MustRegister(shutdownAbandonedItems)
+	prometheus.MustRegister(snapshotSize)
+	prometheus.MustRegister(snapshotWriteErrors)
+	prometheus.MustRegister(bootstrapNodes)
+	prometheus.MustRegister(stickyReallocations)
+
+	prometheus.MustRegister(workqueueDepth)
+	prometheus.MustRegister(workqueueAdds)
+	prometheus.MustRegister(workqueueLatency)
+	prometheus.MustRegister(workqueueWorkDuration)
+	prometheus.MustRegister(workqueueUnfinishedWork)
+	prometheus.MustRegister(workqueueLongestRunningProcessor)
+	prometheus.MustRegister(workqueueRetries)
+	// The provider must be set before the queues are created.
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider exports the metrics of the allocator workqueues
+// through the default prometheus registry.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunningProcessor.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+// patchErrorReason returns the reason label of nodeCIDRPatchErrors for err.
+func patchErrorReason(err error) string {
+	if reason := apierrors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		return string(reason)
+	}
+	return "Unknown"
+}
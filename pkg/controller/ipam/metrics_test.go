@@ -0,0 +1,78 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestPendingNodeTracker(t *testing.T) {
+	tracker := newPendingNodeTracker()
+
+	node := makeNode("node-1", nil)
+	tracker.update(node)
+	assert.Equal(t, 1, tracker.len())
+	assert.InDelta(t, 1, testutil.ToFloat64(pendingNodes), 0)
+
+	// Updates of a pending node do not count it twice.
+	tracker.update(node)
+	assert.Equal(t, 1, tracker.len())
+
+	allocated := node.DeepCopy()
+	allocated.Spec.PodCIDRs = []string{"10.0.0.0/24"}
+	tracker.update(allocated)
+	assert.Equal(t, 0, tracker.len())
+
+	deleting := node.DeepCopy()
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	tracker.update(node)
+	tracker.update(deleting)
+	assert.Equal(t, 0, tracker.len())
+
+	tracker.update(node)
+	tracker.remove(node.Name)
+	assert.Equal(t, 0, tracker.len())
+	assert.InDelta(t, 0, testutil.ToFloat64(pendingNodes), 0)
+}
+
+func TestPatchErrorReason(t *testing.T) {
+	assert.Equal(t, "Conflict", patchErrorReason(apierrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node-1", errors.New("conflict"))))
+	assert.Equal(t, "NotFound", patchErrorReason(apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node-1")))
+	assert.Equal(t, "Unknown", patchErrorReason(errors.New("connection refused")))
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[string](),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "test_workqueue_metrics"},
+	)
+	defer queue.ShutDown()
+
+	queue.Add("a")
+	queue.Add("b")
+	assert.InDelta(t, 2, testutil.ToFloat64(workqueueDepth.WithLabelValues("test_workqueue_metrics")), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(workqueueAdds.WithLabelValues("test_workqueue_metrics")), 0)
+}
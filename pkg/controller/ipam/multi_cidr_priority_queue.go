@@ -31,10 +31,24 @@ type PriorityQueueItem struct {
 	labelMatchCount int
 	// selectorString is a string representation of the labelSelector associated with the cidrSet.
 	selectorString string
+	// catchAll is set for the ClusterCIDRs of the default node selector, which
+	// are not ordered by the heap but considered after all the others.
+	catchAll bool
 	// index is needed by update and is maintained by the heap.Interface methods.
 	index int // The index of the item in the heap.
 }
 
+// Names of the rules ordering the PriorityQueueItems, as reported in the
+// allocation decisions.
+const (
+	priorityRuleLabelMatchCount = "P0: more matching labels"
+	priorityRuleMaxAllocatable  = "P1: fewer allocatable pod CIDRs"
+	priorityRuleNodeMaskSize    = "P2: smaller per-node CIDRs"
+	priorityRuleSelector        = "P3: lower node selector"
+	priorityRuleCIDR            = "P4: lower CIDR"
+	priorityRuleCatchAll        = "catch-all ClusterCIDRs are considered last"
+)
+
 // A PriorityQueue implements heap.Interface and holds PriorityQueueItems.
 type PriorityQueue []*PriorityQueueItem
 
@@ -71,6 +85,24 @@ func (pq PriorityQueue) Less(i, j int) bool {
 	return pq[i].cidrLabel() < pq[j].cidrLabel()
 }
 
+// priorityRule returns the rule of Less that ranks higher before lower.
+func priorityRule(higher, lower *PriorityQueueItem) string {
+	switch {
+	case lower.catchAll:
+		return priorityRuleCatchAll
+	case higher.labelMatchCount != lower.labelMatchCount:
+		return priorityRuleLabelMatchCount
+	case higher.maxAllocatable() != lower.maxAllocatable():
+		return priorityRuleMaxAllocatable
+	case higher.nodeMaskSize() != lower.nodeMaskSize():
+		return priorityRuleNodeMaskSize
+	case higher.selectorString != lower.selectorString:
+		return priorityRuleSelector
+	default:
+		return priorityRuleCIDR
+	}
+}
+
 func (pq PriorityQueue) Swap(i, j int) {
 	pq[i], pq[j] = pq[j], pq[i]
 	pq[i].index = i
@@ -25,16 +25,18 @@ import (
 	"net"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	informers "k8s.io/client-go/informers/core/v1"
@@ -45,8 +47,8 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
-	nodeutil "k8s.io/component-helpers/node/util"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	netutil "k8s.io/utils/net"
 
 	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
@@ -55,6 +57,7 @@ import (
 	clustercidrlisters "sigs.k8s.io/node-ipam-controller/pkg/client/listers/clustercidr/v1"
 	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
 	controllerutil "sigs.k8s.io/node-ipam-controller/pkg/util/node"
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
 )
 
 const (
@@ -69,9 +72,6 @@ const (
 )
 
 const (
-	// The amount of time the nodecontroller polls on the list nodes endpoint.
-	apiserverStartupGracePeriod = 10 * time.Minute
-
 	// The no. of NodeSpec updates NC can process concurrently.
 	cidrUpdateWorkers = 30
 
@@ -81,7 +81,9 @@ const (
 
 // +kubebuilder:rbac:groups=networking.x-k8s.io,resources=clustercidrs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch;update
+// +kubebuilder:rbac:groups=core,resources=nodes/status,verbs=patch
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
 
 // CIDRAllocator is an interface implemented by things that know how
 // to allocate/occupy/recycle CIDR for nodes.
@@ -89,11 +91,23 @@ type CIDRAllocator interface {
 	// AllocateOrOccupyCIDR looks at the given node, assigns it a valid
 	// CIDR if it doesn't currently have one or mark the CIDR as used if
 	// the node already have one.
-	AllocateOrOccupyCIDR(logger klog.Logger, node *corev1.Node) error
+	AllocateOrOccupyCIDR(ctx context.Context, node *corev1.Node) error
 	// ReleaseCIDR releases the CIDR of the removed node.
-	ReleaseCIDR(logger klog.Logger, node *corev1.Node) error
+	ReleaseCIDR(ctx context.Context, node *corev1.Node) error
 	// Run starts all the working logic of the allocator.
 	Run(ctx context.Context)
+	// BootstrapPhase returns the phase the allocator bootstrap is currently in.
+	BootstrapPhase() BootstrapPhase
+	// AddHealthChecks registers the liveness and readiness checks of the allocator.
+	AddHealthChecks(registry server.CheckRegistry)
+	// AddDebugHandlers registers the endpoints that expose the in-memory state of the allocator.
+	AddDebugHandlers(registry server.HandlerRegistry)
+	// AcquireShard makes a sharded allocator allocate from the ClusterCIDRs of the shard.
+	AcquireShard(ctx context.Context, shard int)
+	// ReleaseShard stops the allocation from the ClusterCIDRs of the shard.
+	ReleaseShard(ctx context.Context, shard int)
+	// Promote makes a standby allocator allocate.
+	Promote(ctx context.Context)
 }
 
 // CIDRAllocatorParams is parameters that's required for creating new
@@ -107,6 +121,77 @@ type CIDRAllocatorParams struct {
 	SecondaryServiceCIDR *net.IPNet
 	// NodeCIDRMaskSizes is list of node cidr mask sizes.
 	NodeCIDRMaskSizes []int
+	// UsageWarningThresholds are the usage percentages of a CIDR set above which
+	// a Warning event is emitted on its ClusterCIDR.
+	UsageWarningThresholds []float64
+	// UsageForecastWindow is the period over which the allocation rate is
+	// measured to forecast the exhaustion of the CIDR sets. Defaults to
+	// DefaultUsageForecastWindow.
+	UsageForecastWindow time.Duration
+	// TracerProvider is used to trace the node and ClusterCIDR syncs. Tracing
+	// is disabled if it is nil.
+	TracerProvider trace.TracerProvider
+	// ManagePodCIDRUnassignedTaint makes the allocator taint the nodes it
+	// cannot assign podCIDRs to, and remove the taint once they are assigned.
+	ManagePodCIDRUnassignedTaint bool
+	// SetClusterCIDRLabel makes the allocator label the nodes with the name of
+	// the ClusterCIDR their podCIDRs were allocated from, in addition to the
+	// ClusterCIDRAnnotationKey annotation.
+	SetClusterCIDRLabel bool
+	// AllocationDecisionLogVerbosity is the verbosity at which the decision
+	// record of every allocation is logged.
+	AllocationDecisionLogVerbosity int
+	// CapacityConfigMapName is the name of the ConfigMap the remaining node
+	// capacity of every node selector is published to. The capacity is not
+	// published if it is empty.
+	CapacityConfigMapName string
+	// CapacityConfigMapNamespace is the namespace of the capacity ConfigMap.
+	// Defaults to DefaultCapacityConfigMapNamespace.
+	CapacityConfigMapNamespace string
+	// ManagedNodeSelector is the label selector of the nodes managed by the
+	// allocator, all the nodes if empty. The node informer should be filtered
+	// with the same selector.
+	ManagedNodeSelector string
+	// ControllerName is the name of the controller, it only uses the
+	// ClusterCIDRs with this spec.controllerName and the nodes they select.
+	// Defaults to v1.DefaultControllerName.
+	ControllerName string
+	// Shards is the number of shards the ClusterCIDRs are partitioned into
+	// across replicas, 0 disables sharding. A sharded allocator only allocates
+	// from the ClusterCIDRs of the shards acquired with AcquireShard.
+	Shards int
+	// Standby makes the allocator keep its state up to date without updating
+	// the nodes and ClusterCIDRs until Promote is called, so that a replica
+	// that is not the leader can take over without rebuilding its state.
+	Standby bool
+	// ShutdownGracePeriod is how long the work items in progress are given to
+	// complete once the allocator is stopped, before they are cancelled.
+	// Defaults to DefaultShutdownGracePeriod.
+	ShutdownGracePeriod time.Duration
+	// SnapshotConfigMapName is the name of the ConfigMap the allocation table
+	// is periodically persisted to, so that a new leader only rebuilds the
+	// nodes that changed since. The table is not persisted if it is empty.
+	SnapshotConfigMapName string
+	// SnapshotConfigMapNamespace is the namespace of the snapshot ConfigMap.
+	// Defaults to DefaultSnapshotConfigMapNamespace.
+	SnapshotConfigMapNamespace string
+	// SnapshotInterval is the interval between two snapshots of the
+	// allocation table. Defaults to DefaultSnapshotInterval.
+	SnapshotInterval time.Duration
+	// StickyAllocationWindow is how long the podCIDRs of a released node are
+	// remembered and held, so that a node registering again with the same
+	// name or providerID gets them back if they are still free. 0 disables
+	// it.
+	StickyAllocationWindow time.Duration
+	// PerFamilyClusterCIDRs selects the ClusterCIDR of the IPv4 and of the
+	// IPv6 podCIDR of a node independently, so that they may come from
+	// different ClusterCIDRs. It can not be combined with sharding.
+	PerFamilyClusterCIDRs bool
+	// RecordAllocationIntent makes the allocator record the CIDRs it reserved
+	// on the node before patching its podCIDRs, so that they stay reserved if
+	// the outcome of the patch is unknown. It costs an additional node patch
+	// per allocation.
+	RecordAllocationIntent bool
 }
 
 // CIDRs are reserved, then node resource is patched with them.
@@ -120,7 +205,8 @@ type nodeReservedCIDRs struct {
 // multiCIDRNodeReservedCIDRs holds the reservation info for a node.
 type multiCIDRNodeReservedCIDRs struct {
 	nodeReservedCIDRs
-	clusterCIDR *cidrset.ClusterCIDR
+	// clusterCIDRs are the ClusterCIDRs of the allocatedCIDRs, by index.
+	clusterCIDRs []*cidrset.ClusterCIDR
 }
 
 type multiCIDRRangeAllocator struct {
@@ -134,22 +220,56 @@ type multiCIDRRangeAllocator struct {
 	clusterCIDRLister clustercidrlisters.ClusterCIDRLister
 	// clusterCIDRSynced returns true if the clustercidr shared informer has been synced at least once.
 	clusterCIDRSynced cache.InformerSynced
-	broadcaster       record.EventBroadcaster
-	recorder          record.EventRecorder
+	// allocatorParams are used during bootstrap to create the default ClusterCIDR
+	// and to filter out the service ranges.
+	allocatorParams CIDRAllocatorParams
+	// bootstrapPhase holds the current BootstrapPhase of the allocator.
+	bootstrapPhase atomic.Value
+	broadcaster    record.EventBroadcaster
+	recorder       record.EventRecorder
 	// queues are where incoming work is placed to de-dup and to allow "easy"
 	// rate limited requeues on errors
 	cidrQueue workqueue.TypedRateLimitingInterface[string]
 	nodeQueue workqueue.TypedRateLimitingInterface[string]
-
-	// lock guards cidrMap to avoid races in CIDR allocation.
+	// cidrQueueWait and nodeQueueWait record when the keys were queued for tracing.
+	cidrQueueWait *queueWaitTracker
+	nodeQueueWait *queueWaitTracker
+	tracer        trace.Tracer
+	// workers tracks the items processed by the workers for the liveness check.
+	workers *workerMonitor
+	// pendingNodes tracks the nodes that are waiting for a podCIDR.
+	pendingNodes *pendingNodeTracker
+	// usageMonitor forecasts the exhaustion of the CIDR sets, guarded by lock.
+	usageMonitor *usageMonitor
+	// decisions holds the last allocation decision of every node.
+	decisions *allocationDecisionStore
+	// stickyAllocations remembers the podCIDRs of the released nodes, guarded
+	// by lock.
+	stickyAllocations *stickyAllocationStore
+	// clusterCIDROwners holds the ClusterCIDRs of all the controllers, parsed
+	// to find out the controller of the nodes.
+	clusterCIDROwners *clusterCIDROwnerCache
+	// managedNodeSelector selects the nodes managed by the allocator.
+	managedNodeSelector labels.Selector
+	// departedNodes holds the nodes holding CIDRs that were removed from the
+	// filtered node informer, until they are known to be deleted.
+	departedNodes *departedNodeTracker
+	// capacityUpdates signals that the capacity ConfigMap is out of date, it is
+	// nil if the capacity is not published.
+	capacityUpdates chan struct{}
+	// standby is set until a standby allocator is promoted.
+	standby atomic.Bool
+
+	// lock guards cidrMap and ownedShards to avoid races in CIDR allocation.
 	lock *sync.Mutex
 	// cidrMap maps ClusterCIDR labels to internal ClusterCIDR objects.
 	cidrMap map[string][]*cidrset.ClusterCIDR
+	// ownedShards holds the shards the allocator allocates from when sharded.
+	ownedShards map[int]bool
 }
 
 // NewMultiCIDRRangeAllocator returns a CIDRAllocator to allocate CIDRs for node (one for each ip family).
-// Caller must always pass in a list of existing nodes to the new allocator.
-// NodeList is only nil in testing.
+// The allocator state is rebuilt from the informer caches when Run is called, see bootstrap.
 func NewMultiCIDRRangeAllocator(
 	ctx context.Context,
 	client clientset.Interface,
@@ -157,7 +277,6 @@ func NewMultiCIDRRangeAllocator(
 	nodeInformer informers.NodeInformer,
 	clusterCIDRInformer clustercidrinformers.ClusterCIDRInformer,
 	allocatorParams CIDRAllocatorParams,
-	nodeList *corev1.NodeList,
 	testCIDRMap map[string][]*cidrset.ClusterCIDR,
 ) (CIDRAllocator, error) {
 	logger := klog.FromContext(ctx)
@@ -170,6 +289,48 @@ func NewMultiCIDRRangeAllocator(
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
+	if err := validateUsageWarningThresholds(allocatorParams.UsageWarningThresholds); err != nil {
+		return nil, err
+	}
+	managedNodeSelector, err := parseManagedNodeSelector(allocatorParams.ManagedNodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	if allocatorParams.ControllerName == "" {
+		allocatorParams.ControllerName = v1.DefaultControllerName
+	}
+	if err := validateControllerName(allocatorParams.ControllerName); err != nil {
+		return nil, err
+	}
+	if allocatorParams.Shards < 0 {
+		return nil, fmt.Errorf("invalid number of shards %d, must not be negative", allocatorParams.Shards)
+	}
+	if allocatorParams.PerFamilyClusterCIDRs && allocatorParams.Shards > 0 {
+		return nil, errors.New("per-family ClusterCIDR selection can not be combined with sharding")
+	}
+	forecastWindow := allocatorParams.UsageForecastWindow
+	if forecastWindow <= 0 {
+		forecastWindow = DefaultUsageForecastWindow
+	}
+	if allocatorParams.ShutdownGracePeriod <= 0 {
+		allocatorParams.ShutdownGracePeriod = DefaultShutdownGracePeriod
+	}
+
+	if allocatorParams.CapacityConfigMapNamespace == "" {
+		allocatorParams.CapacityConfigMapNamespace = DefaultCapacityConfigMapNamespace
+	}
+	if allocatorParams.SnapshotConfigMapNamespace == "" {
+		allocatorParams.SnapshotConfigMapNamespace = DefaultSnapshotConfigMapNamespace
+	}
+	if allocatorParams.SnapshotInterval <= 0 {
+		allocatorParams.SnapshotInterval = DefaultSnapshotInterval
+	}
+
+	tracerProvider := allocatorParams.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = noop.NewTracerProvider()
+	}
+
 	eventBroadcaster := record.NewBroadcaster()
 	eventSource := corev1.EventSource{
 		Component: "multiCIDRRangeAllocator",
@@ -183,6 +344,7 @@ func NewMultiCIDRRangeAllocator(
 		nodesSynced:       nodeInformer.Informer().HasSynced,
 		clusterCIDRLister: clusterCIDRInformer.Lister(),
 		clusterCIDRSynced: clusterCIDRInformer.Informer().HasSynced,
+		allocatorParams:   allocatorParams,
 		broadcaster:       eventBroadcaster,
 		recorder:          recorder,
 		cidrQueue: workqueue.NewTypedRateLimitingQueueWithConfig(
@@ -193,8 +355,20 @@ func NewMultiCIDRRangeAllocator(
 			workqueue.DefaultTypedControllerRateLimiter[string](),
 			workqueue.TypedRateLimitingQueueConfig[string]{Name: "multi_cidr_range_allocator_node"},
 		),
-		lock:    &sync.Mutex{},
-		cidrMap: make(map[string][]*cidrset.ClusterCIDR, 0),
+		cidrQueueWait:       newQueueWaitTracker(clock.RealClock{}),
+		nodeQueueWait:       newQueueWaitTracker(clock.RealClock{}),
+		tracer:              tracerProvider.Tracer(instrumentationScope),
+		workers:             newWorkerMonitor(clock.RealClock{}),
+		pendingNodes:        newPendingNodeTracker(),
+		usageMonitor:        newUsageMonitor(clock.RealClock{}, forecastWindow, allocatorParams.UsageWarningThresholds),
+		decisions:           newAllocationDecisionStore(),
+		stickyAllocations:   newStickyAllocationStore(clock.RealClock{}, allocatorParams.StickyAllocationWindow),
+		clusterCIDROwners:   newClusterCIDROwnerCache(),
+		managedNodeSelector: managedNodeSelector,
+		departedNodes:       newDepartedNodeTracker(),
+		lock:                &sync.Mutex{},
+		cidrMap:             make(map[string][]*cidrset.ClusterCIDR, 0),
+		ownedShards:         make(map[int]bool),
 	}
 
 	// testCIDRMap is only set for testing purposes.
@@ -205,32 +379,21 @@ func NewMultiCIDRRangeAllocator(
 		logger.Info("TestCIDRMap should only be set for testing purposes, if this is seen in production logs, it might be a misconfiguration or a bug")
 	}
 
-	ccList, err := listClusterCIDRs(ctx, networkClient)
-	if err != nil {
-		return nil, err
-	}
-
-	if ccList == nil {
-		ccList = &v1.ClusterCIDRList{}
+	if allocatorParams.CapacityConfigMapName != "" {
+		ra.capacityUpdates = make(chan struct{}, 1)
 	}
-	createDefaultClusterCIDR(logger, ccList, allocatorParams)
 
-	// Regenerate the cidrMaps from the existing ClusterCIDRs.
-	for _, clusterCIDR := range ccList.Items {
-		logger.Info("Regenerating existing ClusterCIDR", "clusterCIDR", clusterCIDR)
-		clusterCIDR := clusterCIDR
-		// Create an event for invalid ClusterCIDRs, do not crash on failures.
-		if err := ra.reconcileBootstrap(ctx, &clusterCIDR); err != nil {
-			logger.Error(err, "Error while regenerating existing ClusterCIDR")
-			ra.recorder.Event(&clusterCIDR, "Warning", "InvalidClusterCIDR encountered while regenerating ClusterCIDR during bootstrap.", err.Error())
-		}
-	}
+	ra.bootstrapPhase.Store(BootstrapPhasePending)
+	ra.standby.Store(allocatorParams.Standby)
 
 	_, err = clusterCIDRInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			if clusterCIDR, ok := obj.(*v1.ClusterCIDR); ok && ra.clusterCIDROwners.update(clusterCIDR) {
+				ra.retrackPendingNodes(logger)
+			}
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err == nil {
-				ra.cidrQueue.Add(key)
+				ra.enqueueClusterCIDR(key)
 			}
 		},
 		UpdateFunc: func(old, new interface{}) {
@@ -238,9 +401,12 @@ func NewMultiCIDRRangeAllocator(
 				return
 			}
 
+			if clusterCIDR, ok := new.(*v1.ClusterCIDR); ok && ra.clusterCIDROwners.update(clusterCIDR) {
+				ra.retrackPendingNodes(logger)
+			}
 			key, err := cache.MetaNamespaceKeyFunc(new)
 			if err == nil {
-				ra.cidrQueue.Add(key)
+				ra.enqueueClusterCIDR(key)
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -251,62 +417,37 @@ func NewMultiCIDRRangeAllocator(
 				utilruntime.HandleError(fmt.Errorf("couldn't get key for cidr %+v: %w", obj, err))
 				return
 			}
-			ra.cidrQueue.Add(key)
+			if ra.clusterCIDROwners.remove(key) {
+				ra.retrackPendingNodes(logger)
+			}
+			ra.enqueueClusterCIDR(key)
 		},
 	})
 	if err != nil {
 		logger.Info("failed to add event handler to clusterCIDRInformer", "err", err)
 	}
 
-	ra.lock.Lock()
-	if allocatorParams.ServiceCIDR != nil {
-		ra.filterOutServiceRange(logger, allocatorParams.ServiceCIDR, ra.cidrMap)
-	} else {
-		logger.Info("No Service CIDR provided. Skipping filtering out service addresses")
-	}
-
-	if allocatorParams.SecondaryServiceCIDR != nil {
-		ra.filterOutServiceRange(logger, allocatorParams.SecondaryServiceCIDR, ra.cidrMap)
-	} else {
-		logger.Info("No Secondary Service CIDR provided. Skipping filtering out secondary service addresses")
-	}
-	ra.lock.Unlock()
-
-	if nodeList != nil {
-		ra.lock.Lock()
-		for _, node := range nodeList.Items {
-			if len(node.Spec.PodCIDRs) == 0 {
-				logger.V(4).Info("Node has no CIDR, ignoring", "node", klog.KObj(&node))
-				continue
-			}
-			logger.Info("Node has CIDR, occupying it in CIDR map", "node", klog.KObj(&node), "podCIDRs", node.Spec.PodCIDRs)
-			if err := ra.occupyCIDRs(logger, &node, ra.cidrMap); err != nil {
-				// This will happen if:
-				// 1. We find garbage in the podCIDRs field. Retrying is useless.
-				// 2. CIDR out of range: This means ClusterCIDR is not yet created
-				//    or the node is not managed by this IPAM controller
-				// This error will be information only, see https://github.com/kubernetes-sigs/node-ipam-controller/issues/27
-				logger.Info("Node CIDR has no associated ClusterCIDR, skipping", "node", klog.KObj(&node), "error", err)
-			}
-		}
-		ra.lock.Unlock()
-	}
-
 	_, err = nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				ra.trackPendingNode(node)
+			}
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err == nil {
-				ra.nodeQueue.Add(key)
+				ra.enqueueNode(key)
 			}
 		},
 		UpdateFunc: func(old, new interface{}) {
+			if node, ok := new.(*corev1.Node); ok {
+				ra.trackPendingNode(node)
+			}
 			key, err := cache.MetaNamespaceKeyFunc(new)
 			if err == nil {
-				ra.nodeQueue.Add(key)
+				ra.enqueueNode(key)
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			ra.handleNodeDelete(logger, obj)
+			ra.handleNodeDelete(ctx, obj)
 		},
 	})
 	if err != nil {
@@ -316,7 +457,20 @@ func NewMultiCIDRRangeAllocator(
 	return ra, nil
 }
 
-func (r *multiCIDRRangeAllocator) handleNodeDelete(logger klog.Logger, obj interface{}) {
+// enqueueClusterCIDR adds the ClusterCIDR key to the cidrQueue.
+func (r *multiCIDRRangeAllocator) enqueueClusterCIDR(key string) {
+	r.cidrQueueWait.added(key)
+	r.cidrQueue.Add(key)
+}
+
+// enqueueNode adds the node key to the nodeQueue.
+func (r *multiCIDRRangeAllocator) enqueueNode(key string) {
+	r.nodeQueueWait.added(key)
+	r.nodeQueue.Add(key)
+}
+
+func (r *multiCIDRRangeAllocator) handleNodeDelete(ctx context.Context, obj interface{}) {
+	logger := klog.FromContext(ctx)
 	node, ok := obj.(*corev1.Node)
 	if !ok {
 		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
@@ -331,7 +485,21 @@ func (r *multiCIDRRangeAllocator) handleNodeDelete(logger klog.Logger, obj inter
 		}
 	}
 
-	if err := r.ReleaseCIDR(logger, node); err != nil {
+	r.pendingNodes.remove(node.Name)
+	r.decisions.remove(node.Name)
+	if !r.ownsNode(node) {
+		logger.V(4).Info("Deleted node belonged to another controller, nothing to release", "node", klog.KObj(node))
+		return
+	}
+	if r.mayLeaveManagedSet(node) {
+		// The node may still exist with labels no longer matching the
+		// ManagedNodeSelector, a worker checks it rather than blocking the
+		// informer.
+		r.departedNodes.add(node)
+		r.enqueueNode(node.Name)
+		return
+	}
+	if err := r.ReleaseCIDR(ctx, node); err != nil {
 		logger.Error(err, "failed to release CIDR")
 	}
 }
@@ -352,16 +520,50 @@ func (r *multiCIDRRangeAllocator) Run(ctx context.Context) {
 	logger.Info("Starting Multi CIDR Range allocator")
 	defer logger.Info("Shutting down Multi CIDR Range allocator")
 
+	r.setBootstrapPhase(logger, BootstrapPhaseWaitingForCacheSync)
 	if !cache.WaitForNamedCacheSync("multi_cidr_range_allocator", ctx.Done(), r.nodesSynced, r.clusterCIDRSynced) {
 		return
 	}
+	// The nodes seen before all the ClusterCIDRs were known may have been
+	// tracked with the wrong owner.
+	r.retrackPendingNodes(logger)
+
+	// Workers must not start before the allocator knows about every ClusterCIDR
+	// and every podCIDR that is already in use, otherwise they could hand out
+	// CIDRs that are allocated to nodes which were not processed yet.
+	if err := r.bootstrap(ctx); err != nil {
+		logger.Error(err, "Failed to bootstrap Multi CIDR Range allocator")
+		return
+	}
 
+	// The workers are not cancelled with ctx, so that the node patches in
+	// progress complete before the allocator returns, see drain.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	var workers sync.WaitGroup
 	for i := 0; i < cidrUpdateWorkers; i++ {
-		go wait.UntilWithContext(ctx, r.runCIDRWorker, time.Second)
-		go wait.UntilWithContext(ctx, r.runNodeWorker, time.Second)
+		workers.Add(2)
+		go func() {
+			defer workers.Done()
+			r.runCIDRWorker(workCtx)
+		}()
+		go func() {
+			defer workers.Done()
+			r.runNodeWorker(workCtx)
+		}()
+	}
+	go wait.UntilWithContext(ctx, r.checkUsage, usageCheckPeriod)
+	if r.capacityUpdates != nil {
+		r.capacityChanged()
+		go r.runCapacityPublisher(ctx)
+	}
+	if r.snapshotsEnabled() {
+		go r.runSnapshotWriter(ctx)
 	}
 
 	<-ctx.Done()
+	r.drain(logger, &workers, cancelWork)
+	r.writeLastSnapshot(logger)
 }
 
 // runWorker is a long-running function that will continually call the
@@ -380,6 +582,11 @@ func (r *multiCIDRRangeAllocator) processNextCIDRWorkItem(ctx context.Context) b
 	if shutdown {
 		return false
 	}
+	if r.cidrQueue.ShuttingDown() {
+		// The queued items are left to the next leader.
+		r.cidrQueue.Done(key)
+		return false
+	}
 
 	// We wrap this block in a func so we can defer c.cidrQueue.Done.
 	err := func(ctx context.Context, key string) error {
@@ -390,6 +597,8 @@ func (r *multiCIDRRangeAllocator) processNextCIDRWorkItem(ctx context.Context) b
 		// put back on the cidrQueue and attempted again after a back-off
 		// period.
 		defer r.cidrQueue.Done(key)
+		defer r.workers.start("cidr", key)()
+		ctx, span := r.startSyncSpan(ctx, "syncClusterCIDR", r.cidrQueueWait, key)
 		// We expect strings to come off the cidrQueue. These are of the
 		// form namespace/name. We do this as the delayed nature of the
 		// cidrQueue means the items in the informer cache may actually be
@@ -397,8 +606,11 @@ func (r *multiCIDRRangeAllocator) processNextCIDRWorkItem(ctx context.Context) b
 		// cidrQueue.
 		// Run the syncHandler, passing it the namespace/name string of the
 		// Foo resource to be synced.
-		if err := r.syncClusterCIDR(ctx, key); err != nil {
+		err := r.syncClusterCIDR(ctx, key)
+		endSpan(span, err)
+		if err != nil {
 			// Put the item back on the cidrQueue to handle any transient errors.
+			r.cidrQueueWait.added(key)
 			r.cidrQueue.AddRateLimited(key)
 			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
 		}
@@ -428,9 +640,14 @@ func (r *multiCIDRRangeAllocator) processNextNodeWorkItem(ctx context.Context) b
 	if shutdown {
 		return false
 	}
+	if r.nodeQueue.ShuttingDown() {
+		// The queued items are left to the next leader.
+		r.nodeQueue.Done(key)
+		return false
+	}
 
 	// We wrap this block in a func so we can defer c.cidrQueue.Done.
-	err := func(logger klog.Logger, key string) error {
+	err := func(ctx context.Context, key string) error {
 		// We call Done here so the workNodeQueue knows we have finished
 		// processing this item. We also must remember to call Forget if we
 		// do not want this work item being re-queued. For example, we do
@@ -438,6 +655,8 @@ func (r *multiCIDRRangeAllocator) processNextNodeWorkItem(ctx context.Context) b
 		// put back on the nodeQueue and attempted again after a back-off
 		// period.
 		defer r.nodeQueue.Done(key)
+		defer r.workers.start("node", key)()
+		ctx, span := r.startSyncSpan(ctx, "syncNode", r.nodeQueueWait, key)
 		// We expect strings to come off the workNodeQueue. These are of the
 		// form namespace/name. We do this as the delayed nature of the
 		// workNodeQueue means the items in the informer cache may actually be
@@ -445,17 +664,20 @@ func (r *multiCIDRRangeAllocator) processNextNodeWorkItem(ctx context.Context) b
 		// workNodeQueue.
 		// Run the syncHandler, passing it the namespace/name string of the
 		// Foo resource to be synced.
-		if err := r.syncNode(logger, key); err != nil {
+		err := r.syncNode(ctx, key)
+		endSpan(span, err)
+		if err != nil {
 			// Put the item back on the cidrQueue to handle any transient errors.
+			r.nodeQueueWait.added(key)
 			r.nodeQueue.AddRateLimited(key)
 			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get nodeQueue again until another change happens.
 		r.nodeQueue.Forget(key)
-		logger.Info("Successfully synced node", "key", key)
+		klog.FromContext(ctx).Info("Successfully synced node", "key", key)
 		return nil
-	}(klog.FromContext(ctx), key)
+	}(ctx, key)
 	if err != nil {
 		utilruntime.HandleError(err)
 		return true
@@ -464,7 +686,8 @@ func (r *multiCIDRRangeAllocator) processNextNodeWorkItem(ctx context.Context) b
 	return true
 }
 
-func (r *multiCIDRRangeAllocator) syncNode(logger klog.Logger, key string) error {
+func (r *multiCIDRRangeAllocator) syncNode(ctx context.Context, key string) error {
+	logger := klog.FromContext(ctx)
 	startTime := time.Now()
 	defer func() {
 		logger.V(4).Info("Finished syncing Node request", "node", key, "elapsed", time.Since(startTime))
@@ -472,18 +695,52 @@ func (r *multiCIDRRangeAllocator) syncNode(logger klog.Logger, key string) error
 
 	node, err := r.nodeLister.Get(key)
 	if apierrors.IsNotFound(err) {
+		if departed := r.departedNodes.get(key); departed != nil {
+			return r.syncDepartedNode(ctx, departed)
+		}
 		logger.V(3).Info("node has been deleted", "node", key)
 		return nil
 	}
 	if err != nil {
 		return err
 	}
+	// The node is back in the managed set, its CIDRs are still used.
+	r.departedNodes.remove(key)
+	if !r.managesNode(node) {
+		logger.V(4).Info("Node is not selected by the managed node selector, skipping", "node", key)
+		return nil
+	}
+	if !r.ownsNode(node) {
+		logger.V(4).Info("Node belongs to another controller, skipping", "node", key)
+		return nil
+	}
 	// Check the DeletionTimestamp to determine if object is under deletion.
 	if !node.DeletionTimestamp.IsZero() {
 		logger.V(3).Info("node is being deleted", "node", key)
-		return r.ReleaseCIDR(logger, node)
+		return r.ReleaseCIDR(ctx, node)
+	}
+	if skipsPodCIDRAllocation(node) {
+		logger.V(4).Info("Node opted out of podCIDR allocation, skipping", "node", key)
+		r.observeNode(ctx, node)
+		return nil
+	}
+	owned, err := r.ownsNodeShard(ctx, node)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		logger.V(4).Info("Node is handled by another replica, skipping", "node", key)
+		r.observeNode(ctx, node)
+		return r.reclaimExhaustedNode(ctx, node)
+	}
+	err = r.AllocateOrOccupyCIDR(ctx, node)
+	if errors.Is(err, errClusterCIDRsExhausted) {
+		// The node update event makes the owner of the next shard sync it.
+		if handedOver, handOverErr := r.handOverExhaustedNode(ctx, node); handedOver || handOverErr != nil {
+			return handOverErr
+		}
 	}
-	return r.AllocateOrOccupyCIDR(logger, node)
+	return err
 }
 
 // needToAddFinalizer checks if a finalizer should be added to the object.
@@ -507,6 +764,10 @@ func (r *multiCIDRRangeAllocator) syncClusterCIDR(ctx context.Context, key strin
 	if err != nil {
 		return err
 	}
+	if !r.ownsClusterCIDR(clusterCIDR) {
+		logger.V(4).Info("ClusterCIDR belongs to another controller, skipping", "clusterCIDR", key, "controllerName", clusterCIDR.Spec.ControllerName)
+		return nil
+	}
 
 	// Check the DeletionTimestamp to determine if object is under deletion.
 	if !clusterCIDR.DeletionTimestamp.IsZero() {
@@ -517,13 +778,26 @@ func (r *multiCIDRRangeAllocator) syncClusterCIDR(ctx context.Context, key strin
 
 // occupyCIDRs marks node.PodCIDRs[...] as used in allocator's tracked cidrSet.
 // Requires the caller to hold r.lock.
-func (r *multiCIDRRangeAllocator) occupyCIDRs(logger klog.Logger, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) error {
+// It returns the ClusterCIDR of each podCIDR.
+func (r *multiCIDRRangeAllocator) occupyCIDRs(logger klog.Logger, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*cidrset.ClusterCIDR, error) {
 	if len(node.Spec.PodCIDRs) == 0 {
-		return nil
+		return nil, nil
+	}
+	if r.selectsPerFamily(node) {
+		return r.occupyCIDRsPerFamily(logger, node, cidrMap)
 	}
 	clusterCIDRList, err := r.orderedMatchingClusterCIDRs(node, true, cidrMap)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// The ClusterCIDR recorded on the node is authoritative, even if the node
+	// labels changed since the allocation. Matching is the fallback for nodes
+	// allocated before it was recorded.
+	if recorded := recordedClusterCIDR(node, cidrMap); recorded != nil {
+		clusterCIDRList = slices.DeleteFunc(clusterCIDRList, func(clusterCIDR *cidrset.ClusterCIDR) bool {
+			return clusterCIDR == recorded
+		})
+		clusterCIDRList = slices.Insert(clusterCIDRList, 0, recorded)
 	}
 
 	// There can be clusters with nodes that were handled by a different IPAM controller, in order to allow
@@ -533,7 +807,7 @@ func (r *multiCIDRRangeAllocator) occupyCIDRs(logger klog.Logger, node *corev1.N
 	// fail and retry a couple of time can provide information to these users.
 	// https://github.com/kubernetes-sigs/node-ipam-controller/issues/27
 	if len(clusterCIDRList) == 0 {
-		return fmt.Errorf("could not occupy cidrs: %v, No matching ClusterCIDRs found", node.Spec.PodCIDRs)
+		return nil, fmt.Errorf("could not occupy cidrs: %v, No matching ClusterCIDRs found", node.Spec.PodCIDRs)
 	}
 
 	attempts := 0
@@ -544,7 +818,7 @@ func (r *multiCIDRRangeAllocator) occupyCIDRs(logger klog.Logger, node *corev1.N
 		for _, cidr := range node.Spec.PodCIDRs {
 			_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
 			if err != nil {
-				return fmt.Errorf("failed to parse CIDR %s on Node %v: %w", cidr, node.Name, err)
+				return nil, fmt.Errorf("failed to parse CIDR %s on Node %v: %w", cidr, node.Name, err)
 			}
 
 			logger.Info("occupy CIDR for node", "CIDR", cidr, "node", klog.KObj(node))
@@ -560,11 +834,23 @@ func (r *multiCIDRRangeAllocator) occupyCIDRs(logger klog.Logger, node *corev1.N
 		// Mark CIDRs as occupied only if the CCC is able to occupy all the node CIDRs.
 		if occupiedCount == len(node.Spec.PodCIDRs) {
 			clusterCIDR.AssociatedNodes[node.Name] = true
-			return nil
+			return repeatClusterCIDR(clusterCIDR, len(node.Spec.PodCIDRs)), nil
 		}
 	}
 
-	return fmt.Errorf("could not occupy cidrs: %v after %d attempts", node.Spec.PodCIDRs, attempts)
+	return nil, fmt.Errorf("could not occupy cidrs: %v after %d attempts", node.Spec.PodCIDRs, attempts)
+}
+
+// recordedClusterCIDR requires the caller to hold r.lock.
+// recordedClusterCIDR returns the ClusterCIDR recorded in the node annotation,
+// the one of the first podCIDR if they come from several ClusterCIDRs, nil if
+// there is none or it is not in the cidrMap.
+func recordedClusterCIDR(node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) *cidrset.ClusterCIDR {
+	name, ok := node.Annotations[ClusterCIDRAnnotationKey]
+	if !ok {
+		return nil
+	}
+	return clusterCIDRByName(splitClusterCIDRNames(name)[0], cidrMap)
 }
 
 // associatedCIDRSet returns the CIDRSet, based on the ip family of the CIDR.
@@ -585,10 +871,14 @@ func (r *multiCIDRRangeAllocator) Occupy(clusterCIDR *cidrset.ClusterCIDR, cidr
 	if err != nil {
 		return err
 	}
+	if currCIDRSet == nil {
+		return fmt.Errorf("clusterCIDR %s has no range of the family of cidr %v", clusterCIDR.Name, cidr)
+	}
 
 	if err := currCIDRSet.Occupy(cidr); err != nil {
 		return fmt.Errorf("unable to occupy cidr %v in cidrSet: %w", cidr, err)
 	}
+	r.capacityChanged()
 
 	return nil
 }
@@ -600,11 +890,35 @@ func (r *multiCIDRRangeAllocator) Release(logger klog.Logger, clusterCIDR *cidrs
 	if err != nil {
 		return err
 	}
+	if currCIDRSet == nil {
+		return fmt.Errorf("clusterCIDR %s has no range of the family of cidr %v", clusterCIDR.Name, cidr)
+	}
 
 	if err := currCIDRSet.Release(cidr); err != nil {
 		logger.Info("Unable to release cidr in cidrSet", "CIDR", cidr)
 		return err
 	}
+	r.capacityChanged()
+
+	return nil
+}
+
+// Unreserve marks the CIDR as free in the cidrSet like Release, without
+// quarantining it: it was reserved for a node that never got it.
+func (r *multiCIDRRangeAllocator) Unreserve(logger klog.Logger, clusterCIDR *cidrset.ClusterCIDR, cidr *net.IPNet) error {
+	currCIDRSet, err := r.associatedCIDRSet(clusterCIDR, cidr)
+	if err != nil {
+		return err
+	}
+	if currCIDRSet == nil {
+		return fmt.Errorf("clusterCIDR %s has no range of the family of cidr %v", clusterCIDR.Name, cidr)
+	}
+
+	if err := currCIDRSet.Unreserve(cidr); err != nil {
+		logger.Info("Unable to unreserve cidr in cidrSet", "CIDR", cidr)
+		return err
+	}
+	r.capacityChanged()
 
 	return nil
 }
@@ -615,27 +929,84 @@ func (r *multiCIDRRangeAllocator) Release(logger klog.Logger, clusterCIDR *cidrs
 // WARNING: If you're adding any return calls or defer any more work from this
 // function you have to make sure to update nodesInProcessing properly with the
 // disposition of the node when the work is done.
-func (r *multiCIDRRangeAllocator) AllocateOrOccupyCIDR(logger klog.Logger, node *corev1.Node) error {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
+func (r *multiCIDRRangeAllocator) AllocateOrOccupyCIDR(ctx context.Context, node *corev1.Node) error {
 	if node == nil {
 		return nil
 	}
 
+	assignment, err := r.allocateOrOccupyCIDR(ctx, node)
+	// The ClusterCIDR and the PodCIDRAssigned condition are recorded without
+	// holding r.lock so that the API round-trips do not hold up the
+	// allocation of the other nodes.
+	if err == nil && assignment != nil && assignment.clusterCIDR != "" {
+		if err := r.recordClusterCIDR(ctx, node, assignment.clusterCIDR); err != nil {
+			return err
+		}
+	}
+	if reportErr := r.reportPodCIDRAssignment(ctx, node, assignment); err == nil {
+		err = reportErr
+	}
+	return err
+}
+
+// allocateOrOccupyCIDR implements AllocateOrOccupyCIDR while holding r.lock. It
+// returns the PodCIDRAssigned condition to report on the node, if any.
+func (r *multiCIDRRangeAllocator) allocateOrOccupyCIDR(ctx context.Context, node *corev1.Node) (*podCIDRAssignment, error) {
+	logger := klog.FromContext(ctx)
+	r.lockWithSpan(ctx)
+	defer r.lock.Unlock()
+
 	if len(node.Spec.PodCIDRs) > 0 {
-		return r.occupyCIDRs(logger, node, r.cidrMap)
+		clusterCIDRs, err := r.occupyCIDRs(logger, node, r.cidrMap)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.resolveAllocationIntent(ctx, node); err != nil {
+			return nil, err
+		}
+		return &podCIDRAssignment{assigned: true, clusterCIDR: clusterCIDRNames(clusterCIDRs)}, nil
 	}
 
-	cidrs, clusterCIDR, err := r.prioritizedCIDRs(logger, node, r.cidrMap)
+	if resumed, assignment, err := r.resumeAllocationIntent(ctx, node); resumed || err != nil {
+		return assignment, err
+	}
+
+	decision := newAllocationDecision(node)
+	if cidrs, clusterCIDR, allocation := r.restoreStickyCIDRs(logger, node); cidrs != nil {
+		decision.restored(clusterCIDR.Name, ipnetToStringList(cidrs))
+		assignment, err := r.updateCIDRsAllocation(ctx, multiCIDRNodeReservedCIDRs{
+			nodeReservedCIDRs: nodeReservedCIDRs{
+				nodeName:       node.Name,
+				allocatedCIDRs: cidrs,
+			},
+			clusterCIDRs: repeatClusterCIDR(clusterCIDR, len(cidrs)),
+		})
+		r.completeStickyRestore(logger, allocation, clusterCIDR, cidrs, err)
+		r.recordDecision(ctx, node, decision, err)
+		return assignment, err
+	}
+
+	var cidrs []*net.IPNet
+	var clusterCIDRs []*cidrset.ClusterCIDR
+	var err error
+	if r.allocatorParams.PerFamilyClusterCIDRs {
+		cidrs, clusterCIDRs, err = r.perFamilyCIDRs(ctx, node, r.cidrMap, decision)
+	} else {
+		var clusterCIDR *cidrset.ClusterCIDR
+		cidrs, clusterCIDR, err = r.prioritizedCIDRs(ctx, node, r.cidrMap, decision)
+		clusterCIDRs = repeatClusterCIDR(clusterCIDR, len(cidrs))
+	}
 	if err != nil {
+		r.recordDecision(ctx, node, decision, err)
 		controllerutil.RecordNodeStatusChange(logger, r.recorder, node, "CIDRNotAvailable")
-		return fmt.Errorf("failed to get cidrs for node %s: %w", node.Name, err)
+		return podCIDRUnassigned(podCIDRUnassignedReason(err), err.Error()), fmt.Errorf("failed to get cidrs for node %s: %w", node.Name, err)
 	}
 
 	if len(cidrs) == 0 {
+		err := fmt.Errorf("no cidrSets with matching labels found for node %s", node.Name)
+		r.recordDecision(ctx, node, decision, err)
 		controllerutil.RecordNodeStatusChange(logger, r.recorder, node, "CIDRNotAvailable")
-		return fmt.Errorf("no cidrSets with matching labels found for node %s", node.Name)
+		return podCIDRUnassigned(PodCIDRAssignedReasonNoMatchingClusterCIDR, "No ClusterCIDR with a CIDR set matches the node"), err
 	}
 
 	// allocate and queue the assignment.
@@ -644,41 +1015,68 @@ func (r *multiCIDRRangeAllocator) AllocateOrOccupyCIDR(logger klog.Logger, node
 			nodeName:       node.Name,
 			allocatedCIDRs: cidrs,
 		},
-		clusterCIDR: clusterCIDR,
+		clusterCIDRs: clusterCIDRs,
 	}
 
-	return r.updateCIDRsAllocation(logger, allocated)
+	assignment, err := r.updateCIDRsAllocation(ctx, allocated)
+	r.recordDecision(ctx, node, decision, err)
+	return assignment, err
 }
 
 // ReleaseCIDR marks node.podCIDRs[...] as unused in our tracked cidrSets.
-func (r *multiCIDRRangeAllocator) ReleaseCIDR(logger klog.Logger, node *corev1.Node) error {
-	r.lock.Lock()
+func (r *multiCIDRRangeAllocator) ReleaseCIDR(ctx context.Context, node *corev1.Node) error {
+	logger := klog.FromContext(ctx)
+	r.lockWithSpan(ctx)
 	defer r.lock.Unlock()
 
-	if node == nil || len(node.Spec.PodCIDRs) == 0 {
+	if node == nil {
+		return nil
+	}
+	if err := r.releaseIntent(logger, node, r.cidrMap); err != nil {
+		return err
+	}
+	if len(node.Spec.PodCIDRs) == 0 {
 		return nil
 	}
 
-	clusterCIDR, err := r.allocatedClusterCIDR(node, r.cidrMap)
+	clusterCIDRs, err := r.allocatedClusterCIDRs(node, r.cidrMap)
 	if err != nil {
 		return err
 	}
 
-	for _, cidr := range node.Spec.PodCIDRs {
+	podCIDRs := make([]*net.IPNet, 0, len(node.Spec.PodCIDRs))
+	for i, cidr := range node.Spec.PodCIDRs {
 		_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
 		if err != nil {
 			return fmt.Errorf("failed to parse CIDR %q on Node %q: %w", cidr, node.Name, err)
 		}
 
 		logger.Info("release CIDR for node", "CIDR", cidr, "node", klog.KObj(node))
-		if err := r.Release(logger, clusterCIDR, podCIDR); err != nil {
-			return fmt.Errorf("failed to release cidr %q from clusterCIDR %q for node %q: %w", cidr, clusterCIDR.Name, node.Name, err)
+		if err := r.Release(logger, clusterCIDRs[i], podCIDR); err != nil {
+			return fmt.Errorf("failed to release cidr %q from clusterCIDR %q for node %q: %w", cidr, clusterCIDRs[i].Name, node.Name, err)
 		}
+		podCIDRs = append(podCIDRs, podCIDR)
 	}
 
-	// Remove the node from the ClusterCIDR AssociatedNodes.
-	delete(clusterCIDR.AssociatedNodes, node.Name)
+	distinct := distinctClusterCIDRs(clusterCIDRs)
+	// Only the podCIDRs of a single ClusterCIDR are restored to a node
+	// registering again, they are held for it until then.
+	held := false
+	if len(distinct) == 1 {
+		if allocation := r.stickyAllocations.remember(node, distinct[0].Name); allocation != nil {
+			r.holdStickyCIDRs(logger, allocation, distinct[0], podCIDRs)
+			held = true
+		}
+	}
+	for _, clusterCIDR := range distinct {
+		// Remove the node from the ClusterCIDR AssociatedNodes.
+		delete(clusterCIDR.AssociatedNodes, node.Name)
 
+		// The released CIDRs can be allocated to the nodes waiting for one.
+		if nodeSelector, ok := r.clusterCIDRSelectorKey(clusterCIDR); ok && !held {
+			r.retryPendingNodes(logger, nodeSelector)
+		}
+	}
 	return nil
 }
 
@@ -721,12 +1119,14 @@ func (r *multiCIDRRangeAllocator) occupyServiceCIDR(clusterCIDR *cidrset.Cluster
 }
 
 // updateCIDRsAllocation assigns CIDR to Node and sends an update to the API server.
-func (r *multiCIDRRangeAllocator) updateCIDRsAllocation(logger klog.Logger, data multiCIDRNodeReservedCIDRs) error {
+// It returns the PodCIDRAssigned condition to report on the node, if any.
+func (r *multiCIDRRangeAllocator) updateCIDRsAllocation(ctx context.Context, data multiCIDRNodeReservedCIDRs) (*podCIDRAssignment, error) {
+	logger := klog.FromContext(ctx)
 	cidrsString := ipnetToStringList(data.allocatedCIDRs)
 	node, err := r.nodeLister.Get(data.nodeName)
 	if err != nil {
 		logger.Error(err, "Failed while getting node for updating Node.Spec.PodCIDRs", "node", klog.KRef("", data.nodeName))
-		return err
+		return nil, err
 	}
 
 	// if cidr list matches the proposed,
@@ -742,46 +1142,89 @@ func (r *multiCIDRRangeAllocator) updateCIDRsAllocation(logger klog.Logger, data
 		}
 		if match {
 			logger.V(4).Info("Node already has allocated CIDR. It matches the proposed one.", "node", klog.KObj(node), "CIDRs", data.allocatedCIDRs)
-			return nil
+			return nil, nil
 		}
 	}
 
 	// node has cidrs allocated, release the reserved.
 	if len(node.Spec.PodCIDRs) != 0 {
 		logger.Error(nil, "Node already has a CIDR allocated. Releasing the new one", "node", klog.KObj(node), "podCIDRs", node.Spec.PodCIDRs)
-		for _, cidr := range data.allocatedCIDRs {
-			if err := r.Release(logger, data.clusterCIDR, cidr); err != nil {
-				return fmt.Errorf("failed to release cidr %s from clusterCIDR %s for node: %s: %w", cidr, data.clusterCIDR.Name, node.Name, err)
+		for i, cidr := range data.allocatedCIDRs {
+			if err := r.Unreserve(logger, data.clusterCIDRs[i], cidr); err != nil {
+				return nil, fmt.Errorf("failed to release cidr %s from clusterCIDR %s for node: %s: %w", cidr, data.clusterCIDRs[i].Name, node.Name, err)
 			}
 		}
-		return nil
+		return nil, nil
 	}
 
-	// If we reached here, it means that the node has no CIDR currently assigned. So we set it.
-	for i := 0; i < cidrUpdateRetries; i++ {
-		if err = nodeutil.PatchNodeCIDRs(context.Background(), r.client, types.NodeName(node.Name), cidrsString); err == nil {
-			data.clusterCIDR.AssociatedNodes[node.Name] = true
-			logger.Info("Set node PodCIDR", "node", klog.KObj(node), "podCIDR", cidrsString)
-			return nil
+	// If we reached here, it means that the node has no CIDR currently assigned.
+	// With RecordAllocationIntent, the reserved CIDRs are recorded on the node
+	// first, so that they stay reserved across restarts if the outcome of the
+	// podCIDRs patch is unknown.
+	resourceVersion := r.patchResourceVersion(node)
+	recordIntent := r.allocatorParams.RecordAllocationIntent
+	if intent := newAllocationIntent(data); recordIntent && !recordsAllocationIntent(node, intent) {
+		patched, err := r.recordAllocationIntent(ctx, node.Name, resourceVersion, intent)
+		if err != nil {
+			nodeCIDRPatchErrors.WithLabelValues(patchErrorReason(err)).Inc()
+			// The intent may have been recorded if the request timed out,
+			// the CIDRs are then leaked until the intent is resolved.
+			if !apierrors.IsServerTimeout(err) {
+				logger.V(2).Info("Failed to record the allocation intent, releasing the reserved CIDRs", "node", klog.KObj(node), "podCIDR", cidrsString, "err", err)
+				r.releaseReservedCIDRs(logger, data.allocatedCIDRs, data.clusterCIDRs)
+			}
+			return nil, fmt.Errorf("failed to record the allocation intent of node %s: %w", node.Name, err)
+		}
+		if resourceVersion != "" {
+			resourceVersion = patched.ResourceVersion
 		}
 	}
 
-	// failed release back to the pool.
-	logger.Error(err, "Failed to update node PodCIDR after attempts", "node", klog.KObj(node), "podCIDR", cidrsString, "retries", cidrUpdateRetries)
-	controllerutil.RecordNodeStatusChange(logger, r.recorder, node, "CIDRAssignmentFailed")
-	// We accept the fact that we may leak CIDRs here. This is safer than releasing
-	// them in case when we don't know if request went through.
-	// NodeController restart will return all falsely allocated CIDRs to the pool.
-	if !apierrors.IsServerTimeout(err) {
-		logger.Error(err, "CIDR assignment for node failed. Releasing allocated CIDR", "node", klog.KObj(node))
-		for _, cidr := range data.allocatedCIDRs {
-			if err := r.Release(logger, data.clusterCIDR, cidr); err != nil {
-				return fmt.Errorf("failed to release cidr %q from clusterCIDR %q for node: %q: %w", cidr, data.clusterCIDR.Name, node.Name, err)
+	// Once the intent is recorded, the reserved CIDRs are kept until it is
+	// resolved: a failed node is synced again and resumes the intent.
+	// Otherwise they are released, unless the outcome of the patch is unknown.
+	for i := 0; i < cidrUpdateRetries; i++ {
+		patchCtx, span := r.tracer.Start(ctx, "PatchNodeCIDRs", trace.WithAttributes(
+			attribute.StringSlice("podCIDRs", cidrsString),
+			attribute.Int("attempt", i+1),
+		))
+		err = r.patchNodeCIDRs(patchCtx, node.Name, resourceVersion, cidrsString, clusterCIDRNames(data.clusterCIDRs))
+		endSpan(span, err)
+		if err == nil {
+			for _, clusterCIDR := range distinctClusterCIDRs(data.clusterCIDRs) {
+				clusterCIDR.AssociatedNodes[node.Name] = true
 			}
+			r.pendingNodes.remove(node.Name)
+			nodeCIDRAllocationDuration.Observe(time.Since(node.CreationTimestamp.Time).Seconds())
+			logger.Info("Set node PodCIDR", "node", klog.KObj(node), "podCIDR", cidrsString)
+			return podCIDRAssigned, nil
+		}
+		nodeCIDRPatchErrors.WithLabelValues(patchErrorReason(err)).Inc()
+		if apierrors.IsConflict(err) {
+			// Another replica updated the node first, the node is synced again
+			// and the intent resolved with its podCIDRs.
+			if recordIntent {
+				logger.V(2).Info("Node changed since it was read, keeping the CIDRs of the allocation intent", "node", klog.KObj(node), "podCIDR", cidrsString)
+				return nil, err
+			}
+			logger.V(2).Info("Node changed since it was read, releasing the reserved CIDRs", "node", klog.KObj(node), "podCIDR", cidrsString)
+			r.releaseReservedCIDRs(logger, data.allocatedCIDRs, data.clusterCIDRs)
+			return nil, err
 		}
 	}
 
-	return err
+	if recordIntent {
+		logger.Error(err, "Failed to update node PodCIDR after attempts, keeping the CIDRs of the allocation intent", "node", klog.KObj(node), "podCIDR", cidrsString, "retries", cidrUpdateRetries)
+	} else {
+		logger.Error(err, "Failed to update node PodCIDR after attempts", "node", klog.KObj(node), "podCIDR", cidrsString, "retries", cidrUpdateRetries)
+		// The CIDRs are leaked if the request timed out, the node may have
+		// them. Restarting the controller returns them to the pool.
+		if !apierrors.IsServerTimeout(err) {
+			r.releaseReservedCIDRs(logger, data.allocatedCIDRs, data.clusterCIDRs)
+		}
+	}
+	controllerutil.RecordNodeStatusChange(logger, r.recorder, node, "CIDRAssignmentFailed")
+	return podCIDRUnassigned(PodCIDRAssignedReasonPatchFailed, err.Error()), err
 }
 
 // defaultNodeSelector generates a label with defaultClusterCIDRKey as the key and
@@ -807,45 +1250,104 @@ func defaultNodeSelector() *corev1.NodeSelector {
 // prioritizedCIDRs returns a list of CIDRs to be allocated to the node.
 // Returns 1 CIDR  if single stack.
 // Returns 2 CIDRs , 1 from each ip family if dual stack.
+// The ClusterCIDRs considered and the outcome are recorded in decision.
 func (r *multiCIDRRangeAllocator) prioritizedCIDRs(
-	logger klog.Logger, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR,
+	ctx context.Context, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR, decision *allocationDecision,
 ) ([]*net.IPNet, *cidrset.ClusterCIDR, error) {
-	clusterCIDRList, err := r.orderedMatchingClusterCIDRs(node, true, cidrMap)
+	logger := klog.FromContext(ctx)
+	_, span := r.tracer.Start(ctx, "matchClusterCIDRs")
+	ranked, err := r.rankedClusterCIDRs(node, cidrMap)
+	span.SetAttributes(attribute.Int("matchingClusterCIDRs", len(ranked)))
+	endSpan(span, err)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, err)
 	}
+	decision.addCandidates(ranked)
+
+	usable := 0
+	for i, pqItem := range ranked {
+		clusterCIDR := pqItem.clusterCIDR
+		// Only use the CIDRsets which are not marked for termination.
+		if clusterCIDR.Terminating && !pqItem.catchAll {
+			decision.setOutcome(i, candidateTerminating, nil)
+			continue
+		}
+		if r.shadowedClusterCIDR(clusterCIDR, cidrMap) {
+			decision.setOutcome(i, candidateOverlapping, nil)
+			continue
+		}
+		usable++
+		if !r.ownsClusterCIDRShard(clusterCIDR.Name) {
+			decision.setOutcome(i, candidateOtherShard, nil)
+			continue
+		}
+
+		if pairsFamilies(clusterCIDR) {
+			cidrs, err := r.allocatePairedCIDRs(ctx, node, clusterCIDR, cidrMap)
+			if err != nil {
+				logger.V(3).Info("Unable to allocate paired IPv4 and IPv6 CIDRs, trying next range", "err", err)
+				decision.setOutcome(i, candidateExhausted, err)
+				continue
+			}
+			decision.selected(i, ipnetToStringList(cidrs))
+			return cidrs, clusterCIDR, nil
+		}
 
-	for _, clusterCIDR := range clusterCIDRList {
 		cidrs := make([]*net.IPNet, 0)
 		if clusterCIDR.IPv4CIDRSet != nil {
-			cidr, err := r.allocateCIDR(logger, clusterCIDR, clusterCIDR.IPv4CIDRSet, cidrMap)
+			cidr, err := r.allocateCIDR(ctx, node, clusterCIDR, clusterCIDR.IPv4CIDRSet, cidrMap)
 			if err != nil {
 				logger.V(3).Info("Unable to allocate IPv4 CIDR, trying next range", "err", err)
+				decision.setOutcome(i, candidateExhausted, err)
 				continue
 			}
 			cidrs = append(cidrs, cidr)
 		}
 
 		if clusterCIDR.IPv6CIDRSet != nil {
-			cidr, err := r.allocateCIDR(logger, clusterCIDR, clusterCIDR.IPv6CIDRSet, cidrMap)
+			cidr, err := r.allocateCIDR(ctx, node, clusterCIDR, clusterCIDR.IPv6CIDRSet, cidrMap)
 			if err != nil {
 				logger.V(3).Info("Unable to allocate IPv6 CIDR, trying next range", "err", err)
+				decision.setOutcome(i, candidateExhausted, err)
+				r.releaseReservedCIDRs(logger, cidrs, []*cidrset.ClusterCIDR{clusterCIDR})
 				continue
 			}
 			cidrs = append(cidrs, cidr)
 		}
 
+		decision.selected(i, ipnetToStringList(cidrs))
 		return cidrs, clusterCIDR, nil
 	}
-	return nil, nil, fmt.Errorf("unable to get a clusterCIDR for node %s, no available CIDRs", node.Name)
+	if usable == 0 {
+		return nil, nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, errNoMatchingClusterCIDR)
+	}
+	return nil, nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, errClusterCIDRsExhausted)
 }
 
 // allocateCIDR requires the caller to hold r.lock.
+// allocateCIDR allocates a CIDR of the cidrSet to the node, following the
+// allocation strategy of the ClusterCIDR.
 func (r *multiCIDRRangeAllocator) allocateCIDR(
-	logger klog.Logger, clusterCIDR *cidrset.ClusterCIDR, cidrSet *cidrset.MultiCIDRSet, cidrMap map[string][]*cidrset.ClusterCIDR,
-) (*net.IPNet, error) {
-	for evaluated := 0; evaluated < cidrSet.MaxCIDRs; evaluated++ {
-		candidate, lastEvaluated, err := cidrSet.NextCandidate()
+	ctx context.Context, node *corev1.Node, clusterCIDR *cidrset.ClusterCIDR, cidrSet *cidrset.MultiCIDRSet, cidrMap map[string][]*cidrset.ClusterCIDR,
+) (cidr *net.IPNet, err error) {
+	logger := klog.FromContext(ctx)
+	_, span := r.tracer.Start(ctx, "allocateCIDR", trace.WithAttributes(
+		attribute.String("clusterCIDR", clusterCIDR.Name),
+		attribute.String("cidrSet", cidrSet.Label),
+		attribute.String("strategy", string(allocationStrategyType(clusterCIDR))),
+	))
+	evaluated := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("evaluated", evaluated))
+		if cidr != nil {
+			span.SetAttributes(attribute.String("cidr", cidr.String()))
+		}
+		endSpan(span, err)
+	}()
+
+	nextCandidate := candidateProber(logger, node, clusterCIDR, cidrSet)
+	for ; evaluated < cidrSet.MaxCIDRs; evaluated++ {
+		candidate, lastEvaluated, err := nextCandidate()
 		if err != nil {
 			return nil, err
 		}
@@ -915,6 +1417,10 @@ func (r *multiCIDRRangeAllocator) cidrOverlapWithAllocatedList(logger klog.Logge
 // allocatedClusterCIDR requires the caller to hold r.lock.
 // allocatedClusterCIDR returns the ClusterCIDR from which the node CIDRs were allocated.
 func (r *multiCIDRRangeAllocator) allocatedClusterCIDR(node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) (*cidrset.ClusterCIDR, error) {
+	if clusterCIDR := recordedClusterCIDR(node, cidrMap); clusterCIDR != nil && clusterCIDR.AssociatedNodes[node.Name] {
+		return clusterCIDR, nil
+	}
+
 	clusterCIDRList, err := r.orderedMatchingClusterCIDRs(node, false, cidrMap)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, err)
@@ -928,6 +1434,20 @@ func (r *multiCIDRRangeAllocator) allocatedClusterCIDR(node *corev1.Node, cidrMa
 	return nil, fmt.Errorf("no clusterCIDR found associated with node: %s", node.Name)
 }
 
+// allocatedClusterCIDRs requires the caller to hold r.lock.
+// allocatedClusterCIDRs returns the ClusterCIDR from which each of the node
+// CIDRs was allocated.
+func (r *multiCIDRRangeAllocator) allocatedClusterCIDRs(node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*cidrset.ClusterCIDR, error) {
+	if r.selectsPerFamily(node) {
+		return r.allocatedClusterCIDRsPerFamily(node, cidrMap)
+	}
+	clusterCIDR, err := r.allocatedClusterCIDR(node, cidrMap)
+	if err != nil {
+		return nil, err
+	}
+	return repeatClusterCIDR(clusterCIDR, len(node.Spec.PodCIDRs)), nil
+}
+
 // orderedMatchingClusterCIDRs requires the caller to hold r.lock.
 // orderedMatchingClusterCIDRs returns a list of all the ClusterCIDRs matching the node labels.
 // The list is ordered with the following priority, which act as tie-breakers.
@@ -941,7 +1461,27 @@ func (r *multiCIDRRangeAllocator) allocatedClusterCIDR(node *corev1.Node, cidrMa
 // is called during an occupy or a release operation. For a release operation, a ClusterCIDR must
 // be added to the matching ClusterCIDRs list, irrespective of whether the ClusterCIDR is terminating.
 func (r *multiCIDRRangeAllocator) orderedMatchingClusterCIDRs(node *corev1.Node, occupy bool, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*cidrset.ClusterCIDR, error) {
-	matchingCIDRs := make([]*cidrset.ClusterCIDR, 0)
+	ranked, err := r.rankedClusterCIDRs(node, cidrMap)
+	if err != nil {
+		return nil, err
+	}
+
+	matchingCIDRs := make([]*cidrset.ClusterCIDR, 0, len(ranked))
+	for _, pqItem := range ranked {
+		// Only use the CIDRsets which are not marked for termination.
+		// Always use the CIDRsets when marked for release.
+		if !occupy || pqItem.catchAll || !pqItem.clusterCIDR.Terminating {
+			matchingCIDRs = append(matchingCIDRs, pqItem.clusterCIDR)
+		}
+	}
+	return matchingCIDRs, nil
+}
+
+// rankedClusterCIDRs requires the caller to hold r.lock.
+// rankedClusterCIDRs returns the PriorityQueueItems of all the ClusterCIDRs
+// matching the node, including the terminating ones, in priority order.
+func (r *multiCIDRRangeAllocator) rankedClusterCIDRs(node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*PriorityQueueItem, error) {
+	ranked := make([]*PriorityQueueItem, 0)
 	pq := make(PriorityQueue, 0)
 
 	for label, clusterCIDRList := range cidrMap {
@@ -960,12 +1500,7 @@ func (r *multiCIDRRangeAllocator) orderedMatchingClusterCIDRs(node *corev1.Node,
 				labelMatchCount: matchCnt,
 				selectorString:  label,
 			}
-
-			// Only push the CIDRsets which are not marked for termination.
-			// Always push the CIDRsets when marked for release.
-			if !occupy || !clusterCIDR.Terminating {
-				heap.Push(&pq, pqItem)
-			}
+			heap.Push(&pq, pqItem)
 		}
 	}
 
@@ -974,7 +1509,7 @@ func (r *multiCIDRRangeAllocator) orderedMatchingClusterCIDRs(node *corev1.Node,
 	// if matchCnt is equal it is ordered in ascending order of labels.
 	for pq.Len() > 0 {
 		pqItem := heap.Pop(&pq).(*PriorityQueueItem)
-		matchingCIDRs = append(matchingCIDRs, pqItem.clusterCIDR)
+		ranked = append(ranked, pqItem)
 	}
 
 	// Append the catch all CIDR config.
@@ -982,10 +1517,14 @@ func (r *multiCIDRRangeAllocator) orderedMatchingClusterCIDRs(node *corev1.Node,
 	if err != nil {
 		return nil, err
 	}
-	if clusterCIDRList, ok := cidrMap[defaultSelector.String()]; ok {
-		matchingCIDRs = append(matchingCIDRs, clusterCIDRList...)
+	for _, clusterCIDR := range cidrMap[defaultSelector.String()] {
+		ranked = append(ranked, &PriorityQueueItem{
+			clusterCIDR:    clusterCIDR,
+			selectorString: defaultSelector.String(),
+			catchAll:       true,
+		})
 	}
-	return matchingCIDRs, nil
+	return ranked, nil
 }
 
 // matchCIDRLabels Matches the Node labels to CIDR Configs.
@@ -1050,6 +1589,9 @@ func createDefaultClusterCIDR(logger klog.Logger, existingConfigList *v1.Cluster
 			PerNodeHostBits: minPerNodeHostBits,
 		},
 	}
+	if allocatorParams.ControllerName != v1.DefaultControllerName {
+		defaultCIDRConfig.Spec.ControllerName = allocatorParams.ControllerName
+	}
 
 	ipv4PerNodeHostBits := int32(math.MinInt32)
 	ipv6PerNodeHostBits := int32(math.MinInt32)
@@ -1088,6 +1630,34 @@ func createDefaultClusterCIDR(logger klog.Logger, existingConfigList *v1.Cluster
 	existingConfigList.Items = append(existingConfigList.Items, *defaultCIDRConfig)
 }
 
+// ensureDefaultClusterCIDR creates the default ClusterCIDR once the allocator
+// owns its shard, if it is configured and does not exist yet. Standby replicas
+// and the replicas not owning its shard only load it during bootstrap.
+func (r *multiCIDRRangeAllocator) ensureDefaultClusterCIDR(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	if _, err := r.clusterCIDRLister.Get(defaultClusterCIDRName); !apierrors.IsNotFound(err) {
+		return
+	}
+	ccList := &v1.ClusterCIDRList{}
+	createDefaultClusterCIDR(logger, ccList, r.allocatorParams)
+	if len(ccList.Items) == 0 {
+		return
+	}
+
+	r.lock.Lock()
+	owned := r.ownsClusterCIDRShard(defaultClusterCIDRName)
+	r.lock.Unlock()
+	if !owned {
+		return
+	}
+
+	defaultCIDRConfig := &ccList.Items[0]
+	defaultCIDRConfig.Finalizers = []string{clusterCIDRFinalizer}
+	if _, err := r.networkClient.Create(ctx, defaultCIDRConfig, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create the default ClusterCIDR", "clusterCIDR", defaultClusterCIDRName)
+	}
+}
+
 // reconcileCreate handles create ClusterCIDR events.
 func (r *multiCIDRRangeAllocator) reconcileCreate(ctx context.Context, clusterCIDR *v1.ClusterCIDR) error {
 	r.lock.Lock()
@@ -1099,9 +1669,43 @@ func (r *multiCIDRRangeAllocator) reconcileCreate(ctx context.Context, clusterCI
 		logger.Error(err, "failed to reconcile ClusterCIDR", "clusterCIDR", clusterCIDR.Name)
 		return err
 	}
+	if clusterCIDRSet := clusterCIDRByName(clusterCIDR.Name, r.cidrMap); clusterCIDRSet != nil && r.shadowedClusterCIDR(clusterCIDRSet, r.cidrMap) {
+		r.recorder.Event(clusterCIDR, corev1.EventTypeWarning, "OverlappingClusterCIDR", "ClusterCIDR overlaps an older ClusterCIDR of another shard and is not allocated from")
+	}
+
+	// The new ClusterCIDR may have room for the nodes waiting for a podCIDR.
+	if nodeSelector, err := r.nodeSelectorKey(clusterCIDR); err == nil {
+		r.retryPendingNodes(logger, nodeSelector)
+	}
 	return nil
 }
 
+// retryPendingNodes re-enqueues the pending nodes matching the node selector
+// key without waiting for their rate limited retry.
+func (r *multiCIDRRangeAllocator) retryPendingNodes(logger klog.Logger, nodeSelector string) {
+	nodes := r.pendingNodes.matching(nodeSelector)
+	if len(nodes) == 0 {
+		return
+	}
+	logger.V(2).Info("Re-enqueuing pending nodes", "nodeSelector", nodeSelector, "count", len(nodes))
+	for _, node := range nodes {
+		r.nodeQueue.Forget(node)
+		r.enqueueNode(node)
+	}
+}
+
+// clusterCIDRSelectorKey requires the caller to hold r.lock.
+// clusterCIDRSelectorKey returns the node selector key under which the
+// ClusterCIDR is mapped in the cidrMap.
+func (r *multiCIDRRangeAllocator) clusterCIDRSelectorKey(clusterCIDR *cidrset.ClusterCIDR) (string, bool) {
+	for nodeSelector, clusterCIDRList := range r.cidrMap {
+		if slices.Contains(clusterCIDRList, clusterCIDR) {
+			return nodeSelector, true
+		}
+	}
+	return "", false
+}
+
 // reconcileBootstrap handles creation of existing ClusterCIDRs.
 // adds a finalizer if not already present.
 func (r *multiCIDRRangeAllocator) reconcileBootstrap(ctx context.Context, clusterCIDR *v1.ClusterCIDR) error {
@@ -1131,16 +1735,16 @@ func (r *multiCIDRRangeAllocator) reconcileBootstrap(ctx context.Context, cluste
 func (r *multiCIDRRangeAllocator) createClusterCIDR(ctx context.Context, clusterCIDR *v1.ClusterCIDR, terminating bool, cidrMap map[string][]*cidrset.ClusterCIDR) error {
 	nodeSelector, err := r.nodeSelectorKey(clusterCIDR)
 	if err != nil {
-		return fmt.Errorf("unable to get labelSelector key: %w", err)
+		return &invalidClusterCIDRErr{name: clusterCIDR.Name, err: fmt.Errorf("unable to get labelSelector key: %w", err)}
 	}
 
 	clusterCIDRSet, err := r.createClusterCIDRSet(clusterCIDR, terminating)
 	if err != nil {
-		return fmt.Errorf("invalid ClusterCIDR: %w", err)
+		return &invalidClusterCIDRErr{name: clusterCIDR.Name, err: err}
 	}
 
 	if clusterCIDRSet.IPv4CIDRSet == nil && clusterCIDRSet.IPv6CIDRSet == nil {
-		return errors.New("invalid ClusterCIDR: must provide IPv4 and/or IPv6 config")
+		return &invalidClusterCIDRErr{name: clusterCIDR.Name, err: errors.New("must provide IPv4 and/or IPv6 config")}
 	}
 
 	if err := r.mapClusterCIDRSet(cidrMap, nodeSelector, clusterCIDRSet); err != nil {
@@ -1153,10 +1757,17 @@ func (r *multiCIDRRangeAllocator) createClusterCIDR(ctx context.Context, cluster
 		updatedClusterCIDR.Finalizers = append(updatedClusterCIDR.Finalizers, clusterCIDRFinalizer)
 	}
 
+	// Standby replicas and the replicas not owning the shard of the ClusterCIDR
+	// only load it, see ensureDefaultClusterCIDR.
+	if !r.ownsClusterCIDRShard(clusterCIDR.Name) {
+		return nil
+	}
+
 	logger := klog.FromContext(ctx)
 	if updatedClusterCIDR.ResourceVersion == "" {
-		// Create is only used for creating default ClusterCIDR.
-		if _, err := r.networkClient.Create(ctx, updatedClusterCIDR, metav1.CreateOptions{}); err != nil {
+		// Create is only used for creating default ClusterCIDR. It may already
+		// exist if a previous bootstrap attempt created it.
+		if _, err := r.networkClient.Create(ctx, updatedClusterCIDR, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
 			logger.V(2).Info("failed to create ClusterCIDR", "clusterCIDR", klog.KObj(clusterCIDR), "err", err)
 			return err
 		}
@@ -1174,9 +1785,11 @@ func (r *multiCIDRRangeAllocator) createClusterCIDR(ctx context.Context, cluster
 // createClusterCIDRSet creates and returns new cidrset.ClusterCIDR based on ClusterCIDR API object.
 func (r *multiCIDRRangeAllocator) createClusterCIDRSet(clusterCIDR *v1.ClusterCIDR, terminating bool) (*cidrset.ClusterCIDR, error) {
 	clusterCIDRSet := &cidrset.ClusterCIDR{
-		Name:            clusterCIDR.Name,
-		AssociatedNodes: make(map[string]bool, 0),
-		Terminating:     terminating,
+		Name:               clusterCIDR.Name,
+		AssociatedNodes:    make(map[string]bool, 0),
+		Terminating:        terminating,
+		CreationTimestamp:  clusterCIDR.CreationTimestamp.Time,
+		AllocationStrategy: clusterCIDR.Spec.AllocationStrategy.DeepCopy(),
 	}
 
 	if clusterCIDR.Spec.IPv4 != "" {
@@ -1205,6 +1818,13 @@ func (r *multiCIDRRangeAllocator) createClusterCIDRSet(clusterCIDR *v1.ClusterCI
 		}
 	}
 
+	reuseCooldown := time.Duration(clusterCIDR.Spec.ReuseCooldownSeconds) * time.Second
+	for _, cidrSet := range []*cidrset.MultiCIDRSet{clusterCIDRSet.IPv4CIDRSet, clusterCIDRSet.IPv6CIDRSet} {
+		if cidrSet != nil {
+			cidrSet.SetReuseCooldown(reuseCooldown)
+		}
+	}
+
 	return clusterCIDRSet, nil
 }
 
@@ -1225,6 +1845,7 @@ func (r *multiCIDRRangeAllocator) mapClusterCIDRSet(cidrMap map[string][]*cidrse
 	} else {
 		cidrMap[nodeSelector] = []*cidrset.ClusterCIDR{clusterCIDRSet}
 	}
+	r.capacityChanged()
 	return nil
 }
 
@@ -1241,6 +1862,10 @@ func (r *multiCIDRRangeAllocator) reconcileDelete(ctx context.Context, clusterCI
 			logger.V(2).Info("Error while deleting ClusterCIDR", "err", err)
 			return err
 		}
+		if !r.ownsClusterCIDRShard(clusterCIDR.Name) {
+			// The replica owning the shard removes the finalizer.
+			return nil
+		}
 		// Remove the finalizer as delete is successful.
 		cccCopy := clusterCIDR.DeepCopy()
 		cccCopy.Finalizers = slices.DeleteFunc(cccCopy.Finalizers, func(s string) bool {
@@ -1277,6 +1902,7 @@ func (r *multiCIDRRangeAllocator) deleteClusterCIDR(logger klog.Logger, clusterC
 
 		// Mark clusterCIDRSet as terminating.
 		clusterCIDRSet.Terminating = true
+		r.capacityChanged()
 
 		// Allow deletion only if no nodes are associated with the ClusterCIDR.
 		if len(clusterCIDRSet.AssociatedNodes) > 0 {
@@ -1287,6 +1913,7 @@ func (r *multiCIDRRangeAllocator) deleteClusterCIDR(logger klog.Logger, clusterC
 		// with it.
 		if len(clusterCIDRSetList) == 1 {
 			delete(cidrMap, labelSelector)
+			r.pendingNodes.forget(labelSelector)
 			return nil
 		}
 
@@ -1315,39 +1942,6 @@ func (r *multiCIDRRangeAllocator) nodeSelectorKey(clusterCIDR *v1.ClusterCIDR) (
 	return nodeSelector.String(), nil
 }
 
-func listClusterCIDRs(ctx context.Context, networkClient clustercidrclient.ClusterCIDRInterface) (*v1.ClusterCIDRList, error) {
-	var clusterCIDRList *v1.ClusterCIDRList
-	// We must poll because apiserver might not be up. This error causes
-	// controller manager to restart.
-	startTimestamp := time.Now()
-
-	// start with 2s, multiply the duration by 1.6 each step, 11 steps = 9.7 minutes
-	backoff := wait.Backoff{
-		Duration: 2 * time.Second,
-		Factor:   1.6,
-		Steps:    11,
-	}
-
-	logger := klog.FromContext(ctx)
-	if pollErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		var err error
-		clusterCIDRList, err = networkClient.List(ctx, metav1.ListOptions{
-			FieldSelector: fields.Everything().String(),
-			LabelSelector: labels.Everything().String(),
-		})
-		if err != nil {
-			logger.Error(err, "Failed to list all clusterCIDRs")
-			return false, nil
-		}
-		return true, nil
-	}); pollErr != nil {
-		logger.Error(nil, "Failed to list clusterCIDRs", "latency", time.Since(startTimestamp))
-		return nil, fmt.Errorf("failed to list all clusterCIDRs in %v, cannot proceed without updating CIDR map",
-			apiserverStartupGracePeriod)
-	}
-	return clusterCIDRList, nil
-}
-
 // nodeSelectorRequirementsAsLabelRequirements converts the NodeSelectorRequirement
 // type to a labels.Requirement type.
 func nodeSelectorRequirementsAsLabelRequirements(nsr corev1.NodeSelectorRequirement) (*labels.Requirement, error) {
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -311,9 +312,11 @@ func TestMultiCIDROccupyPreExistingCIDR(t *testing.T) {
 			fakeClient := &clustercidrfake.Clientset{}
 			fakeInformerFactory := clustercidrinformer.NewSharedInformerFactory(fakeClient, NoResyncPeriodFunc())
 			fakeClusterCIDRInformer := fakeInformerFactory.Networking().V1().ClusterCIDRs()
-			nodeList, _ := tc.fakeNodeHandler.List(context.TODO(), metav1.ListOptions{})
 			fakeCIDRClient := clustercidrfake.NewSimpleClientset().NetworkingV1().ClusterCIDRs() //nolint:staticcheck // see https://github.com/kubernetes/kubernetes/issues/126850
-			_, err := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, fakeNodeInformer, fakeClusterCIDRInformer, tc.allocatorParams, nodeList, tc.testCIDRMap)
+			allocator, err := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, fakeNodeInformer, fakeClusterCIDRInformer, tc.allocatorParams, tc.testCIDRMap)
+			if err == nil {
+				err = allocator.(*multiCIDRRangeAllocator).bootstrap(ctx)
+			}
 			if err == nil && tc.ctrlCreateFail {
 				t.Fatalf("creating range allocator was expected to fail, but it did not")
 			}
@@ -1014,18 +1017,17 @@ func TestMultiCIDRAllocateOrOccupyCIDRSuccess(t *testing.T) {
 		},
 	}
 
-	logger, ctx := ktesting.NewTestContext(t)
+	_, ctx := ktesting.NewTestContext(t)
 
 	// test function
 	testFunc := func(tc testCaseMultiCIDR) {
-		nodeList, _ := tc.fakeNodeHandler.List(context.TODO(), metav1.ListOptions{})
 		// Initialize the range allocator.
 
 		fakeClient := &clustercidrfake.Clientset{}
 		fakeInformerFactory := clustercidrinformer.NewSharedInformerFactory(fakeClient, NoResyncPeriodFunc())
 		fakeClusterCIDRInformer := fakeInformerFactory.Networking().V1().ClusterCIDRs()
 		fakeCIDRClient := clustercidrfake.NewSimpleClientset().NetworkingV1().ClusterCIDRs() //nolint:staticcheck // see https://github.com/kubernetes/kubernetes/issues/126850
-		allocator, err := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, test.FakeNodeInformer(tc.fakeNodeHandler), fakeClusterCIDRInformer, tc.allocatorParams, nodeList, tc.testCIDRMap)
+		allocator, err := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, test.FakeNodeInformer(tc.fakeNodeHandler), fakeClusterCIDRInformer, tc.allocatorParams, tc.testCIDRMap)
 		if err != nil {
 			t.Errorf("%v: failed to create CIDRRangeAllocator with error %v", tc.description, err)
 			return
@@ -1039,6 +1041,9 @@ func TestMultiCIDRAllocateOrOccupyCIDRSuccess(t *testing.T) {
 		// todo(mneverov)
 		// rangeAllocator.recorder = test.NewFakeRecorder()
 		rangeAllocator.recorder = &record.FakeRecorder{}
+		if err := rangeAllocator.bootstrap(ctx); err != nil {
+			t.Fatalf("%v: failed to bootstrap CIDRRangeAllocator with error %v", tc.description, err)
+		}
 
 		// this is a bit of white box testing
 		// pre allocate the CIDRs as per the test
@@ -1074,7 +1079,7 @@ func TestMultiCIDRAllocateOrOccupyCIDRSuccess(t *testing.T) {
 			if node.Spec.PodCIDRs == nil {
 				updateCount++
 			}
-			if err := allocator.AllocateOrOccupyCIDR(logger, node); err != nil {
+			if err := allocator.AllocateOrOccupyCIDR(ctx, node); err != nil {
 				t.Errorf("%v: unexpected error in AllocateOrOccupyCIDR: %v", tc.description, err)
 			}
 		}
@@ -1089,7 +1094,7 @@ func TestMultiCIDRAllocateOrOccupyCIDRSuccess(t *testing.T) {
 			// nothing further expected
 			return
 		}
-		for _, updatedNode := range tc.fakeNodeHandler.GetUpdatedNodesCopy() {
+		for _, updatedNode := range podCIDRUpdates(tc.fakeNodeHandler) {
 			if len(updatedNode.Spec.PodCIDRs) == 0 {
 				continue // not assigned yet
 			}
@@ -1322,7 +1327,7 @@ func TestMultiCIDRAllocateOrOccupyCIDRFailure(t *testing.T) {
 		},
 	}
 
-	logger, ctx := ktesting.NewTestContext(t)
+	_, ctx := ktesting.NewTestContext(t)
 
 	testFunc := func(tc testCaseMultiCIDR) {
 		fakeClient := &clustercidrfake.Clientset{}
@@ -1330,7 +1335,7 @@ func TestMultiCIDRAllocateOrOccupyCIDRFailure(t *testing.T) {
 		fakeClusterCIDRInformer := fakeInformerFactory.Networking().V1().ClusterCIDRs()
 		fakeCIDRClient := clustercidrfake.NewSimpleClientset().NetworkingV1().ClusterCIDRs() //nolint:staticcheck // see https://github.com/kubernetes/kubernetes/issues/126850
 		// Initialize the range allocator.
-		allocator, err := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, test.FakeNodeInformer(tc.fakeNodeHandler), fakeClusterCIDRInformer, tc.allocatorParams, nil, tc.testCIDRMap)
+		allocator, err := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, test.FakeNodeInformer(tc.fakeNodeHandler), fakeClusterCIDRInformer, tc.allocatorParams, tc.testCIDRMap)
 		if err != nil {
 			t.Logf("%v: failed to create CIDRRangeAllocator with error %v", tc.description, err)
 		}
@@ -1341,6 +1346,9 @@ func TestMultiCIDRAllocateOrOccupyCIDRFailure(t *testing.T) {
 		}
 		rangeAllocator.nodesSynced = test.AlwaysReady
 		rangeAllocator.recorder = &record.FakeRecorder{}
+		if err := rangeAllocator.loadClusterCIDRs(ctx); err != nil {
+			t.Fatalf("%v: failed to load ClusterCIDRs with error %v", tc.description, err)
+		}
 
 		// this is a bit of white box testing
 		// pre allocate the CIDRs as per the test
@@ -1371,19 +1379,19 @@ func TestMultiCIDRAllocateOrOccupyCIDRFailure(t *testing.T) {
 			}
 		}
 
-		if err := allocator.AllocateOrOccupyCIDR(logger, tc.fakeNodeHandler.Existing[0]); err == nil {
+		if err := allocator.AllocateOrOccupyCIDR(ctx, tc.fakeNodeHandler.Existing[0]); err == nil {
 			t.Errorf("%v: unexpected success in AllocateOrOccupyCIDR: %v", tc.description, err)
 		}
 		// We don't expect any updates, so just sleep for some time
 		time.Sleep(time.Second)
-		if len(tc.fakeNodeHandler.GetUpdatedNodesCopy()) != 0 {
-			t.Fatalf("%v: unexpected update of nodes: %v", tc.description, tc.fakeNodeHandler.GetUpdatedNodesCopy())
+		if len(podCIDRUpdates(tc.fakeNodeHandler)) != 0 {
+			t.Fatalf("%v: unexpected update of nodes: %v", tc.description, podCIDRUpdates(tc.fakeNodeHandler))
 		}
 		if len(tc.expectedAllocatedCIDR) == 0 {
 			// nothing further expected
 			return
 		}
-		for _, updatedNode := range tc.fakeNodeHandler.GetUpdatedNodesCopy() {
+		for _, updatedNode := range podCIDRUpdates(tc.fakeNodeHandler) {
 			if len(updatedNode.Spec.PodCIDRs) == 0 {
 				continue // not assigned yet
 			}
@@ -1518,14 +1526,14 @@ func TestMultiCIDRReleaseCIDRSuccess(t *testing.T) {
 			},
 		},
 	}
-	logger, ctx := ktesting.NewTestContext(t)
+	_, ctx := ktesting.NewTestContext(t)
 	testFunc := func(tc releasetestCaseMultiCIDR) {
 		fakeClient := &clustercidrfake.Clientset{}
 		fakeInformerFactory := clustercidrinformer.NewSharedInformerFactory(fakeClient, NoResyncPeriodFunc())
 		fakeClusterCIDRInformer := fakeInformerFactory.Networking().V1().ClusterCIDRs()
 		fakeCIDRClient := clustercidrfake.NewSimpleClientset().NetworkingV1().ClusterCIDRs() //nolint:staticcheck // see https://github.com/kubernetes/kubernetes/issues/126850
 		// Initialize the range allocator.
-		allocator, _ := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, test.FakeNodeInformer(tc.fakeNodeHandler), fakeClusterCIDRInformer, tc.allocatorParams, nil, tc.testCIDRMap)
+		allocator, _ := NewMultiCIDRRangeAllocator(ctx, tc.fakeNodeHandler, fakeCIDRClient, test.FakeNodeInformer(tc.fakeNodeHandler), fakeClusterCIDRInformer, tc.allocatorParams, tc.testCIDRMap)
 		rangeAllocator, ok := allocator.(*multiCIDRRangeAllocator)
 		if !ok {
 			t.Logf("%v: found non-default implementation of CIDRAllocator, skipping white-box test...", tc.description)
@@ -1533,6 +1541,9 @@ func TestMultiCIDRReleaseCIDRSuccess(t *testing.T) {
 		}
 		rangeAllocator.nodesSynced = test.AlwaysReady
 		rangeAllocator.recorder = &record.FakeRecorder{}
+		if err := rangeAllocator.loadClusterCIDRs(ctx); err != nil {
+			t.Fatalf("%v: failed to load ClusterCIDRs with error %v", tc.description, err)
+		}
 
 		// this is a bit of white box testing
 		for _, allocatedList := range tc.allocatedCIDRs {
@@ -1563,7 +1574,7 @@ func TestMultiCIDRReleaseCIDRSuccess(t *testing.T) {
 			}
 		}
 
-		err := allocator.AllocateOrOccupyCIDR(logger, tc.fakeNodeHandler.Existing[0])
+		err := allocator.AllocateOrOccupyCIDR(ctx, tc.fakeNodeHandler.Existing[0])
 		if len(tc.expectedAllocatedCIDRFirstRound) != 0 {
 			if err != nil {
 				t.Fatalf("%v: unexpected error in AllocateOrOccupyCIDR: %v", tc.description, err)
@@ -1577,8 +1588,8 @@ func TestMultiCIDRReleaseCIDRSuccess(t *testing.T) {
 			}
 			// We don't expect any updates here
 			time.Sleep(time.Second)
-			if len(tc.fakeNodeHandler.GetUpdatedNodesCopy()) != 0 {
-				t.Fatalf("%v: unexpected update of nodes: %v", tc.description, tc.fakeNodeHandler.GetUpdatedNodesCopy())
+			if len(podCIDRUpdates(tc.fakeNodeHandler)) != 0 {
+				t.Fatalf("%v: unexpected update of nodes: %v", tc.description, podCIDRUpdates(tc.fakeNodeHandler))
 			}
 		}
 
@@ -1592,12 +1603,12 @@ func TestMultiCIDRReleaseCIDRSuccess(t *testing.T) {
 				},
 			}
 			nodeToRelease.Spec.PodCIDRs = cidrToRelease
-			err = allocator.ReleaseCIDR(logger, &nodeToRelease)
+			err = allocator.ReleaseCIDR(ctx, &nodeToRelease)
 			if err != nil {
 				t.Fatalf("%v: unexpected error in ReleaseCIDR: %v", tc.description, err)
 			}
 		}
-		if err = allocator.AllocateOrOccupyCIDR(logger, tc.fakeNodeHandler.Existing[0]); err != nil {
+		if err = allocator.AllocateOrOccupyCIDR(ctx, tc.fakeNodeHandler.Existing[0]); err != nil {
 			t.Fatalf("%v: unexpected error in AllocateOrOccupyCIDR: %v", tc.description, err)
 		}
 		if err := test.WaitForUpdatedNodeWithTimeout(tc.fakeNodeHandler, 1, wait.ForeverTestTimeout); err != nil {
@@ -1608,7 +1619,7 @@ func TestMultiCIDRReleaseCIDRSuccess(t *testing.T) {
 			// nothing further expected
 			return
 		}
-		for _, updatedNode := range tc.fakeNodeHandler.GetUpdatedNodesCopy() {
+		for _, updatedNode := range podCIDRUpdates(tc.fakeNodeHandler) {
 			if len(updatedNode.Spec.PodCIDRs) == 0 {
 				continue // not assigned yet
 			}
@@ -1681,10 +1692,11 @@ func newController(ctx context.Context) (*clustercidrfake.Clientset, *nodeIPAMCo
 	testCIDRMap := make(map[string][]*multicidrset.ClusterCIDR, 0)
 
 	// Initialize the range allocator.
-	ra, _ := NewMultiCIDRRangeAllocator(ctx, nodeClient, client.NetworkingV1().ClusterCIDRs(), nodeInformer, cccInformer, allocatorParams, nil, testCIDRMap)
+	ra, _ := NewMultiCIDRRangeAllocator(ctx, nodeClient, client.NetworkingV1().ClusterCIDRs(), nodeInformer, cccInformer, allocatorParams, testCIDRMap)
 	cccController := ra.(*multiCIDRRangeAllocator)
 
 	cccController.clusterCIDRSynced = alwaysReady
+	_ = cccController.bootstrap(ctx)
 
 	return client, &nodeIPAMController{
 		cccController,
@@ -1903,6 +1915,20 @@ func expectActions(t *testing.T, actions []k8stesting.Action, num int, verb, res
 	}
 }
 
+// podCIDRUpdates returns the updated nodes whose podCIDRs changed, ignoring the
+// updates of their PodCIDRAssigned condition.
+func podCIDRUpdates(nodeHandler *test.FakeNodeHandler) []*corev1.Node {
+	var updates []*corev1.Node
+	for _, updatedNode := range nodeHandler.GetUpdatedNodesCopy() {
+		idx := slices.IndexFunc(nodeHandler.Existing, func(node *corev1.Node) bool { return node.Name == updatedNode.Name })
+		if idx >= 0 && slices.Equal(nodeHandler.Existing[idx].Spec.PodCIDRs, updatedNode.Spec.PodCIDRs) {
+			continue
+		}
+		updates = append(updates, updatedNode)
+	}
+	return updates
+}
+
 func makeNodeSelector(key string, op corev1.NodeSelectorOperator, values []string) *corev1.NodeSelector {
 	return &corev1.NodeSelector{
 		NodeSelectorTerms: []corev1.NodeSelectorTerm{
@@ -1969,11 +1995,11 @@ func TestHandleNodeDeleteWithTombstone(t *testing.T) {
 			},
 		})
 
-	nodeList, _ := fakeNodeHandler.List(context.TODO(), metav1.ListOptions{})
-	allocator, err := NewMultiCIDRRangeAllocator(ctx, fakeNodeHandler, fakeCIDRClient, fakeNodeInformer, fakeClusterCIDRInformer, allocatorParams, nodeList, testCIDRMap)
+	allocator, err := NewMultiCIDRRangeAllocator(ctx, fakeNodeHandler, fakeCIDRClient, fakeNodeInformer, fakeClusterCIDRInformer, allocatorParams, testCIDRMap)
 	require.NoError(t, err)
 
 	ra := allocator.(*multiCIDRRangeAllocator)
+	require.NoError(t, ra.bootstrap(ctx))
 
 	tests := []struct {
 		name string
@@ -2003,11 +2029,10 @@ func TestHandleNodeDeleteWithTombstone(t *testing.T) {
 		},
 	}
 
-	logger, _ := ktesting.NewTestContext(t)
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			assert.NotPanics(t, func() {
-				ra.handleNodeDelete(logger, tc.obj)
+				ra.handleNodeDelete(ctx, tc.obj)
 			})
 		})
 	}
@@ -56,6 +56,14 @@ var (
 		},
 		[]string{"clusterCIDR", "clusterCIDRName"},
 	)
+	cidrSetQuarantined = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: nodeIpamSubsystem,
+			Name:      "multicidrset_quarantined_cidrs",
+			Help:      "Gauge measuring the number of released CIDRs waiting for their reuse cooldown before they can be allocated again.",
+		},
+		[]string{"clusterCIDR", "clusterCIDRName"},
+	)
 	cidrSetAllocationTriesPerRequest = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Subsystem: nodeIpamSubsystem,
@@ -72,5 +80,6 @@ func init() {
 	prometheus.MustRegister(cidrSetReleases)
 	prometheus.MustRegister(cidrSetMaxCidrs)
 	prometheus.MustRegister(cidrSetUsage)
+	prometheus.MustRegister(cidrSetQuarantined)
 	prometheus.MustRegister(cidrSetAllocationTriesPerRequest)
 }
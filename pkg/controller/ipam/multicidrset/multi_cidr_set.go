@@ -23,9 +23,13 @@ import (
 	"math/bits"
 	"net"
 	"sync"
+	"time"
 
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	netutils "k8s.io/utils/net"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
 )
 
 // MultiCIDRSet manages a set of CIDR ranges from which blocks of IPs can
@@ -61,6 +65,15 @@ type MultiCIDRSet struct {
 	allocatedCIDRs int
 	// nextCandidate points to the next CIDR that should be free.
 	nextCandidate int
+	// quarantinedCIDRMap stores the time until which the released CIDRs are
+	// not handed out again, reuseCooldown after their release unless held
+	// for longer. Protected by mu.
+	quarantinedCIDRMap map[string]time.Time
+	// reuseCooldown is how long a released CIDR is quarantined, 0 disables
+	// the quarantine.
+	reuseCooldown time.Duration
+	// clock is used to expire the quarantined CIDRs.
+	clock clock.PassiveClock
 }
 
 // ClusterCIDR is an internal representation of the ClusterCIDR API object.
@@ -78,6 +91,16 @@ type ClusterCIDR struct {
 	AssociatedNodes map[string]bool
 	// Terminating is used to identify whether ClusterCIDR has been marked for termination.
 	Terminating bool
+	// CreationTimestamp is the creation timestamp of the associated ClusterCIDR
+	// API object.
+	CreationTimestamp time.Time
+	// AllocationStrategy is ClusterCIDR.spec.allocationStrategy of the
+	// associated ClusterCIDR API object, nil if unset.
+	AllocationStrategy *v1.AllocationStrategy
+	// NextPairedIndex is the index the paired IPv4 and IPv6 CIDRs are probed
+	// from with the Sequential allocation strategy. Like AssociatedNodes, it
+	// is not protected: the callers must serialize the allocations.
+	NextPairedIndex int
 }
 
 const (
@@ -139,14 +162,16 @@ func NewMultiCIDRSet(clusterCIDRName string, cidrConfig *net.IPNet, perNodeHostB
 
 	maxCIDRs := getMaxCIDRs(subNetMaskSize, clusterMaskSize)
 	multiCIDRSet := &MultiCIDRSet{
-		ClusterCIDR:      cidrConfig,
-		clusterCIDRName:  clusterCIDRName,
-		nodeMask:         net.CIDRMask(subNetMaskSize, bits),
-		clusterMaskSize:  clusterMaskSize,
-		MaxCIDRs:         maxCIDRs,
-		NodeMaskSize:     subNetMaskSize,
-		Label:            cidrConfig.String(),
-		allocatedCIDRMap: make(map[string]bool),
+		ClusterCIDR:        cidrConfig,
+		clusterCIDRName:    clusterCIDRName,
+		nodeMask:           net.CIDRMask(subNetMaskSize, bits),
+		clusterMaskSize:    clusterMaskSize,
+		MaxCIDRs:           maxCIDRs,
+		NodeMaskSize:       subNetMaskSize,
+		Label:              cidrConfig.String(),
+		allocatedCIDRMap:   make(map[string]bool),
+		quarantinedCIDRMap: make(map[string]time.Time),
+		clock:              clock.RealClock{},
 	}
 	cidrSetMaxCidrs.WithLabelValues(multiCIDRSet.Label, clusterCIDRName).Set(float64(maxCIDRs))
 
@@ -198,33 +223,117 @@ func (s *MultiCIDRSet) indexToCIDRBlock(index int) (*net.IPNet, error) {
 	}, nil
 }
 
+// SetReuseCooldown sets how long the released CIDRs are quarantined before
+// they can be allocated again, 0 disables the quarantine.
+func (s *MultiCIDRSet) SetReuseCooldown(cooldown time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reuseCooldown = cooldown
+	if cooldown <= 0 {
+		clear(s.quarantinedCIDRMap)
+		cidrSetQuarantined.WithLabelValues(s.Label, s.clusterCIDRName).Set(0)
+	}
+}
+
+// quarantined requires the caller to hold s.mu.
+// quarantined returns whether the CIDR is quarantined, its quarantine is
+// lifted once it has elapsed.
+func (s *MultiCIDRSet) quarantined(cidr string, now time.Time) bool {
+	until, ok := s.quarantinedCIDRMap[cidr]
+	if !ok {
+		return false
+	}
+	if now.Before(until) {
+		return true
+	}
+	delete(s.quarantinedCIDRMap, cidr)
+	cidrSetQuarantined.WithLabelValues(s.Label, s.clusterCIDRName).Set(float64(len(s.quarantinedCIDRMap)))
+	return false
+}
+
+// expireQuarantine requires the caller to hold s.mu.
+// expireQuarantine lifts the quarantine of the CIDRs whose reuse cooldown has
+// elapsed.
+func (s *MultiCIDRSet) expireQuarantine() {
+	now := s.clock.Now()
+	for cidr := range s.quarantinedCIDRMap {
+		s.quarantined(cidr, now)
+	}
+}
+
 // NextCandidate returns the next candidate and the last evaluated index
 // for the current cidrSet. Returns nil if the candidate is already allocated.
+// Quarantined CIDRs are skipped.
 func (s *MultiCIDRSet) NextCandidate() (*net.IPNet, int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	cidr, candidate, evaluated, err := s.probe(s.nextCandidate)
+	if err == nil {
+		s.nextCandidate = (candidate + 1) % s.MaxCIDRs
+	}
+	return cidr, evaluated, err
+}
+
+// CandidateFrom returns the first CIDR which is neither allocated nor
+// quarantined, probing from the CIDR at the given index, modulo MaxCIDRs, and
+// wrapping around. It does not move the next candidate of NextCandidate. It
+// also returns the number of CIDRs evaluated before the returned one, so that
+// the caller can resume probing after it.
+func (s *MultiCIDRSet) CandidateFrom(index int) (*net.IPNet, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index < 0 {
+		return nil, 0, fmt.Errorf("invalid index %d for cluster cidr %v", index, s.ClusterCIDR)
+	}
+	cidr, _, evaluated, err := s.probe(index % s.MaxCIDRs)
+	return cidr, evaluated, err
+}
+
+// CIDRAt returns the CIDR at the given index, and whether it is free, i.e.
+// neither allocated nor quarantined.
+func (s *MultiCIDRSet) CIDRAt(index int) (*net.IPNet, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index < 0 || index >= s.MaxCIDRs {
+		return nil, false, fmt.Errorf("index %d out of the range of cluster cidr %v", index, s.ClusterCIDR)
+	}
+	cidr, err := s.indexToCIDRBlock(index)
+	if err != nil {
+		return nil, false, err
+	}
+	_, allocated := s.allocatedCIDRMap[cidr.String()]
+	return cidr, !allocated && !s.quarantined(cidr.String(), s.clock.Now()), nil
+}
+
+// probe requires the caller to hold s.mu.
+// probe returns the first CIDR which is neither allocated nor quarantined from
+// the start index, its index and the number of CIDRs evaluated before it.
+func (s *MultiCIDRSet) probe(start int) (*net.IPNet, int, int, error) {
 	if s.allocatedCIDRs == s.MaxCIDRs {
-		return nil, 0, &CIDRRangeNoCIDRsRemainingErr{
+		return nil, 0, 0, &CIDRRangeNoCIDRsRemainingErr{
 			CIDR: s.Label,
 		}
 	}
 
-	candidate := s.nextCandidate
+	now := s.clock.Now()
+	candidate := start
 	for i := 0; i < s.MaxCIDRs; i++ {
-		nextCandidateCIDR, err := s.indexToCIDRBlock(candidate)
+		candidateCIDR, err := s.indexToCIDRBlock(candidate)
 		if err != nil {
-			return nil, i, err
+			return nil, candidate, i, err
 		}
-		// Check if the nextCandidate is not already allocated.
-		if _, ok := s.allocatedCIDRMap[nextCandidateCIDR.String()]; !ok {
-			s.nextCandidate = (candidate + 1) % s.MaxCIDRs
-			return nextCandidateCIDR, i, nil
+		// Check if the candidate is not already allocated nor quarantined.
+		if _, ok := s.allocatedCIDRMap[candidateCIDR.String()]; !ok && !s.quarantined(candidateCIDR.String(), now) {
+			return candidateCIDR, candidate, i, nil
 		}
 		candidate = (candidate + 1) % s.MaxCIDRs
 	}
 
-	return nil, s.MaxCIDRs, &CIDRRangeNoCIDRsRemainingErr{
+	return nil, candidate, s.MaxCIDRs, &CIDRRangeNoCIDRsRemainingErr{
 		CIDR: s.Label,
 	}
 }
@@ -274,8 +383,21 @@ func (s *MultiCIDRSet) getBeginningAndEndIndices(cidr *net.IPNet) (int, int, err
 	return begin, end, nil
 }
 
-// Release releases the given CIDR range.
+// Release releases the given CIDR range. The released CIDRs are quarantined
+// for the reuse cooldown of the set.
 func (s *MultiCIDRSet) Release(cidr *net.IPNet) error {
+	return s.release(cidr, true)
+}
+
+// Unreserve releases the given CIDR range without quarantining it, for the
+// CIDRs allocated to a node that never got them.
+func (s *MultiCIDRSet) Unreserve(cidr *net.IPNet) error {
+	return s.release(cidr, false)
+}
+
+// release releases the given CIDR range, quarantining the released CIDRs for
+// the reuse cooldown of the set if quarantine is set.
+func (s *MultiCIDRSet) release(cidr *net.IPNet, quarantine bool) error {
 	begin, end, err := s.getBeginningAndEndIndices(cidr)
 	if err != nil {
 		return err
@@ -283,6 +405,8 @@ func (s *MultiCIDRSet) Release(cidr *net.IPNet) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := s.clock.Now()
+
 	for i := begin; i <= end; i++ {
 		// Remove from the allocated CIDR Map and decrement the counter only if currently
 		// marked allocated. Avoids double counting.
@@ -294,16 +418,49 @@ func (s *MultiCIDRSet) Release(cidr *net.IPNet) error {
 			delete(s.allocatedCIDRMap, currCIDR.String())
 			s.allocatedCIDRs--
 			cidrSetReleases.WithLabelValues(s.Label, s.clusterCIDRName).Inc()
+			if quarantine && s.reuseCooldown > 0 {
+				s.quarantinedCIDRMap[currCIDR.String()] = now.Add(s.reuseCooldown)
+			}
 		}
 	}
 
+	cidrSetQuarantined.WithLabelValues(s.Label, s.clusterCIDRName).Set(float64(len(s.quarantinedCIDRMap)))
 	cidrSetUsage.WithLabelValues(s.Label, s.clusterCIDRName).Set(float64(s.allocatedCIDRs) / float64(s.MaxCIDRs))
 
 	return nil
 }
 
+// Hold quarantines the free CIDRs of the given CIDR range until the given
+// time, whatever the reuse cooldown of the set, unless they are already
+// quarantined for longer.
+func (s *MultiCIDRSet) Hold(cidr *net.IPNet, until time.Time) error {
+	begin, end, err := s.getBeginningAndEndIndices(cidr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := begin; i <= end; i++ {
+		currCIDR, err := s.indexToCIDRBlock(i)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.allocatedCIDRMap[currCIDR.String()]; ok {
+			continue
+		}
+		if current, ok := s.quarantinedCIDRMap[currCIDR.String()]; !ok || current.Before(until) {
+			s.quarantinedCIDRMap[currCIDR.String()] = until
+		}
+	}
+
+	cidrSetQuarantined.WithLabelValues(s.Label, s.clusterCIDRName).Set(float64(len(s.quarantinedCIDRMap)))
+
+	return nil
+}
+
 // Occupy marks the given CIDR range as used. Occupy succeeds even if the CIDR
-// range was previously used.
+// range was previously used or is quarantined, which lifts its quarantine.
 func (s *MultiCIDRSet) Occupy(cidr *net.IPNet) (err error) {
 	begin, end, err := s.getBeginningAndEndIndices(cidr)
 	if err != nil {
@@ -324,7 +481,9 @@ func (s *MultiCIDRSet) Occupy(cidr *net.IPNet) (err error) {
 			cidrSetAllocations.WithLabelValues(s.Label, s.clusterCIDRName).Inc()
 			s.allocatedCIDRs++
 		}
+		delete(s.quarantinedCIDRMap, currCIDR.String())
 	}
+	cidrSetQuarantined.WithLabelValues(s.Label, s.clusterCIDRName).Set(float64(len(s.quarantinedCIDRMap)))
 	cidrSetUsage.WithLabelValues(s.Label, s.clusterCIDRName).Set(float64(s.allocatedCIDRs) / float64(s.MaxCIDRs))
 
 	return nil
@@ -390,3 +549,102 @@ func (s *MultiCIDRSet) CIDROverlaps(cidr *net.IPNet) bool {
 
 	return false
 }
+
+// MultiCIDRSetStatus is a point-in-time view of the state of a MultiCIDRSet.
+type MultiCIDRSetStatus struct {
+	// CIDR is the CIDR the set allocates from.
+	CIDR string `json:"cidr"`
+	// NodeMaskSize is the mask size of the allocated CIDRs.
+	NodeMaskSize int `json:"nodeMaskSize"`
+	// MaxCIDRs is the maximum number of CIDRs that can be allocated.
+	MaxCIDRs int `json:"maxCIDRs"`
+	// AllocatedCount is the number of allocated CIDRs.
+	AllocatedCount int `json:"allocatedCount"`
+	// NextCandidate is the CIDR that is evaluated first on the next allocation.
+	NextCandidate string `json:"nextCandidate"`
+	// AllocatedCIDRs lists the allocated CIDRs in ascending order.
+	AllocatedCIDRs []string `json:"allocatedCIDRs"`
+	// ReuseCooldown is how long the released CIDRs are quarantined.
+	ReuseCooldown string `json:"reuseCooldown,omitempty"`
+	// QuarantinedCount is the number of released CIDRs that are not
+	// allocated until their reuse cooldown has elapsed.
+	QuarantinedCount int `json:"quarantinedCount"`
+	// QuarantinedCIDRs lists the quarantined CIDRs in ascending order.
+	QuarantinedCIDRs []string `json:"quarantinedCIDRs,omitempty"`
+}
+
+// Status returns a consistent view of the state of the set.
+func (s *MultiCIDRSet) Status() MultiCIDRSetStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireQuarantine()
+	status := MultiCIDRSetStatus{
+		CIDR:             s.Label,
+		NodeMaskSize:     s.NodeMaskSize,
+		MaxCIDRs:         s.MaxCIDRs,
+		AllocatedCount:   s.allocatedCIDRs,
+		AllocatedCIDRs:   make([]string, 0, len(s.allocatedCIDRMap)),
+		QuarantinedCount: len(s.quarantinedCIDRMap),
+	}
+	if s.reuseCooldown > 0 {
+		status.ReuseCooldown = s.reuseCooldown.String()
+	}
+	if nextCandidate, err := s.indexToCIDRBlock(s.nextCandidate); err == nil {
+		status.NextCandidate = nextCandidate.String()
+	}
+	for i := 0; i < s.MaxCIDRs && len(status.AllocatedCIDRs)+len(status.QuarantinedCIDRs) < len(s.allocatedCIDRMap)+len(s.quarantinedCIDRMap); i++ {
+		cidr, err := s.indexToCIDRBlock(i)
+		if err != nil {
+			break
+		}
+		if s.allocatedCIDRMap[cidr.String()] {
+			status.AllocatedCIDRs = append(status.AllocatedCIDRs, cidr.String())
+		}
+		if _, ok := s.quarantinedCIDRMap[cidr.String()]; ok {
+			status.QuarantinedCIDRs = append(status.QuarantinedCIDRs, cidr.String())
+		}
+	}
+
+	return status
+}
+
+// FreeCIDRs returns up to limit CIDRs that are neither allocated nor
+// quarantined, in ascending order, together with the total number of free
+// CIDRs in the set.
+func (s *MultiCIDRSet) FreeCIDRs(limit int) ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireQuarantine()
+	free := make([]string, 0)
+	for i := 0; i < s.MaxCIDRs && len(free) < limit; i++ {
+		cidr, err := s.indexToCIDRBlock(i)
+		if err != nil {
+			break
+		}
+		if _, ok := s.quarantinedCIDRMap[cidr.String()]; !ok && !s.allocatedCIDRMap[cidr.String()] {
+			free = append(free, cidr.String())
+		}
+	}
+
+	return free, s.MaxCIDRs - s.allocatedCIDRs - len(s.quarantinedCIDRMap)
+}
+
+// AllocatedCount returns the number of allocated CIDRs.
+func (s *MultiCIDRSet) AllocatedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.allocatedCIDRs
+}
+
+// QuarantinedCount returns the number of quarantined CIDRs, after lifting the
+// quarantine of the CIDRs whose reuse cooldown has elapsed.
+func (s *MultiCIDRSet) QuarantinedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireQuarantine()
+	return len(s.quarantinedCIDRMap)
+}
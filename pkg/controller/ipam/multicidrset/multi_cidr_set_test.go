@@ -17,12 +17,15 @@ limitations under the License.
 package multicidrset
 
 import (
+	"fmt"
 	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/klog/v2/ktesting"
+	testingclock "k8s.io/utils/clock/testing"
 	utilnet "k8s.io/utils/net"
 )
 
@@ -1156,3 +1159,242 @@ func BenchmarkAllocateAll_64_72(b *testing.B) { benchmarkAllocateAllIPv6("2001:d
 func BenchmarkAllocateAll_64_76(b *testing.B) { benchmarkAllocateAllIPv6("2001:db8::/64", 76, b) }
 
 func BenchmarkAllocateAll_64_80(b *testing.B) { benchmarkAllocateAllIPv6("2001:db8::/64", 80, b) }
+
+func TestStatusAndFreeCIDRs(t *testing.T) {
+	_, clusterCIDR, _ := utilnet.ParseCIDRSloppy("10.0.0.0/30")
+	multiCIDRSet, err := NewMultiCIDRSet("test-cluster-cidr", clusterCIDR, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, cidr := range []string{"10.0.0.2/32", "10.0.0.0/32"} {
+		_, c, _ := utilnet.ParseCIDRSloppy(cidr)
+		if err := multiCIDRSet.Occupy(c); err != nil {
+			t.Fatalf("failed to occupy %s: %v", cidr, err)
+		}
+	}
+	if _, _, err := multiCIDRSet.NextCandidate(); err != nil {
+		t.Fatalf("failed to get next CIDR candidate: %v", err)
+	}
+
+	expectedStatus := MultiCIDRSetStatus{
+		CIDR:           "10.0.0.0/30",
+		NodeMaskSize:   32,
+		MaxCIDRs:       4,
+		AllocatedCount: 2,
+		NextCandidate:  "10.0.0.2/32",
+		AllocatedCIDRs: []string{"10.0.0.0/32", "10.0.0.2/32"},
+	}
+	if status := multiCIDRSet.Status(); !reflect.DeepEqual(status, expectedStatus) {
+		t.Errorf("expected status %+v, got %+v", expectedStatus, status)
+	}
+
+	free, count := multiCIDRSet.FreeCIDRs(1)
+	if count != 2 || !reflect.DeepEqual(free, []string{"10.0.0.1/32"}) {
+		t.Errorf("expected 2 free CIDRs listing [10.0.0.1/32], got %d listing %v", count, free)
+	}
+	free, _ = multiCIDRSet.FreeCIDRs(10)
+	if !reflect.DeepEqual(free, []string{"10.0.0.1/32", "10.0.0.3/32"}) {
+		t.Errorf("expected free CIDRs [10.0.0.1/32 10.0.0.3/32], got %v", free)
+	}
+}
+
+func TestReuseCooldown(t *testing.T) {
+	_, clusterCIDR, _ := utilnet.ParseCIDRSloppy("10.0.0.0/30")
+	multiCIDRSet, err := NewMultiCIDRSet("test-cluster-cidr", clusterCIDR, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	multiCIDRSet.clock = fakeClock
+	multiCIDRSet.SetReuseCooldown(time.Minute)
+
+	var allocated []*net.IPNet
+	for i := 0; i < 4; i++ {
+		cidr, err := allocateNext(multiCIDRSet)
+		if err != nil {
+			t.Fatalf("failed to allocate CIDR %d: %v", i, err)
+		}
+		allocated = append(allocated, cidr)
+	}
+	if err := multiCIDRSet.Release(allocated[1]); err != nil {
+		t.Fatalf("failed to release %s: %v", allocated[1], err)
+	}
+
+	// The released CIDR is the only free one, but it is quarantined.
+	if _, _, err := multiCIDRSet.NextCandidate(); err == nil {
+		t.Errorf("expected no candidate while the released CIDR is quarantined")
+	}
+	if count := multiCIDRSet.QuarantinedCount(); count != 1 {
+		t.Errorf("expected 1 quarantined CIDR, got %d", count)
+	}
+	status := multiCIDRSet.Status()
+	if status.QuarantinedCount != 1 || !reflect.DeepEqual(status.QuarantinedCIDRs, []string{"10.0.0.1/32"}) || status.ReuseCooldown != "1m0s" {
+		t.Errorf("expected 10.0.0.1/32 to be quarantined for 1m0s, got %+v", status)
+	}
+	if free, count := multiCIDRSet.FreeCIDRs(10); count != 0 || len(free) != 0 {
+		t.Errorf("expected no free CIDRs, got %d listing %v", count, free)
+	}
+	if value, _ := testutil.GetGaugeMetricValue(cidrSetQuarantined.WithLabelValues("10.0.0.0/30", "test-cluster-cidr")); value != 1 {
+		t.Errorf("expected 1 quarantined CIDR in the metric, got %v", value)
+	}
+
+	// The quarantine is lifted once the cooldown has elapsed.
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	candidate, _, err := multiCIDRSet.NextCandidate()
+	if err != nil {
+		t.Fatalf("failed to get next CIDR candidate: %v", err)
+	}
+	if candidate.String() != "10.0.0.1/32" {
+		t.Errorf("expected candidate 10.0.0.1/32, got %s", candidate)
+	}
+	if count := multiCIDRSet.QuarantinedCount(); count != 0 {
+		t.Errorf("expected no quarantined CIDR, got %d", count)
+	}
+
+	// Occupying a quarantined CIDR, e.g. found on a node, lifts its quarantine.
+	if err := multiCIDRSet.Release(allocated[2]); err != nil {
+		t.Fatalf("failed to release %s: %v", allocated[2], err)
+	}
+	if err := multiCIDRSet.Occupy(allocated[2]); err != nil {
+		t.Fatalf("failed to occupy %s: %v", allocated[2], err)
+	}
+	if count := multiCIDRSet.QuarantinedCount(); count != 0 {
+		t.Errorf("expected no quarantined CIDR after occupying it, got %d", count)
+	}
+
+	// Unreserving a CIDR a node never got does not quarantine it.
+	if err := multiCIDRSet.Unreserve(allocated[2]); err != nil {
+		t.Fatalf("failed to unreserve %s: %v", allocated[2], err)
+	}
+	if count := multiCIDRSet.QuarantinedCount(); count != 0 {
+		t.Errorf("expected no quarantined CIDR after unreserving it, got %d", count)
+	}
+	if free, count := multiCIDRSet.FreeCIDRs(10); count != 2 || !reflect.DeepEqual(free, []string{"10.0.0.1/32", "10.0.0.2/32"}) {
+		t.Errorf("expected 10.0.0.1/32 and 10.0.0.2/32 to be free, got %d listing %v", count, free)
+	}
+	if err := multiCIDRSet.Occupy(allocated[2]); err != nil {
+		t.Fatalf("failed to occupy %s: %v", allocated[2], err)
+	}
+
+	// Without a cooldown the released CIDRs are reusable immediately.
+	multiCIDRSet.SetReuseCooldown(0)
+	if err := multiCIDRSet.Release(allocated[3]); err != nil {
+		t.Fatalf("failed to release %s: %v", allocated[3], err)
+	}
+	if _, _, err := multiCIDRSet.NextCandidate(); err != nil {
+		t.Errorf("expected the released CIDR to be reusable without a cooldown: %v", err)
+	}
+}
+
+func TestHold(t *testing.T) {
+	_, clusterCIDR, _ := utilnet.ParseCIDRSloppy("10.0.0.0/31")
+	multiCIDRSet, err := NewMultiCIDRSet("test-cluster-cidr", clusterCIDR, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	multiCIDRSet.clock = fakeClock
+
+	var allocated []*net.IPNet
+	for i := 0; i < 2; i++ {
+		cidr, err := allocateNext(multiCIDRSet)
+		if err != nil {
+			t.Fatalf("failed to allocate CIDR %d: %v", i, err)
+		}
+		allocated = append(allocated, cidr)
+	}
+	if err := multiCIDRSet.Release(allocated[1]); err != nil {
+		t.Fatalf("failed to release %s: %v", allocated[1], err)
+	}
+
+	// The released CIDR is held without a reuse cooldown, the allocated one
+	// is not.
+	for _, cidr := range allocated {
+		if err := multiCIDRSet.Hold(cidr, fakeClock.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("failed to hold %s: %v", cidr, err)
+		}
+	}
+	if _, _, err := multiCIDRSet.NextCandidate(); err == nil {
+		t.Errorf("expected no candidate while the released CIDR is held")
+	}
+	if count := multiCIDRSet.QuarantinedCount(); count != 1 {
+		t.Errorf("expected 1 quarantined CIDR, got %d", count)
+	}
+
+	// A shorter hold does not lift the longer one.
+	if err := multiCIDRSet.Hold(allocated[1], fakeClock.Now()); err != nil {
+		t.Fatalf("failed to hold %s: %v", allocated[1], err)
+	}
+	if _, _, err := multiCIDRSet.NextCandidate(); err == nil {
+		t.Errorf("expected no candidate while the released CIDR is held")
+	}
+
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	candidate, _, err := multiCIDRSet.NextCandidate()
+	if err != nil {
+		t.Fatalf("failed to get next CIDR candidate: %v", err)
+	}
+	if candidate.String() != allocated[1].String() {
+		t.Errorf("expected candidate %s, got %s", allocated[1], candidate)
+	}
+}
+
+func TestCandidateFrom(t *testing.T) {
+	_, clusterCIDR, _ := utilnet.ParseCIDRSloppy("10.0.0.0/30")
+	multiCIDRSet, err := NewMultiCIDRSet("test-cluster-cidr", clusterCIDR, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, occupied, _ := utilnet.ParseCIDRSloppy("10.0.0.2/32")
+	if err := multiCIDRSet.Occupy(occupied); err != nil {
+		t.Fatalf("failed to occupy %s: %v", occupied, err)
+	}
+
+	testCases := []struct {
+		index         int
+		wantCandidate string
+		wantEvaluated int
+	}{
+		{index: 1, wantCandidate: "10.0.0.1/32", wantEvaluated: 0},
+		// The occupied CIDR is probed past.
+		{index: 2, wantCandidate: "10.0.0.3/32", wantEvaluated: 1},
+		// The index wraps around MaxCIDRs.
+		{index: 5, wantCandidate: "10.0.0.1/32", wantEvaluated: 0},
+		{index: 6, wantCandidate: "10.0.0.3/32", wantEvaluated: 1},
+	}
+	for _, tc := range testCases {
+		candidate, evaluated, err := multiCIDRSet.CandidateFrom(tc.index)
+		if err != nil {
+			t.Fatalf("index %d: unexpected error: %v", tc.index, err)
+		}
+		if candidate.String() != tc.wantCandidate || evaluated != tc.wantEvaluated {
+			t.Errorf("index %d: expected candidate %s after %d evaluated, got %s after %d", tc.index, tc.wantCandidate, tc.wantEvaluated, candidate, evaluated)
+		}
+	}
+
+	// CandidateFrom does not move the next candidate.
+	candidate, _, err := multiCIDRSet.NextCandidate()
+	if err != nil {
+		t.Fatalf("failed to get next CIDR candidate: %v", err)
+	}
+	if candidate.String() != "10.0.0.0/32" {
+		t.Errorf("expected next candidate 10.0.0.0/32, got %s", candidate)
+	}
+	if _, _, err := multiCIDRSet.CandidateFrom(-1); err == nil {
+		t.Errorf("expected an error for a negative index")
+	}
+
+	for index, want := range map[int]bool{0: true, 2: false} {
+		cidr, free, err := multiCIDRSet.CIDRAt(index)
+		if err != nil {
+			t.Fatalf("index %d: unexpected error: %v", index, err)
+		}
+		if cidr.String() != fmt.Sprintf("10.0.0.%d/32", index) || free != want {
+			t.Errorf("index %d: expected 10.0.0.%d/32 free %t, got %s free %t", index, index, want, cidr, free)
+		}
+	}
+	if _, _, err := multiCIDRSet.CIDRAt(4); err == nil {
+		t.Errorf("expected an error for an index out of the range")
+	}
+}
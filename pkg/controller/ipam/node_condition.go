@@ -0,0 +1,226 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// PodCIDRAssignedCondition is the node condition reporting whether the
+	// node has been assigned its podCIDRs.
+	PodCIDRAssignedCondition corev1.NodeConditionType = "PodCIDRAssigned"
+
+	// PodCIDRAssignedReasonAssigned is the reason of the condition once the
+	// podCIDRs are set on the node.
+	PodCIDRAssignedReasonAssigned = "Assigned"
+	// PodCIDRAssignedReasonNoMatchingClusterCIDR is the reason of the condition
+	// when no ClusterCIDR selects the node.
+	PodCIDRAssignedReasonNoMatchingClusterCIDR = "NoMatchingClusterCIDR"
+	// PodCIDRAssignedReasonExhausted is the reason of the condition when all the
+	// ClusterCIDRs selecting the node are exhausted.
+	PodCIDRAssignedReasonExhausted = "Exhausted"
+	// PodCIDRAssignedReasonPatchFailed is the reason of the condition when the
+	// podCIDRs could not be patched on the node.
+	PodCIDRAssignedReasonPatchFailed = "PatchFailed"
+
+	// PodCIDRUnassignedTaintKey is the key of the NoSchedule taint kept on the
+	// nodes until their podCIDRs are set, if enabled.
+	PodCIDRUnassignedTaintKey = "node.kubernetes.io/pod-cidr-unassigned"
+)
+
+var (
+	// errNoMatchingClusterCIDR is returned when no ClusterCIDR selects a node.
+	errNoMatchingClusterCIDR = errors.New("no matching clusterCIDR")
+	// errClusterCIDRsExhausted is returned when no ClusterCIDR selecting a node
+	// has a free CIDR.
+	errClusterCIDRsExhausted = errors.New("no available CIDRs")
+)
+
+// podCIDRUnassignedTaint is the taint managed when ManagePodCIDRUnassignedTaint is set.
+var podCIDRUnassignedTaint = corev1.Taint{
+	Key:    PodCIDRUnassignedTaintKey,
+	Effect: corev1.TaintEffectNoSchedule,
+}
+
+// podCIDRUnassignedReason returns the reason of the PodCIDRAssigned condition
+// for an allocation error.
+func podCIDRUnassignedReason(err error) string {
+	switch {
+	case errors.Is(err, errNoMatchingClusterCIDR):
+		return PodCIDRAssignedReasonNoMatchingClusterCIDR
+	case errors.Is(err, errClusterCIDRsExhausted):
+		return PodCIDRAssignedReasonExhausted
+	default:
+		return PodCIDRAssignedReasonPatchFailed
+	}
+}
+
+// podCIDRAssignment is the PodCIDRAssigned condition decided for a node while
+// holding r.lock, reported once it is released.
+type podCIDRAssignment struct {
+	assigned bool
+	reason   string
+	message  string
+	// clusterCIDR is the ClusterCIDR to record on a node that already has
+	// its podCIDRs, see recordClusterCIDR.
+	clusterCIDR string
+}
+
+// podCIDRAssigned is the assignment of the nodes whose podCIDRs are set.
+var podCIDRAssigned = &podCIDRAssignment{assigned: true}
+
+func podCIDRUnassigned(reason, message string) *podCIDRAssignment {
+	return &podCIDRAssignment{reason: reason, message: message}
+}
+
+// reportPodCIDRAssignment must be called without holding r.lock.
+// reportPodCIDRAssignment updates the PodCIDRAssigned condition and the taint
+// of the node for the assignment, nothing is written if they already match.
+func (r *multiCIDRRangeAllocator) reportPodCIDRAssignment(ctx context.Context, node *corev1.Node, assignment *podCIDRAssignment) error {
+	switch {
+	case assignment == nil:
+		return nil
+	case assignment.assigned:
+		return r.markPodCIDRAssigned(ctx, node)
+	default:
+		r.markPodCIDRUnassigned(ctx, node, assignment.reason, assignment.message)
+		return nil
+	}
+}
+
+// markPodCIDRUnassigned sets the PodCIDRAssigned condition of the node to
+// False and, if enabled, taints the node. Failures are logged only, the
+// allocation error is what the caller reports.
+func (r *multiCIDRRangeAllocator) markPodCIDRUnassigned(ctx context.Context, node *corev1.Node, reason, message string) {
+	logger := klog.FromContext(ctx)
+	if err := r.setPodCIDRAssignedCondition(ctx, node, corev1.ConditionFalse, reason, message); err != nil {
+		logger.Error(err, "Failed to set the PodCIDRAssigned condition", "node", klog.KObj(node), "reason", reason)
+	}
+	if !r.allocatorParams.ManagePodCIDRUnassignedTaint {
+		return
+	}
+	if err := r.updatePodCIDRUnassignedTaint(ctx, node, true); err != nil {
+		logger.Error(err, "Failed to taint node", "node", klog.KObj(node), "taint", PodCIDRUnassignedTaintKey)
+	}
+}
+
+// markPodCIDRAssigned sets the PodCIDRAssigned condition of the node to True
+// and removes the taint, if enabled.
+func (r *multiCIDRRangeAllocator) markPodCIDRAssigned(ctx context.Context, node *corev1.Node) error {
+	if err := r.setPodCIDRAssignedCondition(ctx, node, corev1.ConditionTrue, PodCIDRAssignedReasonAssigned, "The podCIDRs are set on the node"); err != nil {
+		return fmt.Errorf("failed to set the PodCIDRAssigned condition of node %s: %w", node.Name, err)
+	}
+	if !r.allocatorParams.ManagePodCIDRUnassignedTaint {
+		return nil
+	}
+	if err := r.updatePodCIDRUnassignedTaint(ctx, node, false); err != nil {
+		return fmt.Errorf("failed to remove taint %s from node %s: %w", PodCIDRUnassignedTaintKey, node.Name, err)
+	}
+	return nil
+}
+
+// setPodCIDRAssignedCondition patches the PodCIDRAssigned condition of the
+// node, unless it already has the given status and reason.
+func (r *multiCIDRRangeAllocator) setPodCIDRAssignedCondition(ctx context.Context, node *corev1.Node, status corev1.ConditionStatus, reason, message string) error {
+	condition := corev1.NodeCondition{
+		Type:               PodCIDRAssignedCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+	for _, existing := range node.Status.Conditions {
+		if existing.Type != PodCIDRAssignedCondition {
+			continue
+		}
+		if existing.Status == status && existing.Reason == reason {
+			return nil
+		}
+		if existing.Status == status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+	}
+
+	klog.FromContext(ctx).V(2).Info("Setting node condition", "node", klog.KObj(node), "condition", PodCIDRAssignedCondition, "status", status, "reason", reason)
+	condition.LastHeartbeatTime = metav1.Now()
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	patchCtx, span := r.tracer.Start(ctx, "PatchNodeCondition", trace.WithAttributes(
+		attribute.String("condition", string(PodCIDRAssignedCondition)),
+		attribute.String("status", string(status)),
+	))
+	_, err = r.client.CoreV1().Nodes().PatchStatus(patchCtx, node.Name, patch)
+	endSpan(span, err)
+	return err
+}
+
+// updatePodCIDRUnassignedTaint adds or removes the podCIDRUnassignedTaint.
+func (r *multiCIDRRangeAllocator) updatePodCIDRUnassignedTaint(ctx context.Context, node *corev1.Node, taint bool) error {
+	if hasPodCIDRUnassignedTaint(node) == taint {
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Get the latest version of the node, the lister may be stale.
+		latest, err := r.client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if hasPodCIDRUnassignedTaint(latest) == taint {
+			return nil
+		}
+
+		latest = latest.DeepCopy()
+		if taint {
+			added := podCIDRUnassignedTaint
+			now := metav1.Now()
+			added.TimeAdded = &now
+			latest.Spec.Taints = append(latest.Spec.Taints, added)
+		} else {
+			latest.Spec.Taints = slices.DeleteFunc(latest.Spec.Taints, isPodCIDRUnassignedTaint)
+		}
+		klog.FromContext(ctx).V(2).Info("Updating node taint", "node", klog.KObj(node), "taint", PodCIDRUnassignedTaintKey, "present", taint)
+		_, err = r.client.CoreV1().Nodes().Update(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func isPodCIDRUnassignedTaint(taint corev1.Taint) bool {
+	return podCIDRUnassignedTaint.MatchTaint(&taint)
+}
+
+func hasPodCIDRUnassignedTaint(node *corev1.Node) bool {
+	return slices.ContainsFunc(node.Spec.Taints, isPodCIDRUnassignedTaint)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+func podCIDRAssignedCondition(t *testing.T, node *corev1.Node) corev1.NodeCondition {
+	t.Helper()
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == PodCIDRAssignedCondition {
+			return condition
+		}
+	}
+	require.Failf(t, "condition not found", "node %s has no %s condition", node.Name, PodCIDRAssignedCondition)
+	return corev1.NodeCondition{}
+}
+
+func TestPodCIDRUnassignedConditionAndTaint(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	// The ClusterCIDR has room for a single node.
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/28", "", 4, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	allocatedNode := makeAllocatedNode("allocated-node", map[string]string{"pool": "a"}, "10.10.0.0/28")
+	exhaustedNode := makeNode("exhausted-node", map[string]string{"pool": "a"})
+	unmatchedNode := makeNode("unmatched-node", map[string]string{"pool": "b"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{allocatedNode, exhaustedNode, unmatchedNode}, clusterCIDR)
+	ra.allocatorParams.ManagePodCIDRUnassignedTaint = true
+	require.NoError(t, ra.bootstrap(ctx))
+	client := ra.client.(*test.FakeNodeHandler)
+
+	for node, reason := range map[*corev1.Node]string{
+		exhaustedNode: PodCIDRAssignedReasonExhausted,
+		unmatchedNode: PodCIDRAssignedReasonNoMatchingClusterCIDR,
+	} {
+		require.Error(t, ra.AllocateOrOccupyCIDR(ctx, node))
+
+		updated, err := client.Get(ctx, node.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		condition := podCIDRAssignedCondition(t, updated)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status, node.Name)
+		assert.Equal(t, reason, condition.Reason, node.Name)
+		assert.True(t, hasPodCIDRUnassignedTaint(updated), node.Name)
+	}
+
+	// The node that already has podCIDRs is reported as assigned.
+	require.NoError(t, ra.AllocateOrOccupyCIDR(ctx, allocatedNode))
+	updated, err := client.Get(ctx, allocatedNode.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ConditionTrue, podCIDRAssignedCondition(t, updated).Status)
+}
+
+func TestPodCIDRAssignedRemovesTaint(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	node := makeNode("node", map[string]string{"pool": "a"})
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "other", Effect: corev1.TaintEffectNoExecute},
+		podCIDRUnassignedTaint,
+	}
+	node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+		Type:   PodCIDRAssignedCondition,
+		Status: corev1.ConditionFalse,
+		Reason: PodCIDRAssignedReasonExhausted,
+	})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	ra.allocatorParams.ManagePodCIDRUnassignedTaint = true
+	require.NoError(t, ra.bootstrap(ctx))
+
+	require.NoError(t, ra.AllocateOrOccupyCIDR(ctx, node))
+
+	updated, err := ra.client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Len(t, updated.Spec.PodCIDRs, 1)
+	condition := podCIDRAssignedCondition(t, updated)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, PodCIDRAssignedReasonAssigned, condition.Reason)
+	assert.Equal(t, []corev1.Taint{{Key: "other", Effect: corev1.TaintEffectNoExecute}}, updated.Spec.Taints)
+}
+
+func TestPodCIDRAssignedUnchanged(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	node := makeAllocatedNode("node", nil, "10.10.1.0/24")
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+	ra.allocatorParams.ManagePodCIDRUnassignedTaint = true
+	require.NoError(t, ra.bootstrap(ctx))
+	client := ra.client.(*test.FakeNodeHandler)
+
+	require.NoError(t, ra.AllocateOrOccupyCIDR(ctx, node))
+	updated, err := client.Get(ctx, node.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ConditionTrue, podCIDRAssignedCondition(t, updated).Status)
+
+	// A resync of the node finds the condition and the taint as they should be.
+	requests := client.RequestCount
+	require.NoError(t, ra.AllocateOrOccupyCIDR(ctx, updated))
+	assert.Equal(t, requests, client.RequestCount)
+}
+
+func TestPodCIDRUnassignedReason(t *testing.T) {
+	assert.Equal(t, PodCIDRAssignedReasonNoMatchingClusterCIDR, podCIDRUnassignedReason(errNoMatchingClusterCIDR))
+	assert.Equal(t, PodCIDRAssignedReasonExhausted, podCIDRUnassignedReason(errClusterCIDRsExhausted))
+	assert.Equal(t, PodCIDRAssignedReasonPatchFailed, podCIDRUnassignedReason(assert.AnError))
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// SkipPodCIDRAllocationKey is the annotation or label that opts a node out
+	// of the podCIDR allocation when set to "true". The podCIDRs such nodes
+	// already have are still marked as used, so they are not handed out to
+	// other nodes.
+	SkipPodCIDRAllocationKey = "networking.x-k8s.io/skip-pod-cidr-allocation"
+)
+
+// departedNodeRecheckInterval is how often the nodes that left the managed set
+// are checked for deletion.
+const departedNodeRecheckInterval = time.Minute
+
+// skipsPodCIDRAllocation returns whether the node opted out of the podCIDR
+// allocation with the SkipPodCIDRAllocationKey annotation or label.
+func skipsPodCIDRAllocation(node *corev1.Node) bool {
+	return node.Annotations[SkipPodCIDRAllocationKey] == "true" || node.Labels[SkipPodCIDRAllocationKey] == "true"
+}
+
+// parseManagedNodeSelector parses the ManagedNodeSelector parameter, an empty
+// selector selects all the nodes.
+func parseManagedNodeSelector(selector string) (labels.Selector, error) {
+	managedNodeSelector, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid managed node selector %q: %w", selector, err)
+	}
+	return managedNodeSelector, nil
+}
+
+// managesNode returns whether the node is selected by the ManagedNodeSelector.
+// The node informer is expected to be filtered with the same selector, this
+// catches the nodes whose labels changed since they were queued.
+func (r *multiCIDRRangeAllocator) managesNode(node *corev1.Node) bool {
+	return r.managedNodeSelector.Matches(labels.Set(node.Labels))
+}
+
+// observeNode marks the podCIDRs of a node the allocator does not update, if
+// they belong to a ClusterCIDR, as used so that they are not handed out to
+// other nodes.
+func (r *multiCIDRRangeAllocator) observeNode(ctx context.Context, node *corev1.Node) {
+	_, hasIntent := node.Annotations[AllocationIntentAnnotationKey]
+	if len(node.Spec.PodCIDRs) == 0 && !hasIntent {
+		return
+	}
+
+	r.lockWithSpan(ctx)
+	defer r.lock.Unlock()
+
+	logger := klog.FromContext(ctx)
+	if len(node.Spec.PodCIDRs) == 0 {
+		// The CIDRs of an unresolved allocation intent may be in use.
+		if _, _, err := r.occupyIntent(logger, node, r.cidrMap); err != nil {
+			logger.V(4).Info("Could not occupy the allocation intent of node", "node", klog.KObj(node), "err", err)
+		}
+		return
+	}
+	if _, err := r.occupyCIDRs(logger, node, r.cidrMap); err != nil {
+		// Like during the bootstrap, the podCIDRs of foreign managed nodes do
+		// not have to belong to a ClusterCIDR.
+		logger.V(4).Info("PodCIDRs of node have no associated ClusterCIDR, skipping", "node", klog.KObj(node), "err", err)
+	}
+}
+
+// departedNodeTracker holds the nodes removed from the node informer while
+// holding CIDRs: with a ManagedNodeSelector, the informer also removes the
+// nodes relabeled out of the selector, which still use their podCIDRs. The
+// nodes that still exist are exported through the unmanagedNodes metric.
+type departedNodeTracker struct {
+	// lock guards nodes and unmanaged.
+	lock sync.Mutex
+	// nodes maps the departed nodes to their last known state.
+	nodes map[string]*corev1.Node
+	// unmanaged holds the departed nodes known to still exist.
+	unmanaged sets.Set[string]
+}
+
+func newDepartedNodeTracker() *departedNodeTracker {
+	return &departedNodeTracker{
+		nodes:     make(map[string]*corev1.Node),
+		unmanaged: sets.New[string](),
+	}
+}
+
+func (t *departedNodeTracker) add(node *corev1.Node) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.nodes[node.Name] = node
+}
+
+func (t *departedNodeTracker) get(name string) *corev1.Node {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.nodes[name]
+}
+
+// markUnmanaged records that the departed node still exists. It returns false
+// if it was already known.
+func (t *departedNodeTracker) markUnmanaged(name string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.unmanaged.Has(name) {
+		return false
+	}
+	t.unmanaged.Insert(name)
+	unmanagedNodes.Set(float64(t.unmanaged.Len()))
+	return true
+}
+
+func (t *departedNodeTracker) remove(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.nodes, name)
+	t.unmanaged.Delete(name)
+	unmanagedNodes.Set(float64(t.unmanaged.Len()))
+}
+
+// mayLeaveManagedSet returns whether a node removed from the informer cache
+// may still exist, its labels no longer matching the ManagedNodeSelector, and
+// hold CIDRs that must then stay marked as used.
+func (r *multiCIDRRangeAllocator) mayLeaveManagedSet(node *corev1.Node) bool {
+	_, hasIntent := node.Annotations[AllocationIntentAnnotationKey]
+	return !r.managedNodeSelector.Empty() && (len(node.Spec.PodCIDRs) > 0 || hasIntent)
+}
+
+// occupyUnmanagedNodes occupies the podCIDRs and allocation intents of the
+// nodes outside the ManagedNodeSelector, which the filtered node informer does
+// not report: nodes relabeled out of the selector, possibly while the
+// controller was not running, still use their podCIDRs. They are tracked as
+// departed nodes, so that their CIDRs are released once they are deleted.
+func (r *multiCIDRRangeAllocator) occupyUnmanagedNodes(ctx context.Context) error {
+	if r.managedNodeSelector.Empty() {
+		return nil
+	}
+	logger := klog.FromContext(ctx)
+	nodes, err := r.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	occupied := 0
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if r.managesNode(node) || !r.mayLeaveManagedSet(node) {
+			continue
+		}
+		// Only the metadata and spec are needed to release the CIDRs.
+		departed := &corev1.Node{ObjectMeta: *node.ObjectMeta.DeepCopy(), Spec: node.Spec}
+		departed.ManagedFields = nil
+		r.departedNodes.add(departed)
+		r.departedNodes.markUnmanaged(departed.Name)
+		r.observeNode(ctx, departed)
+		r.nodeQueue.AddAfter(departed.Name, departedNodeRecheckInterval)
+		occupied++
+	}
+	logger.Info("Occupied the CIDRs of the unmanaged nodes", "nodes", occupied)
+	return nil
+}
+
+// syncDepartedNode releases the CIDRs of a node removed from the informer
+// cache once the node no longer exists. A node that still exists left the
+// managed set: its podCIDRs are kept as used and the node is checked again
+// after departedNodeRecheckInterval, as the informer no longer reports it.
+func (r *multiCIDRRangeAllocator) syncDepartedNode(ctx context.Context, node *corev1.Node) error {
+	logger := klog.FromContext(ctx)
+	current, err := r.client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && current.UID == node.UID {
+		if r.departedNodes.markUnmanaged(node.Name) {
+			logger.Info("Node is no longer managed, keeping its podCIDRs as used", "node", klog.KObj(node), "podCIDRs", node.Spec.PodCIDRs)
+		}
+		r.nodeQueue.AddAfter(node.Name, departedNodeRecheckInterval)
+		return nil
+	}
+
+	r.departedNodes.remove(node.Name)
+	logger.V(2).Info("Departed node was deleted, releasing its CIDRs", "node", klog.KObj(node))
+	return r.ReleaseCIDR(ctx, node)
+}
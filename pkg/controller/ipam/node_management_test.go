@@ -0,0 +1,133 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2/ktesting"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+func TestSyncNodeSkipsOptedOutNodes(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	annotated := makeNode("annotated", map[string]string{"pool": "a"})
+	annotated.Annotations = map[string]string{SkipPodCIDRAllocationKey: "true"}
+	labeled := makeNode("labeled", map[string]string{"pool": "a", SkipPodCIDRAllocationKey: "true"})
+	// The podCIDR was set by another IPAM.
+	foreign := makeAllocatedNode("foreign", map[string]string{"pool": "a", SkipPodCIDRAllocationKey: "true"}, "10.10.7.0/24")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{annotated, labeled, foreign}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	for _, node := range []*corev1.Node{annotated, labeled, foreign} {
+		ra.pendingNodes.update(node)
+		require.NoError(t, ra.syncNode(ctx, node.Name))
+	}
+	assert.Empty(t, ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy())
+	assert.Zero(t, ra.pendingNodes.len())
+
+	// The podCIDR of the foreign node is not handed out to other nodes.
+	nodeSelector, err := ra.nodeSelectorKey(clusterCIDR)
+	require.NoError(t, err)
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.7.0/24")
+	assert.True(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(podCIDR))
+}
+
+func TestManagedNodeSelector(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+
+	unmanaged := makeNode("unmanaged", map[string]string{"pool": "b"})
+	// The node was relabeled out of the managed set after its allocation.
+	relabeled := makeAllocatedNode("relabeled", map[string]string{"pool": "b"}, "10.10.3.0/24")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{unmanaged, relabeled}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+	var err error
+	ra.managedNodeSelector, err = parseManagedNodeSelector("pool=a")
+	require.NoError(t, err)
+
+	require.NoError(t, ra.syncNode(ctx, "unmanaged"))
+	assert.Empty(t, ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy())
+
+	// The filtered informer reports the relabeled node as deleted, a worker
+	// finds out that it still exists.
+	ra.nodeLister = corelisters.NewNodeLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	ra.handleNodeDelete(ctx, relabeled)
+	assert.Equal(t, 1, ra.nodeQueue.Len())
+	require.NoError(t, ra.syncNode(ctx, "relabeled"))
+	nodeSelector, err := ra.nodeSelectorKey(clusterCIDR)
+	require.NoError(t, err)
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.3.0/24")
+	assert.True(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(podCIDR))
+	assert.True(t, ra.departedNodes.unmanaged.Has("relabeled"))
+
+	// Its podCIDRs are released once it is deleted.
+	ra.client.(*test.FakeNodeHandler).Existing = []*corev1.Node{unmanaged}
+	require.NoError(t, ra.syncNode(ctx, "relabeled"))
+	assert.False(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(podCIDR))
+	assert.Nil(t, ra.departedNodes.get("relabeled"))
+
+	_, err = parseManagedNodeSelector("pool in a")
+	assert.Error(t, err)
+}
+
+func TestBootstrapUnmanagedNodes(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+	pending := makeNode("pending", map[string]string{"pool": "a"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{pending}, clusterCIDR)
+	var err error
+	ra.managedNodeSelector, err = parseManagedNodeSelector("pool=a")
+	require.NoError(t, err)
+	// The node was relabeled out of the managed set while the controller was
+	// not running, the filtered informer never reports it.
+	relabeled := makeAllocatedNode("relabeled", map[string]string{"pool": "b"}, "10.10.0.0/24")
+	fakeNodeHandler := ra.client.(*test.FakeNodeHandler)
+	fakeNodeHandler.Existing = append(fakeNodeHandler.Existing, relabeled)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	nodeSelector, err := ra.nodeSelectorKey(clusterCIDR)
+	require.NoError(t, err)
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.0.0/24")
+	assert.True(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(podCIDR))
+	assert.True(t, ra.departedNodes.unmanaged.Has("relabeled"))
+
+	// Its podCIDR is not handed out to the managed nodes.
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	assert.Equal(t, []string{"10.10.1.0/24"}, updatedNode(t, ra, "pending").Spec.PodCIDRs)
+
+	// Its podCIDR is released once it is deleted.
+	fakeNodeHandler.Existing = []*corev1.Node{pending}
+	require.NoError(t, ra.syncNode(ctx, "relabeled"))
+	assert.False(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(podCIDR))
+	assert.Nil(t, ra.departedNodes.get("relabeled"))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ClusterCIDRAnnotationKey is the annotation recording on a node the name of
+	// the ClusterCIDR its podCIDRs were allocated from.
+	ClusterCIDRAnnotationKey = "networking.x-k8s.io/cluster-cidr"
+	// ClusterCIDRLabelKey is the label recording on a node the name of the
+	// ClusterCIDR its podCIDRs were allocated from, if enabled.
+	ClusterCIDRLabelKey = "networking.x-k8s.io/cluster-cidr"
+)
+
+type nodeForCIDRMergePatch struct {
+	Metadata *nodeMetadataForMergePatch `json:"metadata,omitempty"`
+	Spec     *nodeSpecForMergePatch     `json:"spec,omitempty"`
+}
+
+type nodeMetadataForMergePatch struct {
+	// ResourceVersion makes the patch fail with a conflict if the node changed.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Annotations set to nil are removed.
+	Annotations map[string]*string `json:"annotations,omitempty"`
+	Labels      map[string]string  `json:"labels,omitempty"`
+}
+
+type nodeSpecForMergePatch struct {
+	PodCIDR  string   `json:"podCIDR"`
+	PodCIDRs []string `json:"podCIDRs,omitempty"`
+}
+
+// clusterCIDRMetadata returns the annotations and labels recording the
+// ClusterCIDR on the node.
+func (r *multiCIDRRangeAllocator) clusterCIDRMetadata(logger klog.Logger, clusterCIDRName string) *nodeMetadataForMergePatch {
+	metadata := &nodeMetadataForMergePatch{
+		Annotations: map[string]*string{ClusterCIDRAnnotationKey: &clusterCIDRName},
+	}
+	if !r.allocatorParams.SetClusterCIDRLabel {
+		return metadata
+	}
+	// ClusterCIDR names may be longer than label values.
+	if errs := validation.IsValidLabelValue(clusterCIDRName); len(errs) > 0 {
+		logger.V(2).Info("ClusterCIDR name is not a valid label value, not labeling the node", "clusterCIDR", clusterCIDRName, "errors", errs)
+		return metadata
+	}
+	metadata.Labels = map[string]string{ClusterCIDRLabelKey: clusterCIDRName}
+	return metadata
+}
+
+// recordsClusterCIDR returns whether the node records the ClusterCIDR as
+// clusterCIDRMetadata would.
+func recordsClusterCIDR(node *corev1.Node, metadata *nodeMetadataForMergePatch) bool {
+	for key, value := range metadata.Annotations {
+		if recorded, ok := node.Annotations[key]; ok != (value != nil) || (ok && recorded != *value) {
+			return false
+		}
+	}
+	for key, value := range metadata.Labels {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// patchResourceVersion returns the resourceVersion the podCIDRs patch of the
+// node is conditioned on. Sharded allocators make sure no other replica set
+// the podCIDRs in the meantime, the patch is unconditional otherwise.
+func (r *multiCIDRRangeAllocator) patchResourceVersion(node *corev1.Node) string {
+	if !r.sharded() {
+		return ""
+	}
+	return node.ResourceVersion
+}
+
+// recordAllocationIntent records the intent on the node before its podCIDRs
+// are patched and returns the updated node. The patch fails with a conflict if
+// resourceVersion is set and the node changed.
+func (r *multiCIDRRangeAllocator) recordAllocationIntent(ctx context.Context, nodeName, resourceVersion string, intent allocationIntent) (*corev1.Node, error) {
+	value := intent.String()
+	return r.patchNode(ctx, nodeName, nodeForCIDRMergePatch{
+		Metadata: &nodeMetadataForMergePatch{
+			ResourceVersion: resourceVersion,
+			Annotations:     map[string]*string{AllocationIntentAnnotationKey: &value},
+		},
+	})
+}
+
+// patchNodeCIDRs sets the podCIDRs of the node, records the ClusterCIDR they
+// were allocated from and removes the allocation intent and the exhausted
+// ClusterCIDRs, in a single patch. The
+// patch fails with a conflict if resourceVersion is set and the node changed.
+func (r *multiCIDRRangeAllocator) patchNodeCIDRs(ctx context.Context, nodeName, resourceVersion string, cidrs []string, clusterCIDRName string) error {
+	logger := klog.FromContext(ctx)
+	metadata := r.clusterCIDRMetadata(logger, clusterCIDRName)
+	metadata.ResourceVersion = resourceVersion
+	metadata.Annotations[AllocationIntentAnnotationKey] = nil
+	metadata.Annotations[ExhaustedClusterCIDRsAnnotationKey] = nil
+	_, err := r.patchNode(ctx, nodeName, nodeForCIDRMergePatch{
+		Metadata: metadata,
+		Spec: &nodeSpecForMergePatch{
+			PodCIDR:  cidrs[0],
+			PodCIDRs: cidrs,
+		},
+	})
+	return err
+}
+
+// recordClusterCIDR records the ClusterCIDR on a node that already has its
+// podCIDRs, unless it is already recorded.
+func (r *multiCIDRRangeAllocator) recordClusterCIDR(ctx context.Context, node *corev1.Node, clusterCIDRName string) error {
+	logger := klog.FromContext(ctx)
+	metadata := r.clusterCIDRMetadata(logger, clusterCIDRName)
+	if recordsClusterCIDR(node, metadata) {
+		return nil
+	}
+	logger.V(2).Info("Recording ClusterCIDR on node", "node", klog.KObj(node), "clusterCIDR", clusterCIDRName)
+	if _, err := r.patchNode(ctx, node.Name, nodeForCIDRMergePatch{Metadata: metadata}); err != nil {
+		return fmt.Errorf("failed to record clusterCIDR %s on node %s: %w", clusterCIDRName, node.Name, err)
+	}
+	return nil
+}
+
+func (r *multiCIDRRangeAllocator) patchNode(ctx context.Context, nodeName string, patch nodeForCIDRMergePatch) (*corev1.Node, error) {
+	patchBytes, err := json.Marshal(&patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json.Marshal node patch: %w", err)
+	}
+	klog.FromContext(ctx).V(4).Info("node patch bytes", "node", klog.KRef("", nodeName), "patchBytes", string(patchBytes))
+	return r.client.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+}
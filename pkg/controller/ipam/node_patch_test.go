@@ -0,0 +1,91 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+	utilnet "k8s.io/utils/net"
+)
+
+func TestClusterCIDRRecordedOnNode(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	newNode := makeNode("new-node", map[string]string{"pool": "a"})
+	// Allocated before the ClusterCIDR was recorded on the nodes.
+	allocatedNode := makeAllocatedNode("allocated-node", map[string]string{"pool": "a"}, "10.10.3.0/24")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{newNode, allocatedNode}, clusterCIDR)
+	ra.allocatorParams.SetClusterCIDRLabel = true
+	require.NoError(t, ra.bootstrap(ctx))
+
+	for _, node := range []*corev1.Node{newNode, allocatedNode} {
+		require.NoError(t, ra.AllocateOrOccupyCIDR(ctx, node))
+
+		updated, err := ra.client.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Len(t, updated.Spec.PodCIDRs, 1, node.Name)
+		assert.Equal(t, "cc", updated.Annotations[ClusterCIDRAnnotationKey], node.Name)
+		assert.Equal(t, "cc", updated.Labels[ClusterCIDRLabelKey], node.Name)
+		// The patch keeps the existing labels.
+		assert.Equal(t, "a", updated.Labels["pool"], node.Name)
+	}
+}
+
+func TestBootstrapUsesRecordedClusterCIDR(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	// The node was relabeled after the allocation, the ClusterCIDR no longer
+	// selects it.
+	node := withClusterCIDRAnnotation(makeAllocatedNode("node", map[string]string{"pool": "b"}, "10.10.3.0/24"), "cc")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	recorded := recordedClusterCIDR(node, ra.cidrMap)
+	require.NotNil(t, recorded)
+	assert.Equal(t, map[string]bool{"node": true}, recorded.AssociatedNodes)
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.3.0/24")
+	assert.True(t, recorded.IPv4CIDRSet.CIDRAllocated(podCIDR))
+
+	// The release also follows the annotation.
+	require.NoError(t, ra.ReleaseCIDR(ctx, node))
+	assert.False(t, recorded.IPv4CIDRSet.CIDRAllocated(podCIDR))
+	assert.Empty(t, recorded.AssociatedNodes)
+}
+
+func TestClusterCIDRLabelSkipsInvalidValues(t *testing.T) {
+	logger, _ := ktesting.NewTestContext(t)
+	ra := &multiCIDRRangeAllocator{allocatorParams: CIDRAllocatorParams{SetClusterCIDRLabel: true}}
+
+	metadata := ra.clusterCIDRMetadata(logger, "cc")
+	assert.Equal(t, map[string]string{ClusterCIDRLabelKey: "cc"}, metadata.Labels)
+
+	longName := "a-very-long-cluster-cidr-name-that-does-not-fit-into-a-label-value-because-it-is-too-long"
+	metadata = ra.clusterCIDRMetadata(logger, longName)
+	assert.Equal(t, map[string]*string{ClusterCIDRAnnotationKey: &longName}, metadata.Annotations)
+	assert.Empty(t, metadata.Labels)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// pendingNodeTracker keeps track of the nodes that are waiting for a podCIDR
+// and exports their number through the pendingNodes metric. The pending nodes
+// are indexed by the ClusterCIDR node selectors they match, so that they can
+// be retried as soon as one of these ClusterCIDRs has free CIDRs.
+type pendingNodeTracker struct {
+	// lock guards nodes and selectors.
+	lock sync.Mutex
+	// nodes maps the pending nodes to their labels.
+	nodes map[string]labels.Set
+	// selectors maps the node selector keys of the cidrMap that were looked up
+	// to the pending nodes matching them.
+	selectors map[string]*selectorIndex
+}
+
+// selectorIndex holds the pending nodes matching a node selector key.
+type selectorIndex struct {
+	// matchAll is set for the catch-all selector of the default ClusterCIDR.
+	matchAll bool
+	selector labels.Selector
+	nodes    sets.Set[string]
+}
+
+func (s *selectorIndex) matches(nodeLabels labels.Set) bool {
+	return s.matchAll || (s.selector != nil && s.selector.Matches(nodeLabels))
+}
+
+func newPendingNodeTracker() *pendingNodeTracker {
+	return &pendingNodeTracker{
+		nodes:     make(map[string]labels.Set),
+		selectors: make(map[string]*selectorIndex),
+	}
+}
+
+// update marks the node as pending if it has no podCIDRs, is not being
+// deleted and did not opt out of the allocation, and as not pending otherwise.
+func (t *pendingNodeTracker) update(node *corev1.Node) {
+	if len(node.Spec.PodCIDRs) == 0 && node.DeletionTimestamp.IsZero() && !skipsPodCIDRAllocation(node) {
+		t.add(node.Name, node.Labels)
+		return
+	}
+	t.remove(node.Name)
+}
+
+// trackPendingNode updates the pending state of the node. Only the nodes the
+// allocator manages and owns are tracked, the other ones are not allocated by
+// it and must neither be counted nor retried.
+func (r *multiCIDRRangeAllocator) trackPendingNode(node *corev1.Node) {
+	if !r.managesNode(node) || !r.ownsNode(node) {
+		r.pendingNodes.remove(node.Name)
+		return
+	}
+	r.pendingNodes.update(node)
+}
+
+// retrackPendingNodes re-evaluates the pending state of all the nodes, as the
+// owner of a node changes with the ClusterCIDRs of the other controllers. It
+// waits for the node informer to sync, Run tracks all the nodes once it did.
+func (r *multiCIDRRangeAllocator) retrackPendingNodes(logger klog.Logger) {
+	if !r.nodesSynced() {
+		return
+	}
+	nodes, err := r.nodeLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list nodes to track the pending ones")
+		return
+	}
+	for _, node := range nodes {
+		r.trackPendingNode(node)
+	}
+}
+
+func (t *pendingNodeTracker) add(name string, nodeLabels map[string]string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.nodes[name] = labels.Set(nodeLabels)
+	for _, index := range t.selectors {
+		if index.matches(nodeLabels) {
+			index.nodes.Insert(name)
+		} else {
+			index.nodes.Delete(name)
+		}
+	}
+	pendingNodes.Set(float64(len(t.nodes)))
+}
+
+func (t *pendingNodeTracker) remove(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.nodes, name)
+	for _, index := range t.selectors {
+		index.nodes.Delete(name)
+	}
+	pendingNodes.Set(float64(len(t.nodes)))
+}
+
+// len returns the number of pending nodes.
+func (t *pendingNodeTracker) len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return len(t.nodes)
+}
+
+// names returns all the pending nodes.
+func (t *pendingNodeTracker) names() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return slices.Sorted(maps.Keys(t.nodes))
+}
+
+// matching returns the pending nodes matched by the node selector key of a
+// ClusterCIDR, as used in the cidrMap.
+func (t *pendingNodeTracker) matching(selectorKey string) []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	index, ok := t.selectors[selectorKey]
+	if !ok {
+		index = newSelectorIndex(selectorKey)
+		for name, nodeLabels := range t.nodes {
+			if index.matches(nodeLabels) {
+				index.nodes.Insert(name)
+			}
+		}
+		t.selectors[selectorKey] = index
+	}
+	return sets.List(index.nodes)
+}
+
+// forget drops the index of a node selector key no ClusterCIDR uses anymore.
+func (t *pendingNodeTracker) forget(selectorKey string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.selectors, selectorKey)
+}
+
+func newSelectorIndex(selectorKey string) *selectorIndex {
+	index := &selectorIndex{nodes: sets.New[string]()}
+	defaultSelector, err := nodeSelectorAsSelector(defaultNodeSelector())
+	if err == nil && selectorKey == defaultSelector.String() {
+		index.matchAll = true
+		return index
+	}
+	// Keys that cannot be parsed match no node, as in matchCIDRLabels.
+	if selector, err := labels.Parse(selectorKey); err == nil {
+		index.selector = selector
+	}
+	return index
+}
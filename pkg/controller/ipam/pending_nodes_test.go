@@ -0,0 +1,127 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestPendingNodeTrackerMatching(t *testing.T) {
+	poolA, err := nodeSelectorAsSelector(makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	require.NoError(t, err)
+	defaultSelector, err := nodeSelectorAsSelector(defaultNodeSelector())
+	require.NoError(t, err)
+
+	tracker := newPendingNodeTracker()
+	tracker.update(makeNode("node-a", map[string]string{"pool": "a"}))
+	tracker.update(makeNode("node-b", map[string]string{"pool": "b"}))
+
+	assert.Equal(t, []string{"node-a"}, tracker.matching(poolA.String()))
+	assert.Equal(t, []string{"node-a", "node-b"}, tracker.matching(defaultSelector.String()))
+
+	// The indexes follow the node updates.
+	tracker.update(makeNode("node-b", map[string]string{"pool": "a"}))
+	tracker.update(makeNode("node-c", map[string]string{"pool": "a"}))
+	tracker.remove("node-a")
+	assert.Equal(t, []string{"node-b", "node-c"}, tracker.matching(poolA.String()))
+
+	allocated := makeAllocatedNode("node-b", map[string]string{"pool": "a"}, "10.0.0.0/24")
+	tracker.update(allocated)
+	assert.Equal(t, []string{"node-c"}, tracker.matching(poolA.String()))
+
+	tracker.forget(poolA.String())
+	assert.NotContains(t, tracker.selectors, poolA.String())
+}
+
+func TestPendingNodesRetriedOnNewCapacity(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	// The ClusterCIDR has room for a single node.
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/28", "", 4, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	allocatedNode := makeAllocatedNode("allocated-node", map[string]string{"pool": "a"}, "10.10.0.0/28")
+	pendingNode := makeNode("pending-node", map[string]string{"pool": "a"})
+	otherNode := makeNode("other-node", map[string]string{"pool": "b"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{allocatedNode, pendingNode, otherNode}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+	for _, node := range []*corev1.Node{allocatedNode, pendingNode, otherNode} {
+		ra.pendingNodes.update(node)
+	}
+	require.Error(t, ra.AllocateOrOccupyCIDR(ctx, pendingNode))
+	assert.Equal(t, 0, ra.nodeQueue.Len())
+
+	// Releasing the CIDR of a node retries the pending nodes of the ClusterCIDR.
+	require.NoError(t, ra.ReleaseCIDR(ctx, allocatedNode))
+	assert.Equal(t, 1, ra.nodeQueue.Len())
+	key, _ := ra.nodeQueue.Get()
+	assert.Equal(t, "pending-node", key)
+	ra.nodeQueue.Done(key)
+
+	// A new ClusterCIDR retries the pending nodes it selects.
+	newClusterCIDR := makeClusterCIDR("cc-b", "10.20.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"b"}))
+	require.NoError(t, ra.reconcileCreate(ctx, newClusterCIDR))
+	assert.Equal(t, 1, ra.nodeQueue.Len())
+	key, _ = ra.nodeQueue.Get()
+	assert.Equal(t, "other-node", key)
+	ra.nodeQueue.Done(key)
+}
+
+func TestPendingNodesManagedAndOwned(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	const gpuController = "example.com/gpu-ipam"
+
+	gpu := makeSyncedClusterCIDR("gpu", "10.1.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"gpu"}))
+	gpu.Spec.ControllerName = gpuController
+	general := makeSyncedClusterCIDR("general", "10.2.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"general"}))
+	nodes := []*corev1.Node{
+		makeNode("gpu-node", map[string]string{"pool": "gpu"}),
+		makeNode("general-node", map[string]string{"pool": "general"}),
+		makeNode("unmanaged-node", map[string]string{"pool": "general", "ipam": "off"}),
+	}
+
+	ra := newBootstrapTestAllocator(t, ctx, nodes, gpu, general)
+	require.NoError(t, ra.bootstrap(ctx))
+	var err error
+	ra.managedNodeSelector, err = parseManagedNodeSelector("ipam!=off")
+	require.NoError(t, err)
+	ra.nodesSynced = func() bool { return true }
+
+	// The nodes of the other controller and the unmanaged ones are not pending.
+	for _, node := range nodes {
+		ra.trackPendingNode(node)
+	}
+	assert.Equal(t, []string{"general-node"}, ra.pendingNodes.names())
+
+	// The nodes are tracked again when the owner of a ClusterCIDR changes.
+	handedOver := gpu.DeepCopy()
+	handedOver.Spec.ControllerName = ""
+	require.True(t, ra.clusterCIDROwners.update(handedOver))
+	ra.retrackPendingNodes(klog.FromContext(ctx))
+	assert.Equal(t, []string{"general-node", "gpu-node"}, ra.pendingNodes.names())
+
+	// Changes that do not affect the owners are ignored.
+	assert.False(t, ra.clusterCIDROwners.update(handedOver.DeepCopy()))
+	assert.True(t, ra.clusterCIDROwners.remove("gpu"))
+	assert.False(t, ra.clusterCIDROwners.remove("gpu"))
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	netutil "k8s.io/utils/net"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// clusterCIDRNameSeparator separates the names of the ClusterCIDRs of the
+// podCIDRs of a node allocated from several ClusterCIDRs. ClusterCIDR names are
+// DNS labels, which can not contain it.
+const clusterCIDRNameSeparator = ","
+
+// ipFamilies are the IP families of the podCIDRs of a node, in the order of
+// node.spec.podCIDRs.
+var ipFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+
+// clusterCIDRNames returns the name recorded in the ClusterCIDRAnnotationKey
+// annotation of a node whose podCIDRs come from the given ClusterCIDRs, by
+// index: the name of the ClusterCIDR if they all come from the same one, the
+// names of the ClusterCIDR of each podCIDR otherwise.
+func clusterCIDRNames(clusterCIDRs []*cidrset.ClusterCIDR) string {
+	names := make([]string, 0, len(clusterCIDRs))
+	for _, clusterCIDR := range clusterCIDRs {
+		names = append(names, clusterCIDR.Name)
+	}
+	if len(slices.Compact(slices.Clone(names))) == 1 {
+		return names[0]
+	}
+	return strings.Join(names, clusterCIDRNameSeparator)
+}
+
+// splitClusterCIDRNames returns the names of the ClusterCIDRs recorded by
+// clusterCIDRNames.
+func splitClusterCIDRNames(value string) []string {
+	return strings.Split(value, clusterCIDRNameSeparator)
+}
+
+// clusterCIDRNamesOf returns the name of the ClusterCIDR of each of the count
+// podCIDRs recorded by clusterCIDRNames, nil if it does not record as many.
+func clusterCIDRNamesOf(value string, count int) []string {
+	names := splitClusterCIDRNames(value)
+	switch len(names) {
+	case count:
+		return names
+	case 1:
+		return slices.Repeat(names, count)
+	default:
+		return nil
+	}
+}
+
+// repeatClusterCIDR returns the ClusterCIDRs of count podCIDRs allocated from
+// the same ClusterCIDR.
+func repeatClusterCIDR(clusterCIDR *cidrset.ClusterCIDR, count int) []*cidrset.ClusterCIDR {
+	return slices.Repeat([]*cidrset.ClusterCIDR{clusterCIDR}, count)
+}
+
+// distinctClusterCIDRs returns the ClusterCIDRs without duplicates, in order.
+func distinctClusterCIDRs(clusterCIDRs []*cidrset.ClusterCIDR) []*cidrset.ClusterCIDR {
+	distinct := make([]*cidrset.ClusterCIDR, 0, len(clusterCIDRs))
+	for _, clusterCIDR := range clusterCIDRs {
+		if !slices.Contains(distinct, clusterCIDR) {
+			distinct = append(distinct, clusterCIDR)
+		}
+	}
+	return distinct
+}
+
+// familyCIDRSet returns the cidrSet of the ClusterCIDR of the IP family, nil if
+// it has none.
+func familyCIDRSet(clusterCIDR *cidrset.ClusterCIDR, family corev1.IPFamily) *cidrset.MultiCIDRSet {
+	if family == corev1.IPv6Protocol {
+		return clusterCIDR.IPv6CIDRSet
+	}
+	return clusterCIDR.IPv4CIDRSet
+}
+
+// cidrFamily returns the IP family of the CIDR.
+func cidrFamily(cidr *net.IPNet) corev1.IPFamily {
+	if netutil.IsIPv6CIDR(cidr) {
+		return corev1.IPv6Protocol
+	}
+	return corev1.IPv4Protocol
+}
+
+// selectsPerFamily returns whether the ClusterCIDR of each podCIDR of the node
+// is resolved independently: with per-family selection, or if the node records
+// podCIDRs from several ClusterCIDRs.
+func (r *multiCIDRRangeAllocator) selectsPerFamily(node *corev1.Node) bool {
+	return r.allocatorParams.PerFamilyClusterCIDRs || strings.Contains(node.Annotations[ClusterCIDRAnnotationKey], clusterCIDRNameSeparator)
+}
+
+// recordedClusterCIDRs requires the caller to hold r.lock.
+// recordedClusterCIDRs returns the ClusterCIDR recorded in the node annotation
+// for each podCIDR, nil for the podCIDRs it is not recorded for.
+func recordedClusterCIDRs(node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) []*cidrset.ClusterCIDR {
+	recorded := make([]*cidrset.ClusterCIDR, len(node.Spec.PodCIDRs))
+	if value, ok := node.Annotations[ClusterCIDRAnnotationKey]; ok {
+		for i, name := range clusterCIDRNamesOf(value, len(node.Spec.PodCIDRs)) {
+			recorded[i] = clusterCIDRByName(name, cidrMap)
+		}
+	}
+	return recorded
+}
+
+// podCIDRCandidates returns the ClusterCIDRs a podCIDR may belong to: the one
+// recorded for it on the node first, then the given ones.
+func podCIDRCandidates(recorded *cidrset.ClusterCIDR, clusterCIDRs []*cidrset.ClusterCIDR) []*cidrset.ClusterCIDR {
+	if recorded == nil {
+		return clusterCIDRs
+	}
+	return append([]*cidrset.ClusterCIDR{recorded}, clusterCIDRs...)
+}
+
+// containsCIDR returns whether the CIDR is in the range of the ClusterCIDR of
+// its family.
+func containsCIDR(clusterCIDR *cidrset.ClusterCIDR, cidr *net.IPNet) bool {
+	cidrSet := familyCIDRSet(clusterCIDR, cidrFamily(cidr))
+	return cidrSet != nil && cidrSet.ClusterCIDR.Contains(cidr.IP)
+}
+
+// perFamilyCIDRs requires the caller to hold r.lock.
+// perFamilyCIDRs returns the CIDRs to be allocated to the node and the
+// ClusterCIDR of each, selecting the ClusterCIDR of each IP family
+// independently: the IPv4 CIDR comes from the best matching ClusterCIDR with an
+// IPv4 range, the IPv6 CIDR from the best matching ClusterCIDR with an IPv6
+// range. A ClusterCIDR pairing its families provides both CIDRs. The
+// ClusterCIDRs considered and the outcome are recorded in decision.
+func (r *multiCIDRRangeAllocator) perFamilyCIDRs(
+	ctx context.Context, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR, decision *allocationDecision,
+) ([]*net.IPNet, []*cidrset.ClusterCIDR, error) {
+	logger := klog.FromContext(ctx)
+	_, span := r.tracer.Start(ctx, "matchClusterCIDRs")
+	ranked, err := r.rankedClusterCIDRs(node, cidrMap)
+	span.SetAttributes(attribute.Int("matchingClusterCIDRs", len(ranked)))
+	endSpan(span, err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, err)
+	}
+	decision.addCandidates(ranked)
+
+	var cidrs []*net.IPNet
+	var clusterCIDRs []*cidrset.ClusterCIDR
+	var selected []int
+	for _, family := range ipFamilies {
+		if slices.ContainsFunc(cidrs, func(cidr *net.IPNet) bool { return cidrFamily(cidr) == family }) {
+			continue
+		}
+		matched, usable, allocated := false, false, false
+		for i, pqItem := range ranked {
+			clusterCIDR := pqItem.clusterCIDR
+			cidrSet := familyCIDRSet(clusterCIDR, family)
+			if cidrSet == nil {
+				continue
+			}
+			matched = true
+			// Only use the CIDRsets which are not marked for termination.
+			if clusterCIDR.Terminating && !pqItem.catchAll {
+				decision.setOutcome(i, candidateTerminating, nil)
+				continue
+			}
+			usable = true
+			if !r.ownsClusterCIDRShard(clusterCIDR.Name) {
+				decision.setOutcome(i, candidateOtherShard, nil)
+				continue
+			}
+
+			var familyCIDRs []*net.IPNet
+			if pairsFamilies(clusterCIDR) {
+				familyCIDRs, err = r.allocatePairedCIDRs(ctx, node, clusterCIDR, cidrMap)
+			} else {
+				var cidr *net.IPNet
+				cidr, err = r.allocateCIDR(ctx, node, clusterCIDR, cidrSet, cidrMap)
+				familyCIDRs = []*net.IPNet{cidr}
+			}
+			if err != nil {
+				logger.V(3).Info("Unable to allocate CIDR, trying next range", "family", family, "err", err)
+				// A ClusterCIDR selected for the other family keeps its outcome.
+				if decision.Candidates[i].Outcome != candidateSelected {
+					decision.setOutcome(i, candidateExhausted, err)
+				}
+				continue
+			}
+			for _, cidr := range familyCIDRs {
+				cidrs = append(cidrs, cidr)
+				clusterCIDRs = append(clusterCIDRs, clusterCIDR)
+			}
+			selected = append(selected, i)
+			allocated = true
+			break
+		}
+
+		// The node would never get a CIDR of the family once its podCIDRs
+		// are set, so none is allocated until one is available.
+		if matched && !allocated {
+			r.releaseReservedCIDRs(logger, cidrs, clusterCIDRs)
+			if !usable {
+				return nil, nil, fmt.Errorf("unable to get an %s clusterCIDR for node %s: %w", family, node.Name, errNoMatchingClusterCIDR)
+			}
+			return nil, nil, fmt.Errorf("unable to get an %s clusterCIDR for node %s: %w", family, node.Name, errClusterCIDRsExhausted)
+		}
+	}
+	if len(cidrs) == 0 {
+		return nil, nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, errNoMatchingClusterCIDR)
+	}
+
+	decision.selectedPerFamily(selected, clusterCIDRNames(clusterCIDRs), ipnetToStringList(cidrs))
+	return cidrs, clusterCIDRs, nil
+}
+
+// releaseReservedCIDRs requires the caller to hold r.lock.
+// releaseReservedCIDRs unreserves the CIDRs reserved for an allocation that
+// can not be completed.
+func (r *multiCIDRRangeAllocator) releaseReservedCIDRs(logger klog.Logger, cidrs []*net.IPNet, clusterCIDRs []*cidrset.ClusterCIDR) {
+	for i, cidr := range cidrs {
+		if err := r.Unreserve(logger, clusterCIDRs[i], cidr); err != nil {
+			logger.Error(err, "Failed to release the reserved CIDR", "CIDR", cidr, "clusterCIDR", clusterCIDRs[i].Name)
+		}
+	}
+}
+
+// occupyCIDRsPerFamily requires the caller to hold r.lock.
+// occupyCIDRsPerFamily marks each podCIDR of the node as used in the first
+// ClusterCIDR able to occupy it: the ClusterCIDR recorded for it on the node,
+// then the ClusterCIDRs matching the node in priority order. It returns the
+// ClusterCIDR of each podCIDR.
+func (r *multiCIDRRangeAllocator) occupyCIDRsPerFamily(logger klog.Logger, node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*cidrset.ClusterCIDR, error) {
+	matching, err := r.orderedMatchingClusterCIDRs(node, true, cidrMap)
+	if err != nil {
+		return nil, err
+	}
+	recorded := recordedClusterCIDRs(node, cidrMap)
+
+	clusterCIDRs := make([]*cidrset.ClusterCIDR, 0, len(node.Spec.PodCIDRs))
+	for i, cidr := range node.Spec.PodCIDRs {
+		_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CIDR %s on Node %v: %w", cidr, node.Name, err)
+		}
+
+		logger.Info("occupy CIDR for node", "CIDR", cidr, "node", klog.KObj(node))
+		var occupied *cidrset.ClusterCIDR
+		for _, clusterCIDR := range podCIDRCandidates(recorded[i], matching) {
+			if !containsCIDR(clusterCIDR, podCIDR) {
+				continue
+			}
+			if err := r.Occupy(clusterCIDR, podCIDR); err != nil {
+				logger.V(3).Info("Could not occupy cidr, trying next range", "podCIDR", cidr, "err", err)
+				continue
+			}
+			occupied = clusterCIDR
+			break
+		}
+		if occupied == nil {
+			return nil, fmt.Errorf("could not occupy cidr %s of node %s, No matching ClusterCIDRs found", cidr, node.Name)
+		}
+		clusterCIDRs = append(clusterCIDRs, occupied)
+	}
+
+	for _, clusterCIDR := range distinctClusterCIDRs(clusterCIDRs) {
+		clusterCIDR.AssociatedNodes[node.Name] = true
+	}
+	return clusterCIDRs, nil
+}
+
+// allocatedClusterCIDRsPerFamily requires the caller to hold r.lock.
+// allocatedClusterCIDRsPerFamily returns the ClusterCIDR from which each of the
+// node CIDRs was allocated, see allocatedClusterCIDRs.
+func (r *multiCIDRRangeAllocator) allocatedClusterCIDRsPerFamily(node *corev1.Node, cidrMap map[string][]*cidrset.ClusterCIDR) ([]*cidrset.ClusterCIDR, error) {
+	matching, err := r.orderedMatchingClusterCIDRs(node, false, cidrMap)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, err)
+	}
+	recorded := recordedClusterCIDRs(node, cidrMap)
+
+	clusterCIDRs := make([]*cidrset.ClusterCIDR, 0, len(node.Spec.PodCIDRs))
+	for i, cidr := range node.Spec.PodCIDRs {
+		_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CIDR %q on Node %q: %w", cidr, node.Name, err)
+		}
+		candidates := podCIDRCandidates(recorded[i], matching)
+		j := slices.IndexFunc(candidates, func(clusterCIDR *cidrset.ClusterCIDR) bool {
+			return clusterCIDR.AssociatedNodes[node.Name] && containsCIDR(clusterCIDR, podCIDR)
+		})
+		if j == -1 {
+			return nil, fmt.Errorf("no clusterCIDR found associated with podCIDR %s of node: %s", cidr, node.Name)
+		}
+		clusterCIDRs = append(clusterCIDRs, candidates[j])
+	}
+	return clusterCIDRs, nil
+}
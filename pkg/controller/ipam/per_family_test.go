@@ -0,0 +1,124 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+)
+
+// makePerFamilyClusterCIDRs returns an IPv4 ClusterCIDR selecting the nodes of
+// rack a and a cluster-wide IPv6 ClusterCIDR.
+func makePerFamilyClusterCIDRs(ipv6 string) []*v1.ClusterCIDR {
+	return []*v1.ClusterCIDR{
+		makeSyncedClusterCIDR("rack-a", "10.10.0.0/16", "", 8, makeNodeSelector("rack", corev1.NodeSelectorOpIn, []string{"a"})),
+		makeSyncedClusterCIDR("global-v6", "", ipv6, 8, nil),
+	}
+}
+
+func withClusterCIDRAnnotation(node *corev1.Node, clusterCIDRs string) *corev1.Node {
+	node.Annotations = map[string]string{ClusterCIDRAnnotationKey: clusterCIDRs}
+	return node
+}
+
+func TestClusterCIDRNamesOf(t *testing.T) {
+	testCases := []struct {
+		value string
+		count int
+		want  []string
+	}{
+		{value: "cc", count: 1, want: []string{"cc"}},
+		{value: "cc", count: 2, want: []string{"cc", "cc"}},
+		{value: "rack-a,global-v6", count: 2, want: []string{"rack-a", "global-v6"}},
+		{value: "rack-a,global-v6", count: 1, want: nil},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, clusterCIDRNamesOf(tc.value, tc.count), "%s for %d podCIDRs", tc.value, tc.count)
+	}
+}
+
+func TestPerFamilyAllocation(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{makeNode("node", map[string]string{"rack": "a"})}, makePerFamilyClusterCIDRs("fd00:10::/112")...)
+	ra.allocatorParams.PerFamilyClusterCIDRs = true
+	require.NoError(t, ra.bootstrap(ctx))
+
+	require.NoError(t, ra.syncNode(ctx, "node"))
+	node := updatedNode(t, ra, "node")
+	assert.Equal(t, []string{"10.10.0.0/24", "fd00:10::/120"}, node.Spec.PodCIDRs)
+	assert.Equal(t, "rack-a,global-v6", node.Annotations[ClusterCIDRAnnotationKey])
+	decision, ok := ra.decisions.get("node")
+	require.True(t, ok)
+	assert.Equal(t, "rack-a,global-v6", decision.ClusterCIDR)
+
+	rack, global := clusterCIDRByName("rack-a", ra.cidrMap), clusterCIDRByName("global-v6", ra.cidrMap)
+	assert.True(t, rack.AssociatedNodes["node"])
+	assert.True(t, global.AssociatedNodes["node"])
+
+	// The podCIDRs are released from their own ClusterCIDR.
+	require.NoError(t, ra.ReleaseCIDR(ctx, node))
+	assert.Zero(t, rack.IPv4CIDRSet.AllocatedCount())
+	assert.Zero(t, global.IPv6CIDRSet.AllocatedCount())
+	assert.Empty(t, rack.AssociatedNodes)
+	assert.Empty(t, global.AssociatedNodes)
+}
+
+func TestPerFamilyAllocationExhausted(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	// The IPv6 ClusterCIDR has a single podCIDR, already allocated.
+	nodes := []*corev1.Node{
+		withClusterCIDRAnnotation(makeAllocatedNode("allocated", map[string]string{"rack": "a"}, "10.10.0.0/24", "fd00:10::/120"), "rack-a,global-v6"),
+		makeNode("new", map[string]string{"rack": "a"}),
+	}
+	clusterCIDRs := makePerFamilyClusterCIDRs("fd00:10::/120")
+	clusterCIDRs[0].Spec.ReuseCooldownSeconds = 3600
+	ra := newBootstrapTestAllocator(t, ctx, nodes, clusterCIDRs...)
+	ra.allocatorParams.PerFamilyClusterCIDRs = true
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// The IPv4 podCIDR is not kept for a node that can not get both, nor
+	// quarantined since no node got it.
+	require.ErrorIs(t, ra.syncNode(ctx, "new"), errClusterCIDRsExhausted)
+	rack := clusterCIDRByName("rack-a", ra.cidrMap)
+	assert.Equal(t, 1, rack.IPv4CIDRSet.AllocatedCount())
+	assert.Zero(t, rack.IPv4CIDRSet.QuarantinedCount())
+}
+
+func TestBootstrapPerFamilyNode(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	// Nodes allocated per family are occupied in their ClusterCIDRs even if
+	// the per-family selection was disabled since.
+	nodes := []*corev1.Node{withClusterCIDRAnnotation(makeAllocatedNode("node", map[string]string{"rack": "a"}, "10.10.1.0/24", "fd00:10::100/120"), "rack-a,global-v6")}
+	ra := newBootstrapTestAllocator(t, ctx, nodes, makePerFamilyClusterCIDRs("fd00:10::/112")...)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	rack, global := clusterCIDRByName("rack-a", ra.cidrMap), clusterCIDRByName("global-v6", ra.cidrMap)
+	assert.Equal(t, 1, rack.IPv4CIDRSet.AllocatedCount())
+	assert.Equal(t, 1, global.IPv6CIDRSet.AllocatedCount())
+	assert.True(t, rack.AssociatedNodes["node"])
+	assert.True(t, global.AssociatedNodes["node"])
+
+	clusterCIDRs, err := ra.allocatedClusterCIDRs(nodes[0], ra.cidrMap)
+	require.NoError(t, err)
+	assert.Equal(t, "rack-a,global-v6", clusterCIDRNames(clusterCIDRs))
+}
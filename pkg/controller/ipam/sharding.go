@@ -0,0 +1,351 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// ExhaustedClusterCIDRsAnnotationKey is the annotation recording on a pending
+// node the ClusterCIDRs that had no free CIDRs when the owner of their shard
+// tried them, see nodeClusterCIDRName. It hands the node over to the shard of
+// the next ClusterCIDR, and is removed once the node gets its podCIDRs.
+const ExhaustedClusterCIDRsAnnotationKey = "networking.x-k8s.io/exhausted-cluster-cidrs"
+
+// clusterCIDRShard returns the shard of the ClusterCIDR, using jump consistent
+// hashing so that changing the number of shards moves as few ClusterCIDRs as
+// possible.
+func clusterCIDRShard(clusterCIDRName string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(clusterCIDRName))
+	key := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(shards) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// sharded returns whether the ClusterCIDRs are partitioned across replicas.
+func (r *multiCIDRRangeAllocator) sharded() bool {
+	return r.allocatorParams.Shards > 0
+}
+
+// ownsShard requires the caller to hold r.lock.
+// ownsShard returns whether the allocator may allocate from the ClusterCIDRs
+// of the shard. Unsharded allocators own everything unless on standby.
+func (r *multiCIDRRangeAllocator) ownsShard(shard int) bool {
+	if r.standby.Load() {
+		return false
+	}
+	return !r.sharded() || r.ownedShards[shard]
+}
+
+// ownsClusterCIDRShard requires the caller to hold r.lock.
+// ownsClusterCIDRShard returns whether the shard of the ClusterCIDR is owned.
+func (r *multiCIDRRangeAllocator) ownsClusterCIDRShard(clusterCIDRName string) bool {
+	return r.ownsShard(clusterCIDRShard(clusterCIDRName, r.allocatorParams.Shards))
+}
+
+// AcquireShard makes the allocator allocate from the ClusterCIDRs of the
+// shard. The ClusterCIDRs of the shard are synced to take over their
+// finalizers and the pending nodes are retried.
+func (r *multiCIDRRangeAllocator) AcquireShard(ctx context.Context, shard int) {
+	logger := klog.FromContext(ctx)
+	if !r.sharded() {
+		return
+	}
+
+	r.lock.Lock()
+	r.ownedShards[shard] = true
+	ownedShards.Set(float64(len(r.ownedShards)))
+	r.lock.Unlock()
+	logger.Info("Acquired shard", "shard", shard)
+	r.ensureDefaultClusterCIDR(ctx)
+
+	clusterCIDRs, err := r.clusterCIDRLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list ClusterCIDRs of acquired shard", "shard", shard)
+	}
+	for _, clusterCIDR := range clusterCIDRs {
+		if clusterCIDRShard(clusterCIDR.Name, r.allocatorParams.Shards) != shard {
+			continue
+		}
+		if key, err := cache.MetaNamespaceKeyFunc(clusterCIDR); err == nil {
+			r.enqueueClusterCIDR(key)
+		}
+	}
+	for _, name := range r.pendingNodes.names() {
+		r.enqueueNode(name)
+	}
+}
+
+// ReleaseShard stops the allocation from the ClusterCIDRs of the shard. It
+// waits for the allocation in progress, if any, so that the shard can be handed
+// off to another replica once it returns.
+func (r *multiCIDRRangeAllocator) ReleaseShard(ctx context.Context, shard int) {
+	if !r.sharded() {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.ownedShards[shard] {
+		return
+	}
+	delete(r.ownedShards, shard)
+	ownedShards.Set(float64(len(r.ownedShards)))
+	klog.FromContext(ctx).Info("Released shard", "shard", shard)
+}
+
+// ownsNodeShard returns whether the allocator owns the shard responsible for
+// the node, that is whether it updates the node. It only depends on the node
+// and the ClusterCIDRs, so that all the replicas agree on it: a node with
+// podCIDRs belongs to the shard of the ClusterCIDR they were allocated from, a
+// node with an allocation intent to the shard of its ClusterCIDR, any other
+// node to the shard of the first ClusterCIDR selecting it in priority order
+// that is not recorded as exhausted on the node.
+func (r *multiCIDRRangeAllocator) ownsNodeShard(ctx context.Context, node *corev1.Node) (bool, error) {
+	if !r.sharded() {
+		return !r.standby.Load(), nil
+	}
+
+	r.lockWithSpan(ctx)
+	defer r.lock.Unlock()
+
+	clusterCIDRName, err := r.nodeClusterCIDRName(node)
+	if err != nil {
+		return false, err
+	}
+	return r.ownsClusterCIDRShard(clusterCIDRName), nil
+}
+
+// nodeClusterCIDRName requires the caller to hold r.lock.
+// nodeClusterCIDRName returns the name of the ClusterCIDR deciding the shard
+// of the node, see ownsNodeShard. Nodes no ClusterCIDR selects use the empty
+// name, so that a single replica handles them.
+func (r *multiCIDRRangeAllocator) nodeClusterCIDRName(node *corev1.Node) (string, error) {
+	if name := node.Annotations[ClusterCIDRAnnotationKey]; name != "" && len(node.Spec.PodCIDRs) > 0 {
+		return splitClusterCIDRNames(name)[0], nil
+	}
+	if len(node.Spec.PodCIDRs) > 0 {
+		// PodCIDRs outside of the loaded ClusterCIDRs are reported by a
+		// single replica.
+		if clusterCIDR, err := r.allocatedClusterCIDR(node, r.cidrMap); err == nil {
+			return clusterCIDR.Name, nil
+		}
+		return "", nil
+	}
+	// An unresolved allocation intent is resumed by the owner of its
+	// ClusterCIDR.
+	if intent, err := nodeAllocationIntent(node); err == nil && intent != nil && intentClusterCIDRs(intent, r.cidrMap) != nil {
+		return splitClusterCIDRNames(intent.ClusterCIDR)[0], nil
+	}
+
+	candidates, err := r.shardCandidates(node)
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	// The node is handed over past the ClusterCIDRs found exhausted. The last
+	// one handles it if they all are, which handOverExhaustedNode avoids but
+	// a change of the ClusterCIDRs may cause.
+	exhausted := exhaustedClusterCIDRNames(node)
+	for _, clusterCIDR := range candidates {
+		if !exhausted.Has(clusterCIDR.Name) {
+			return clusterCIDR.Name, nil
+		}
+	}
+	return candidates[len(candidates)-1].Name, nil
+}
+
+// shardCandidates requires the caller to hold r.lock.
+// shardCandidates returns the ClusterCIDRs a pending node may be allocated
+// from, in priority order.
+func (r *multiCIDRRangeAllocator) shardCandidates(node *corev1.Node) ([]*cidrset.ClusterCIDR, error) {
+	ranked, err := r.rankedClusterCIDRs(node, r.cidrMap)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a clusterCIDR for node %s: %w", node.Name, err)
+	}
+	candidates := make([]*cidrset.ClusterCIDR, 0, len(ranked))
+	for _, pqItem := range ranked {
+		clusterCIDR := pqItem.clusterCIDR
+		if (clusterCIDR.Terminating && !pqItem.catchAll) || r.shadowedClusterCIDR(clusterCIDR, r.cidrMap) {
+			continue
+		}
+		candidates = append(candidates, clusterCIDR)
+	}
+	return candidates, nil
+}
+
+// exhaustedClusterCIDRNames returns the ClusterCIDRs recorded in the
+// ExhaustedClusterCIDRsAnnotationKey annotation of the node.
+func exhaustedClusterCIDRNames(node *corev1.Node) sets.Set[string] {
+	value := node.Annotations[ExhaustedClusterCIDRsAnnotationKey]
+	if value == "" {
+		return sets.New[string]()
+	}
+	return sets.New(splitClusterCIDRNames(value)...)
+}
+
+// handOverExhaustedNode hands a node none of the ClusterCIDRs of the owned
+// shards could allocate over to the shard of the next ClusterCIDR selecting
+// it, by recording the exhausted ClusterCIDRs on the node. It returns whether
+// the node was handed over, which it is not if no other ClusterCIDR is left.
+func (r *multiCIDRRangeAllocator) handOverExhaustedNode(ctx context.Context, node *corev1.Node) (bool, error) {
+	if !r.sharded() || len(node.Spec.PodCIDRs) > 0 {
+		return false, nil
+	}
+
+	r.lockWithSpan(ctx)
+	candidates, err := r.shardCandidates(node)
+	exhausted := exhaustedClusterCIDRNames(node)
+	for _, clusterCIDR := range candidates {
+		// The owned ClusterCIDRs were all tried.
+		if r.ownsClusterCIDRShard(clusterCIDR.Name) {
+			exhausted.Insert(clusterCIDR.Name)
+		}
+	}
+	r.lock.Unlock()
+	if err != nil {
+		return false, err
+	}
+	if !slices.ContainsFunc(candidates, func(clusterCIDR *cidrset.ClusterCIDR) bool { return !exhausted.Has(clusterCIDR.Name) }) {
+		return false, nil
+	}
+
+	klog.FromContext(ctx).V(2).Info("ClusterCIDRs of the owned shards are exhausted, handing node over to the next shard",
+		"node", klog.KObj(node), "exhaustedClusterCIDRs", sets.List(exhausted))
+	return true, r.recordExhaustedClusterCIDRs(ctx, node, exhausted)
+}
+
+// reclaimExhaustedNode takes the ClusterCIDRs of the owned shards that have
+// free CIDRs again out of the exhausted ClusterCIDRs recorded on a pending
+// node, so that the node is handed back to their shard. Only the owner of a
+// shard knows for sure whether its ClusterCIDRs have free CIDRs.
+func (r *multiCIDRRangeAllocator) reclaimExhaustedNode(ctx context.Context, node *corev1.Node) error {
+	if !r.sharded() || len(node.Spec.PodCIDRs) > 0 {
+		return nil
+	}
+	exhausted := exhaustedClusterCIDRNames(node)
+	if exhausted.Len() == 0 {
+		return nil
+	}
+
+	r.lockWithSpan(ctx)
+	var reclaimed []string
+	for _, name := range sets.List(exhausted) {
+		clusterCIDR := clusterCIDRByName(name, r.cidrMap)
+		if clusterCIDR != nil && r.ownsClusterCIDRShard(name) && clusterCIDRCapacity(clusterCIDR).AllocatableNodes > 0 {
+			reclaimed = append(reclaimed, name)
+		}
+	}
+	r.lock.Unlock()
+	if len(reclaimed) == 0 {
+		return nil
+	}
+
+	klog.FromContext(ctx).V(2).Info("ClusterCIDRs have free CIDRs again, reclaiming node", "node", klog.KObj(node), "clusterCIDRs", reclaimed)
+	return r.recordExhaustedClusterCIDRs(ctx, node, exhausted.Delete(reclaimed...))
+}
+
+// recordExhaustedClusterCIDRs sets the ExhaustedClusterCIDRsAnnotationKey
+// annotation of the node, conditioned on its resourceVersion so that the
+// replicas handing the node over do not overwrite each other.
+func (r *multiCIDRRangeAllocator) recordExhaustedClusterCIDRs(ctx context.Context, node *corev1.Node, exhausted sets.Set[string]) error {
+	var value *string
+	if exhausted.Len() > 0 {
+		names := strings.Join(sets.List(exhausted), clusterCIDRNameSeparator)
+		value = &names
+	}
+	_, err := r.patchNode(ctx, node.Name, nodeForCIDRMergePatch{
+		Metadata: &nodeMetadataForMergePatch{
+			ResourceVersion: node.ResourceVersion,
+			Annotations:     map[string]*string{ExhaustedClusterCIDRsAnnotationKey: value},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the exhausted clusterCIDRs on node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// shadowedClusterCIDR requires the caller to hold r.lock.
+// shadowedClusterCIDR returns whether the ClusterCIDR is not allocated from
+// because it overlaps an older ClusterCIDR of another shard. The replicas only
+// know about the allocations in progress of their own shards, so they could
+// otherwise hand out the same CIDR from both ClusterCIDRs.
+func (r *multiCIDRRangeAllocator) shadowedClusterCIDR(clusterCIDR *cidrset.ClusterCIDR, cidrMap map[string][]*cidrset.ClusterCIDR) bool {
+	if !r.sharded() {
+		return false
+	}
+	shard := clusterCIDRShard(clusterCIDR.Name, r.allocatorParams.Shards)
+	for _, clusterCIDRList := range cidrMap {
+		for _, other := range clusterCIDRList {
+			if other == clusterCIDR || clusterCIDRShard(other.Name, r.allocatorParams.Shards) == shard {
+				continue
+			}
+			if createdBefore(other, clusterCIDR) && clusterCIDRsOverlap(other, clusterCIDR) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// createdBefore orders the ClusterCIDRs by creation, then by name.
+func createdBefore(a, b *cidrset.ClusterCIDR) bool {
+	if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// clusterCIDRsOverlap returns whether the ClusterCIDRs have overlapping ranges.
+func clusterCIDRsOverlap(a, b *cidrset.ClusterCIDR) bool {
+	for _, family := range ipFamilies {
+		aSet, bSet := familyCIDRSet(a, family), familyCIDRSet(b, family)
+		if aSet == nil || bSet == nil {
+			continue
+		}
+		if aSet.ClusterCIDR.Contains(bSet.ClusterCIDR.IP) || bSet.ClusterCIDR.Contains(aSet.ClusterCIDR.IP) {
+			return true
+		}
+	}
+	return false
+}
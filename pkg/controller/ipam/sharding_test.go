@@ -0,0 +1,218 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2/ktesting"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+func TestClusterCIDRShard(t *testing.T) {
+	assert.Zero(t, clusterCIDRShard("cc", 0))
+	assert.Zero(t, clusterCIDRShard("cc", 1))
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("cc-%d", i)
+		shard := clusterCIDRShard(name, 10)
+		require.GreaterOrEqual(t, shard, 0)
+		require.Less(t, shard, 10)
+		assert.Equal(t, shard, clusterCIDRShard(name, 10))
+		if clusterCIDRShard(name, 11) != shard {
+			moved++
+		}
+	}
+	// Adding a shard only moves the ClusterCIDRs of the new shard, about a
+	// 11th of them.
+	assert.Less(t, moved, 150)
+}
+
+func TestShardedAllocation(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	// Pick a ClusterCIDR name in each of the 2 shards.
+	var names [2]string
+	for i := 0; names[0] == "" || names[1] == ""; i++ {
+		name := fmt.Sprintf("cc-%d", i)
+		if shard := clusterCIDRShard(name, 2); names[shard] == "" {
+			names[shard] = name
+		}
+	}
+	// A single podCIDR, taken by the allocated node.
+	specific := makeSyncedClusterCIDR(names[0], "10.1.0.0/24", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	catchAll := makeSyncedClusterCIDR(names[1], "10.2.0.0/16", "", 8, nil)
+	allocated := makeAllocatedNode("allocated", map[string]string{"pool": "a"}, "10.1.0.0/24")
+	pending := makeNode("pending", map[string]string{"pool": "a"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{allocated, pending}, specific, catchAll)
+	ra.allocatorParams.Shards = 2
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// Without shards nothing is allocated nor finalized.
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	assert.Empty(t, ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy())
+	for _, clusterCIDR := range []*v1.ClusterCIDR{specific, catchAll} {
+		updated, err := ra.networkClient.Get(ctx, clusterCIDR.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, updated.Finalizers, clusterCIDRFinalizer)
+	}
+
+	// The node belongs to the shard of the specific ClusterCIDR, even if it is
+	// exhausted.
+	ra.AcquireShard(ctx, 1)
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	assert.Empty(t, ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy())
+
+	// Its owner falls back to the catch-all ClusterCIDR it also owns.
+	ra.AcquireShard(ctx, 0)
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	updatedNodes := ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy()
+	i := slices.IndexFunc(updatedNodes, func(node *corev1.Node) bool { return node.Name == "pending" })
+	require.NotEqual(t, -1, i)
+	assert.Equal(t, catchAll.Name, updatedNodes[i].Annotations[ClusterCIDRAnnotationKey])
+
+	// The owner of the shard finalizes the ClusterCIDR.
+	require.NoError(t, ra.syncClusterCIDR(ctx, catchAll.Name))
+	updated, err := ra.networkClient.Get(ctx, catchAll.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, updated.Finalizers, clusterCIDRFinalizer)
+
+	ra.ReleaseShard(ctx, 1)
+	assert.False(t, ra.ownsClusterCIDRShard(catchAll.Name))
+	assert.True(t, ra.ownsClusterCIDRShard(specific.Name))
+}
+
+func TestShardedOverlappingClusterCIDRs(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	// Pick a ClusterCIDR name in each of the 2 shards.
+	var names [2]string
+	for i := 0; names[0] == "" || names[1] == ""; i++ {
+		name := fmt.Sprintf("cc-%d", i)
+		if shard := clusterCIDRShard(name, 2); names[shard] == "" {
+			names[shard] = name
+		}
+	}
+	// The newer ClusterCIDR has the higher priority but overlaps the older one.
+	older := makeSyncedClusterCIDR(names[0], "10.1.0.0/16", "", 8, nil)
+	older.CreationTimestamp = metav1.NewTime(time.Unix(100, 0))
+	newer := makeSyncedClusterCIDR(names[1], "10.1.2.0/24", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	newer.CreationTimestamp = metav1.NewTime(time.Unix(200, 0))
+	pending := makeNode("pending", map[string]string{"pool": "a"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{pending}, older, newer)
+	ra.allocatorParams.Shards = 2
+	require.NoError(t, ra.bootstrap(ctx))
+
+	ra.lock.Lock()
+	assert.False(t, ra.shadowedClusterCIDR(clusterCIDRByName(older.Name, ra.cidrMap), ra.cidrMap))
+	assert.True(t, ra.shadowedClusterCIDR(clusterCIDRByName(newer.Name, ra.cidrMap), ra.cidrMap))
+	ra.lock.Unlock()
+
+	// The node belongs to the shard of the older ClusterCIDR, which is the
+	// only one allocated from.
+	ra.AcquireShard(ctx, 1)
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	assert.Empty(t, ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy())
+
+	ra.AcquireShard(ctx, 0)
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	updatedNodes := ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy()
+	i := slices.IndexFunc(updatedNodes, func(node *corev1.Node) bool { return node.Name == "pending" })
+	require.NotEqual(t, -1, i)
+	assert.Equal(t, older.Name, updatedNodes[i].Annotations[ClusterCIDRAnnotationKey])
+}
+
+func TestShardedAllocationExhausted(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	// Pick a ClusterCIDR name in each of the 2 shards.
+	var names [2]string
+	for i := 0; names[0] == "" || names[1] == ""; i++ {
+		name := fmt.Sprintf("cc-%d", i)
+		if shard := clusterCIDRShard(name, 2); names[shard] == "" {
+			names[shard] = name
+		}
+	}
+	// A single podCIDR, taken by the allocated node.
+	specific := makeSyncedClusterCIDR(names[0], "10.1.0.0/24", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	catchAll := makeSyncedClusterCIDR(names[1], "10.2.0.0/16", "", 8, nil)
+	allocated := makeAllocatedNode("allocated", map[string]string{"pool": "a"}, "10.1.0.0/24")
+	pendingA := makeNode("pending-a", map[string]string{"pool": "a"})
+	pendingB := makeNode("pending-b", map[string]string{"pool": "a"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{allocated, pendingA, pendingB}, specific, catchAll)
+	ra.allocatorParams.Shards = 2
+	require.NoError(t, ra.bootstrap(ctx))
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ra.nodeLister = corelisters.NewNodeLister(nodeIndexer)
+	// syncNode syncs the node as last patched, like the informer would.
+	syncNode := func(name string) *corev1.Node {
+		t.Helper()
+		node := updatedNode(t, ra, name)
+		require.NoError(t, nodeIndexer.Add(node))
+		require.NoError(t, ra.syncNode(ctx, name))
+		return updatedNode(t, ra, name)
+	}
+	require.NoError(t, nodeIndexer.Add(allocated))
+
+	// The owner of the exhausted specific ClusterCIDR hands the nodes over to
+	// the shard of the catch-all ClusterCIDR.
+	ra.AcquireShard(ctx, 0)
+	for _, name := range []string{"pending-a", "pending-b"} {
+		require.NoError(t, nodeIndexer.Add(makeNode(name, map[string]string{"pool": "a"})))
+		require.NoError(t, ra.syncNode(ctx, name))
+		node := updatedNode(t, ra, name)
+		assert.Empty(t, node.Spec.PodCIDRs)
+		assert.Equal(t, specific.Name, node.Annotations[ExhaustedClusterCIDRsAnnotationKey])
+	}
+	node := syncNode("pending-a")
+	assert.Empty(t, node.Spec.PodCIDRs)
+
+	// The owner of the catch-all ClusterCIDR allocates the node.
+	ra.ReleaseShard(ctx, 0)
+	ra.AcquireShard(ctx, 1)
+	node = syncNode("pending-a")
+	assert.Equal(t, []string{"10.2.0.0/24"}, node.Spec.PodCIDRs)
+	assert.Equal(t, catchAll.Name, node.Annotations[ClusterCIDRAnnotationKey])
+	assert.NotContains(t, node.Annotations, ExhaustedClusterCIDRsAnnotationKey)
+
+	// Once the specific ClusterCIDR has a free CIDR, its owner takes the other
+	// node back and allocates it.
+	ra.ReleaseShard(ctx, 1)
+	ra.AcquireShard(ctx, 0)
+	require.NoError(t, ra.ReleaseCIDR(ctx, allocated))
+	node = syncNode("pending-b")
+	assert.Empty(t, node.Spec.PodCIDRs)
+	assert.NotContains(t, node.Annotations, ExhaustedClusterCIDRsAnnotationKey)
+	node = syncNode("pending-b")
+	assert.Equal(t, []string{"10.1.0.0/24"}, node.Spec.PodCIDRs)
+	assert.Equal(t, specific.Name, node.Annotations[ClusterCIDRAnnotationKey])
+}
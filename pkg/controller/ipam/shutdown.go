@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultShutdownGracePeriod is the default time the work items in
+	// progress are given to complete on shutdown.
+	DefaultShutdownGracePeriod = 5 * time.Second
+	// drainProgressPeriod is how often the work items still in progress are
+	// logged while draining.
+	drainProgressPeriod = time.Second
+)
+
+// drain stops the workers from taking new items off the queues and waits for
+// the items they are processing to complete, so that no node patch is still
+// in flight once the allocator returns and the lease is released. The items
+// still in progress once the shutdown grace period expires are cancelled with
+// cancelWork: their podCIDRs may then be leaked until the next bootstrap.
+func (r *multiCIDRRangeAllocator) drain(logger klog.Logger, workers *sync.WaitGroup, cancelWork context.CancelFunc) {
+	start := time.Now()
+	r.cidrQueue.ShutDown()
+	r.nodeQueue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	items := r.workers.inFlightItems()
+	shutdownInFlightItems.Set(float64(len(items)))
+	logger.Info("Draining the work items in progress", "items", items, "gracePeriod", r.allocatorParams.ShutdownGracePeriod)
+
+	ticker := time.NewTicker(drainProgressPeriod)
+	defer ticker.Stop()
+	gracePeriod := time.NewTimer(r.allocatorParams.ShutdownGracePeriod)
+	defer gracePeriod.Stop()
+	for {
+		select {
+		case <-done:
+			shutdownInFlightItems.Set(0)
+			shutdownDrainDuration.Set(time.Since(start).Seconds())
+			logger.Info("Drained the work items in progress", "elapsed", time.Since(start))
+			return
+		case <-ticker.C:
+			items := r.workers.inFlightItems()
+			shutdownInFlightItems.Set(float64(len(items)))
+			logger.Info("Waiting for the work items in progress", "items", items, "elapsed", time.Since(start))
+		case <-gracePeriod.C:
+			items := r.workers.inFlightItems()
+			shutdownAbandonedItems.Add(float64(len(items)))
+			logger.Error(nil, "Shutdown grace period expired, cancelling the work items in progress", "items", items)
+			cancelWork()
+			<-done
+			shutdownInFlightItems.Set(0)
+			shutdownDrainDuration.Set(time.Since(start).Seconds())
+			return
+		}
+	}
+}
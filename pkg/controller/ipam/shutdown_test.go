@@ -0,0 +1,99 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2/ktesting"
+)
+
+func TestDrain(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ra := newBootstrapTestAllocator(t, ctx, nil)
+	ra.allocatorParams.ShutdownGracePeriod = time.Minute
+
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	release := make(chan struct{})
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		defer ra.workers.start("node", "node-a")()
+		<-release
+	}()
+
+	drained := make(chan struct{})
+	go func() {
+		ra.drain(logger, &workers, cancelWork)
+		close(drained)
+	}()
+
+	assert.Eventually(t, ra.nodeQueue.ShuttingDown, time.Second, 10*time.Millisecond)
+	assert.True(t, ra.cidrQueue.ShuttingDown())
+	select {
+	case <-drained:
+		t.Fatal("drain returned before the work item completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.NoError(t, workCtx.Err())
+
+	close(release)
+	<-drained
+	assert.NoError(t, workCtx.Err())
+	assert.InDelta(t, 0, testutil.ToFloat64(shutdownInFlightItems), 0)
+}
+
+func TestDrainGracePeriodExpired(t *testing.T) {
+	logger, ctx := ktesting.NewTestContext(t)
+	ra := newBootstrapTestAllocator(t, ctx, nil)
+	ra.allocatorParams.ShutdownGracePeriod = 10 * time.Millisecond
+
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		defer ra.workers.start("node", "node-a")()
+		<-workCtx.Done()
+	}()
+
+	abandoned := testutil.ToFloat64(shutdownAbandonedItems)
+	ra.drain(logger, &workers, cancelWork)
+	assert.Error(t, workCtx.Err())
+	assert.InDelta(t, abandoned+1, testutil.ToFloat64(shutdownAbandonedItems), 0)
+}
+
+func TestWorkersStopTakingItemsOnShutdown(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	ra := newBootstrapTestAllocator(t, ctx, nil)
+
+	ra.nodeQueue.Add("node-a")
+	ra.cidrQueue.Add("cc")
+	ra.nodeQueue.ShutDown()
+	ra.cidrQueue.ShutDown()
+
+	assert.False(t, ra.processNextNodeWorkItem(ctx))
+	assert.False(t, ra.processNextCIDRWorkItem(ctx))
+	assert.Empty(t, ra.workers.inFlightItems())
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	netutil "k8s.io/utils/net"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+const (
+	// SnapshotConfigMapKey is the key of the snapshot ConfigMap holding the
+	// gzipped JSON snapshot of the allocation table.
+	SnapshotConfigMapKey = "snapshot.json.gz"
+	// DefaultSnapshotConfigMapNamespace is the default namespace of the
+	// snapshot ConfigMap.
+	DefaultSnapshotConfigMapNamespace = "kube-system"
+	// DefaultSnapshotInterval is the default interval between two snapshots.
+	DefaultSnapshotInterval = 5 * time.Minute
+	// snapshotVersion is the version of the snapshot format, snapshots of
+	// other versions are ignored.
+	snapshotVersion = 1
+	// snapshotWriteTimeout bounds the write of the last snapshot on shutdown.
+	snapshotWriteTimeout = 5 * time.Second
+	// maxSnapshotSize is the size limit of the data of a ConfigMap. Larger
+	// snapshots are not written, the next leader then rebuilds its state from
+	// the nodes.
+	maxSnapshotSize = 1024 * 1024
+	// snapshotTooLarge is the reason of the snapshot write errors caused by
+	// snapshots larger than maxSnapshotSize.
+	snapshotTooLarge = "TooLarge"
+)
+
+// allocatorSnapshot is a compact copy of the allocation table: the podCIDRs
+// of the nodes, grouped by the ClusterCIDR they were allocated from. It saves
+// matching every node against the ClusterCIDRs on startup, the nodes are
+// still all listed and their podCIDRs compared with the snapshot.
+type allocatorSnapshot struct {
+	Version      int                   `json:"version"`
+	ClusterCIDRs []snapshotClusterCIDR `json:"clusterCIDRs"`
+}
+
+// snapshotClusterCIDR holds the nodes allocated from a ClusterCIDR. The CIDR
+// sets are compared with the loaded ClusterCIDR, the nodes of a ClusterCIDR
+// whose ranges changed are rebuilt.
+type snapshotClusterCIDR struct {
+	Name  string         `json:"name"`
+	IPv4  string         `json:"ipv4,omitempty"`
+	IPv6  string         `json:"ipv6,omitempty"`
+	Nodes []snapshotNode `json:"nodes"`
+}
+
+type snapshotNode struct {
+	Name     string   `json:"name"`
+	PodCIDRs []string `json:"podCIDRs"`
+}
+
+// snapshotEntry is the ClusterCIDR and podCIDRs of a node in a loaded
+// snapshot.
+type snapshotEntry struct {
+	clusterCIDR *cidrset.ClusterCIDR
+	podCIDRs    []string
+}
+
+// snapshotsEnabled returns whether the allocation table is persisted.
+func (r *multiCIDRRangeAllocator) snapshotsEnabled() bool {
+	return r.allocatorParams.SnapshotConfigMapName != ""
+}
+
+// cidrSetSpec returns the range and per node mask size of the CIDR set, empty
+// if there is none.
+func cidrSetSpec(cidrSet *cidrset.MultiCIDRSet) string {
+	if cidrSet == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s,%d", cidrSet.ClusterCIDR, cidrSet.NodeMaskSize)
+}
+
+// takeSnapshot returns the snapshot of the allocation table.
+func (r *multiCIDRRangeAllocator) takeSnapshot() *allocatorSnapshot {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	snapshot := &allocatorSnapshot{Version: snapshotVersion}
+	for _, clusterCIDRList := range r.cidrMap {
+		for _, clusterCIDR := range clusterCIDRList {
+			entry := snapshotClusterCIDR{
+				Name:  clusterCIDR.Name,
+				IPv4:  cidrSetSpec(clusterCIDR.IPv4CIDRSet),
+				IPv6:  cidrSetSpec(clusterCIDR.IPv6CIDRSet),
+				Nodes: make([]snapshotNode, 0, len(clusterCIDR.AssociatedNodes)),
+			}
+			for name := range clusterCIDR.AssociatedNodes {
+				node, err := r.nodeLister.Get(name)
+				if err != nil || len(node.Spec.PodCIDRs) == 0 {
+					continue
+				}
+				entry.Nodes = append(entry.Nodes, snapshotNode{Name: name, PodCIDRs: node.Spec.PodCIDRs})
+			}
+			slices.SortFunc(entry.Nodes, func(a, b snapshotNode) int { return strings.Compare(a.Name, b.Name) })
+			snapshot.ClusterCIDRs = append(snapshot.ClusterCIDRs, entry)
+		}
+	}
+	slices.SortFunc(snapshot.ClusterCIDRs, func(a, b snapshotClusterCIDR) int { return strings.Compare(a.Name, b.Name) })
+	return snapshot
+}
+
+func encodeSnapshot(snapshot *allocatorSnapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSnapshot(data []byte) (*allocatorSnapshot, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &allocatorSnapshot{}
+	if err := json.Unmarshal(decoded, snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	return snapshot, nil
+}
+
+// runSnapshotWriter persists the allocation table every SnapshotInterval until
+// ctx is cancelled. Only the leader, or the owner of the first shard when
+// sharded, writes it.
+func (r *multiCIDRRangeAllocator) runSnapshotWriter(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	ticker := time.NewTicker(r.allocatorParams.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.writesSnapshot() {
+			continue
+		}
+		if err := r.writeSnapshot(ctx); err != nil {
+			logger.Error(err, "Failed to write the allocator snapshot",
+				"configMap", klog.KRef(r.allocatorParams.SnapshotConfigMapNamespace, r.allocatorParams.SnapshotConfigMapName))
+		}
+	}
+}
+
+// writesSnapshot returns whether the allocator is the replica writing the
+// snapshots.
+func (r *multiCIDRRangeAllocator) writesSnapshot() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.ownsShard(0)
+}
+
+// writeLastSnapshot writes the snapshot once the workers are drained, so that
+// the next leader starts from the latest state.
+func (r *multiCIDRRangeAllocator) writeLastSnapshot(logger klog.Logger) {
+	if !r.snapshotsEnabled() || !r.writesSnapshot() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotWriteTimeout)
+	defer cancel()
+	if err := r.writeSnapshot(klog.NewContext(ctx, logger)); err != nil {
+		logger.Error(err, "Failed to write the allocator snapshot on shutdown")
+	}
+}
+
+// writeSnapshot writes the snapshot of the allocation table to the snapshot
+// ConfigMap, creating it if needed. Failures are counted by reason.
+func (r *multiCIDRRangeAllocator) writeSnapshot(ctx context.Context) error {
+	err := r.doWriteSnapshot(ctx)
+	var tooLarge *snapshotTooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		snapshotWriteErrors.WithLabelValues(snapshotTooLarge).Inc()
+	case err != nil:
+		snapshotWriteErrors.WithLabelValues(patchErrorReason(err)).Inc()
+	}
+	return err
+}
+
+// snapshotTooLargeError is returned for snapshots that do not fit in a
+// ConfigMap.
+type snapshotTooLargeError struct {
+	size int
+}
+
+func (e *snapshotTooLargeError) Error() string {
+	return fmt.Sprintf("allocator snapshot of %d bytes exceeds the ConfigMap size limit of %d bytes", e.size, maxSnapshotSize)
+}
+
+func (r *multiCIDRRangeAllocator) doWriteSnapshot(ctx context.Context) error {
+	start := time.Now()
+	data, err := encodeSnapshot(r.takeSnapshot())
+	if err != nil {
+		return fmt.Errorf("failed to encode the allocator snapshot: %w", err)
+	}
+	if len(data) > maxSnapshotSize {
+		return &snapshotTooLargeError{size: len(data)}
+	}
+
+	namespace, name := r.allocatorParams.SnapshotConfigMapNamespace, r.allocatorParams.SnapshotConfigMapName
+	configMaps := r.client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			BinaryData: map[string][]byte{SnapshotConfigMapKey: data},
+		}
+		_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	case err == nil:
+		configMap = configMap.DeepCopy()
+		if configMap.BinaryData == nil {
+			configMap.BinaryData = make(map[string][]byte)
+		}
+		configMap.BinaryData[SnapshotConfigMapKey] = data
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	snapshotSize.Set(float64(len(data)))
+	klog.FromContext(ctx).V(2).Info("Wrote the allocator snapshot", "bytes", len(data), "elapsed", time.Since(start))
+	return nil
+}
+
+// loadSnapshot reads the snapshot ConfigMap and returns the snapshot entries
+// of the nodes by name. Only the entries of the loaded ClusterCIDRs whose
+// ranges did not change are returned. It returns nil if snapshots are
+// disabled, or the snapshot is missing or invalid, in which case the state is
+// rebuilt from the nodes.
+func (r *multiCIDRRangeAllocator) loadSnapshot(ctx context.Context) map[string]snapshotEntry {
+	logger := klog.FromContext(ctx)
+	if !r.snapshotsEnabled() {
+		return nil
+	}
+	namespace, name := r.allocatorParams.SnapshotConfigMapNamespace, r.allocatorParams.SnapshotConfigMapName
+	configMap, err := r.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("Allocator snapshot not available, rebuilding the state from the nodes", "configMap", klog.KRef(namespace, name), "err", err)
+		return nil
+	}
+	snapshot, err := decodeSnapshot(configMap.BinaryData[SnapshotConfigMapKey])
+	if err != nil {
+		logger.Error(err, "Invalid allocator snapshot, rebuilding the state from the nodes", "configMap", klog.KRef(namespace, name))
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entries := make(map[string]snapshotEntry)
+	// The nodes with podCIDRs from several ClusterCIDRs are rebuilt.
+	split := make(map[string]bool)
+	for _, snapshotCIDR := range snapshot.ClusterCIDRs {
+		clusterCIDR := clusterCIDRByName(snapshotCIDR.Name, r.cidrMap)
+		if clusterCIDR == nil || cidrSetSpec(clusterCIDR.IPv4CIDRSet) != snapshotCIDR.IPv4 || cidrSetSpec(clusterCIDR.IPv6CIDRSet) != snapshotCIDR.IPv6 {
+			logger.V(2).Info("ClusterCIDR of the allocator snapshot changed, rebuilding its nodes", "clusterCIDR", snapshotCIDR.Name)
+			continue
+		}
+		for _, node := range snapshotCIDR.Nodes {
+			if _, ok := entries[node.Name]; ok {
+				split[node.Name] = true
+			}
+			entries[node.Name] = snapshotEntry{clusterCIDR: clusterCIDR, podCIDRs: node.PodCIDRs}
+		}
+	}
+	for name := range split {
+		delete(entries, name)
+	}
+	logger.Info("Loaded the allocator snapshot", "nodes", len(entries))
+	return entries
+}
+
+// occupySnapshotEntry requires the caller to hold r.lock.
+// occupySnapshotEntry marks the podCIDRs of the node as used in the
+// ClusterCIDR of its snapshot entry, without matching the node against the
+// ClusterCIDRs. It returns false if the podCIDRs of the node changed since the
+// snapshot or can not be occupied, the node must then be rebuilt.
+func (r *multiCIDRRangeAllocator) occupySnapshotEntry(node *corev1.Node, entry snapshotEntry) bool {
+	if !slices.Equal(node.Spec.PodCIDRs, entry.podCIDRs) {
+		return false
+	}
+	for _, cidr := range node.Spec.PodCIDRs {
+		_, podCIDR, err := netutil.ParseCIDRSloppy(cidr)
+		if err != nil {
+			return false
+		}
+		if err := r.Occupy(entry.clusterCIDR, podCIDR); err != nil {
+			return false
+		}
+	}
+	entry.clusterCIDR.AssociatedNodes[node.Name] = true
+	return true
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog/v2/ktesting"
+	utilnet "k8s.io/utils/net"
+
+	v1 "sigs.k8s.io/node-ipam-controller/pkg/apis/clustercidr/v1"
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+// newSnapshotTestAllocator returns an allocator persisting its snapshots to
+// the snapshot ConfigMap, which is created with the given data if not nil.
+func newSnapshotTestAllocator(t *testing.T, ctx context.Context, data []byte, nodes []*corev1.Node, clusterCIDRs ...*v1.ClusterCIDR) *multiCIDRRangeAllocator {
+	t.Helper()
+
+	ra := newBootstrapTestAllocator(t, ctx, nodes, clusterCIDRs...)
+	ra.allocatorParams.SnapshotConfigMapNamespace = DefaultSnapshotConfigMapNamespace
+	ra.allocatorParams.SnapshotConfigMapName = "node-ipam-snapshot"
+	if data != nil {
+		_, err := ra.client.CoreV1().ConfigMaps(DefaultSnapshotConfigMapNamespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: DefaultSnapshotConfigMapNamespace, Name: "node-ipam-snapshot"},
+			BinaryData: map[string][]byte{SnapshotConfigMapKey: data},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	return ra
+}
+
+func writtenSnapshot(ctx context.Context, t *testing.T, ra *multiCIDRRangeAllocator) []byte {
+	t.Helper()
+
+	require.NoError(t, ra.writeSnapshot(ctx))
+	configMap, err := ra.client.CoreV1().ConfigMaps(DefaultSnapshotConfigMapNamespace).Get(ctx, "node-ipam-snapshot", metav1.GetOptions{})
+	require.NoError(t, err)
+	return configMap.BinaryData[SnapshotConfigMapKey]
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	nodes := []*corev1.Node{
+		makeAllocatedNode("node-b", nil, "10.10.2.0/24"),
+		makeAllocatedNode("node-a", nil, "10.10.1.0/24"),
+		makeNode("new-node", nil),
+	}
+	ra := newSnapshotTestAllocator(t, ctx, nil, nodes, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+	require.NoError(t, ra.bootstrap(ctx))
+
+	snapshot, err := decodeSnapshot(writtenSnapshot(ctx, t, ra))
+	require.NoError(t, err)
+	assert.Equal(t, []snapshotClusterCIDR{{
+		Name: "cc",
+		IPv4: "10.10.0.0/16,24",
+		Nodes: []snapshotNode{
+			{Name: "node-a", PodCIDRs: []string{"10.10.1.0/24"}},
+			{Name: "node-b", PodCIDRs: []string{"10.10.2.0/24"}},
+		},
+	}}, snapshot.ClusterCIDRs)
+
+	// The ConfigMap is updated once it exists.
+	for _, clusterCIDRList := range ra.cidrMap {
+		delete(clusterCIDRList[0].AssociatedNodes, "node-b")
+	}
+	snapshot, err = decodeSnapshot(writtenSnapshot(ctx, t, ra))
+	require.NoError(t, err)
+	assert.Equal(t, []snapshotNode{{Name: "node-a", PodCIDRs: []string{"10.10.1.0/24"}}}, snapshot.ClusterCIDRs[0].Nodes)
+}
+
+func TestWriteSnapshotError(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	ra := newSnapshotTestAllocator(t, ctx, nil, nil, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+	ra.client.(*test.FakeNodeHandler).Clientset.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("configmaps"), "node-ipam-snapshot", errors.New("denied"))
+	})
+	forbidden := snapshotWriteErrors.WithLabelValues(string(metav1.StatusReasonForbidden))
+	before := testutil.ToFloat64(forbidden)
+
+	require.Error(t, ra.writeSnapshot(ctx))
+	assert.Equal(t, before+1, testutil.ToFloat64(forbidden))
+}
+
+func TestBootstrapFromSnapshot(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	nodes := []*corev1.Node{
+		makeAllocatedNode("unchanged", nil, "10.10.1.0/24"),
+		makeAllocatedNode("changed", nil, "10.10.2.0/24"),
+		makeAllocatedNode("moved", nil, "10.20.1.0/24"),
+	}
+	previous := newSnapshotTestAllocator(t, ctx, nil, nodes, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil), makeSyncedClusterCIDR("resized", "10.20.0.0/16", "", 8, nil))
+	require.NoError(t, previous.bootstrap(ctx))
+	data := writtenSnapshot(ctx, t, previous)
+
+	// The podCIDRs of a node changed and a ClusterCIDR was recreated with
+	// another range since the snapshot.
+	nodes = []*corev1.Node{
+		makeAllocatedNode("unchanged", nil, "10.10.1.0/24"),
+		makeAllocatedNode("changed", nil, "10.10.3.0/24"),
+		makeAllocatedNode("moved", nil, "10.20.1.0/24"),
+		makeAllocatedNode("added", nil, "10.10.4.0/24"),
+	}
+	cc := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+	resized := makeSyncedClusterCIDR("resized", "10.20.0.0/15", "", 8, nil)
+	ra := newSnapshotTestAllocator(t, ctx, data, nodes, cc, resized)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(bootstrapNodes.WithLabelValues("snapshot")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(bootstrapNodes.WithLabelValues("rebuild")))
+
+	ccSet := clusterCIDRByName(cc.Name, ra.cidrMap)
+	assert.Equal(t, map[string]bool{"unchanged": true, "changed": true, "added": true, "moved": true}, mergeAssociatedNodes(ra))
+	for cidr, allocated := range map[string]bool{"10.10.1.0/24": true, "10.10.2.0/24": false, "10.10.3.0/24": true, "10.10.4.0/24": true} {
+		_, podCIDR, _ := utilnet.ParseCIDRSloppy(cidr)
+		assert.Equal(t, allocated, ccSet.IPv4CIDRSet.CIDRAllocated(podCIDR), cidr)
+	}
+}
+
+func TestBootstrapInvalidSnapshot(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	nodes := []*corev1.Node{makeAllocatedNode("node", nil, "10.10.1.0/24")}
+	cc := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+	ra := newSnapshotTestAllocator(t, ctx, []byte("not a snapshot"), nodes, cc)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(bootstrapNodes.WithLabelValues("snapshot")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(bootstrapNodes.WithLabelValues("rebuild")))
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.1.0/24")
+	assert.True(t, clusterCIDRByName(cc.Name, ra.cidrMap).IPv4CIDRSet.CIDRAllocated(podCIDR))
+}
+
+func mergeAssociatedNodes(ra *multiCIDRRangeAllocator) map[string]bool {
+	nodes := make(map[string]bool)
+	for _, clusterCIDRList := range ra.cidrMap {
+		for _, clusterCIDR := range clusterCIDRList {
+			for name := range clusterCIDR.AssociatedNodes {
+				nodes[name] = true
+			}
+		}
+	}
+	return nodes
+}
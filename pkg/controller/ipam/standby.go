@@ -0,0 +1,97 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// promoteRetryInterval is the time to wait before retrying to read the nodes
+// when a standby allocator is promoted.
+const promoteRetryInterval = time.Second
+
+// Promote makes a standby allocator allocate. Its state is already built from
+// the informers, which may lag behind the allocations of the former leader, so
+// the podCIDRs and allocation intents of the nodes read from the API server
+// are occupied first. The ClusterCIDRs and nodes are then synced again to take
+// over their finalizers and allocate the pending nodes.
+func (r *multiCIDRRangeAllocator) Promote(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	if !r.standby.Load() {
+		return
+	}
+	err := wait.PollUntilContextCancel(ctx, promoteRetryInterval, true, func(ctx context.Context) (bool, error) {
+		if err := r.occupyListedNodes(ctx); err != nil {
+			logger.Error(err, "Failed to verify the allocator state before promotion, retrying")
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		logger.Info("Promotion cancelled", "err", err)
+		return
+	}
+	if !r.standby.CompareAndSwap(true, false) {
+		return
+	}
+	logger.Info("Promoted standby allocator, syncing all ClusterCIDRs and nodes")
+	r.ensureDefaultClusterCIDR(ctx)
+
+	clusterCIDRs, err := r.clusterCIDRLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list ClusterCIDRs after promotion")
+	}
+	for _, clusterCIDR := range clusterCIDRs {
+		if key, err := cache.MetaNamespaceKeyFunc(clusterCIDR); err == nil {
+			r.enqueueClusterCIDR(key)
+		}
+	}
+	nodes, err := r.nodeLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "Failed to list nodes after promotion")
+	}
+	for _, node := range nodes {
+		if key, err := cache.MetaNamespaceKeyFunc(node); err == nil {
+			r.enqueueNode(key)
+		}
+	}
+	r.capacityChanged()
+}
+
+// occupyListedNodes occupies the podCIDRs and allocation intents of the
+// managed nodes read from the API server, which the informer cache may not
+// have caught up with yet. Occupying is idempotent, the nodes the cache
+// already has are left as they are.
+func (r *multiCIDRRangeAllocator) occupyListedNodes(ctx context.Context) error {
+	// An empty resourceVersion makes a quorum read.
+	nodes, err := r.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: r.managedNodeSelector.String()})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		r.observeNode(ctx, &nodes.Items[i])
+	}
+	return nil
+}
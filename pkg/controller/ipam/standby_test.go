@@ -0,0 +1,106 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+func TestStandby(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil)
+	pending := makeNode("pending", nil)
+	// Allocated by the leader while the standby was running.
+	allocated := makeAllocatedNode("allocated", nil, "10.10.0.0/24")
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{pending, allocated}, clusterCIDR)
+	ra.standby.Store(true)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	require.NoError(t, ra.syncNode(ctx, "allocated"))
+	require.NoError(t, ra.syncClusterCIDR(ctx, "cc"))
+	assert.Empty(t, ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy())
+	updated, err := ra.networkClient.Get(ctx, "cc", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, updated.Finalizers, clusterCIDRFinalizer)
+
+	// The state is kept up to date.
+	nodeSelector, err := ra.nodeSelectorKey(clusterCIDR)
+	require.NoError(t, err)
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.0.0/24")
+	assert.True(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(podCIDR))
+
+	// Allocated by the leader right before the promotion, the informer did
+	// not see it yet.
+	late := makeAllocatedNode("late", nil, "10.10.1.0/24")
+	fakeNodeHandler := ra.client.(*test.FakeNodeHandler)
+	fakeNodeHandler.Existing = append(fakeNodeHandler.Existing, late)
+
+	ra.Promote(ctx)
+	_, latePodCIDR, _ := utilnet.ParseCIDRSloppy("10.10.1.0/24")
+	assert.True(t, ra.cidrMap[nodeSelector][0].IPv4CIDRSet.CIDRAllocated(latePodCIDR))
+	assert.Equal(t, 1, ra.cidrQueue.Len())
+	assert.Equal(t, 2, ra.nodeQueue.Len())
+
+	require.NoError(t, ra.syncClusterCIDR(ctx, "cc"))
+	updated, err = ra.networkClient.Get(ctx, "cc", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, updated.Finalizers, clusterCIDRFinalizer)
+
+	require.NoError(t, ra.syncNode(ctx, "pending"))
+	updatedNodes := ra.client.(*test.FakeNodeHandler).GetUpdatedNodesCopy()
+	i := slices.IndexFunc(updatedNodes, func(node *corev1.Node) bool { return node.Name == "pending" })
+	require.NotEqual(t, -1, i)
+	// The podCIDRs of the allocated nodes are not handed out twice.
+	assert.Equal(t, []string{"10.10.2.0/24"}, updatedNodes[i].Spec.PodCIDRs)
+}
+
+func TestStandbyDefaultClusterCIDR(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{makeNode("pending", nil)})
+	_, clusterCIDR, _ := utilnet.ParseCIDRSloppy("10.20.0.0/16")
+	ra.allocatorParams.ClusterCIDRs = []*net.IPNet{clusterCIDR}
+	ra.allocatorParams.NodeCIDRMaskSizes = []int{24}
+	ra.standby.Store(true)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	// The default ClusterCIDR is loaded but not created by the standby.
+	_, err := ra.networkClient.Get(ctx, defaultClusterCIDRName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), err)
+	assert.NotNil(t, clusterCIDRByName(defaultClusterCIDRName, ra.cidrMap))
+
+	ra.Promote(ctx)
+	created, err := ra.networkClient.Get(ctx, defaultClusterCIDRName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.0.0/16", created.Spec.IPv4)
+	assert.Contains(t, created.Finalizers, clusterCIDRFinalizer)
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+	netutil "k8s.io/utils/net"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+// Results of the sticky re-allocations, see stickyReallocations.
+const (
+	stickyRestored    = "restored"
+	stickyUnavailable = "unavailable"
+)
+
+// stickyAllocation is the podCIDRs a node had when it was released.
+type stickyAllocation struct {
+	nodeName    string
+	providerID  string
+	clusterCIDR string
+	podCIDRs    []string
+	releasedAt  time.Time
+}
+
+// stickyAllocationStore remembers the podCIDRs of the released nodes for a
+// window, indexed by node name and providerID, so that a node registering
+// again with the same identity gets its previous podCIDRs back. It is guarded
+// by the allocator lock.
+type stickyAllocationStore struct {
+	clock  clock.PassiveClock
+	window time.Duration
+	// byName and byProviderID hold the same allocations.
+	byName       map[string]*stickyAllocation
+	byProviderID map[string]*stickyAllocation
+}
+
+func newStickyAllocationStore(clock clock.PassiveClock, window time.Duration) *stickyAllocationStore {
+	return &stickyAllocationStore{
+		clock:        clock,
+		window:       window,
+		byName:       make(map[string]*stickyAllocation),
+		byProviderID: make(map[string]*stickyAllocation),
+	}
+}
+
+func (s *stickyAllocationStore) enabled() bool {
+	return s.window > 0
+}
+
+// remember records the podCIDRs released from the node, it returns nil if
+// the store is disabled.
+func (s *stickyAllocationStore) remember(node *corev1.Node, clusterCIDR string) *stickyAllocation {
+	if !s.enabled() {
+		return nil
+	}
+	s.expire()
+	allocation := &stickyAllocation{
+		nodeName:    node.Name,
+		providerID:  node.Spec.ProviderID,
+		clusterCIDR: clusterCIDR,
+		podCIDRs:    slices.Clone(node.Spec.PodCIDRs),
+		releasedAt:  s.clock.Now(),
+	}
+	s.forget(s.byName[node.Name])
+	s.forget(s.byProviderID[node.Spec.ProviderID])
+	s.byName[node.Name] = allocation
+	if allocation.providerID != "" {
+		s.byProviderID[allocation.providerID] = allocation
+	}
+	return allocation
+}
+
+// lookup returns the podCIDRs released from a node with the identity of the
+// node within the window, nil if there are none. A node matches on its
+// providerID, or on its name unless both have a different providerID.
+func (s *stickyAllocationStore) lookup(node *corev1.Node) *stickyAllocation {
+	if !s.enabled() {
+		return nil
+	}
+	s.expire()
+	if allocation, ok := s.byProviderID[node.Spec.ProviderID]; ok && node.Spec.ProviderID != "" {
+		return allocation
+	}
+	allocation, ok := s.byName[node.Name]
+	if !ok || (allocation.providerID != "" && node.Spec.ProviderID != "" && allocation.providerID != node.Spec.ProviderID) {
+		return nil
+	}
+	return allocation
+}
+
+// forget removes the allocation from the store.
+func (s *stickyAllocationStore) forget(allocation *stickyAllocation) {
+	if allocation == nil {
+		return
+	}
+	if s.byName[allocation.nodeName] == allocation {
+		delete(s.byName, allocation.nodeName)
+	}
+	if s.byProviderID[allocation.providerID] == allocation {
+		delete(s.byProviderID, allocation.providerID)
+	}
+}
+
+// expire forgets the allocations released before the window.
+func (s *stickyAllocationStore) expire() {
+	now := s.clock.Now()
+	for _, allocation := range s.byName {
+		if now.Sub(allocation.releasedAt) >= s.window {
+			s.forget(allocation)
+		}
+	}
+}
+
+// holdStickyCIDRs requires the caller to hold r.lock.
+// holdStickyCIDRs quarantines the podCIDRs of the sticky allocation until the
+// end of the window, so that they are not handed out to other nodes before
+// the node registers again.
+func (r *multiCIDRRangeAllocator) holdStickyCIDRs(logger klog.Logger, allocation *stickyAllocation, clusterCIDR *cidrset.ClusterCIDR, cidrs []*net.IPNet) {
+	until := allocation.releasedAt.Add(r.stickyAllocations.window)
+	for _, cidr := range cidrs {
+		cidrSet, err := r.associatedCIDRSet(clusterCIDR, cidr)
+		if err == nil && cidrSet != nil {
+			err = cidrSet.Hold(cidr, until)
+		}
+		if err != nil {
+			logger.Error(err, "Failed to hold the podCIDR for the node", "node", klog.KRef("", allocation.nodeName), "CIDR", cidr, "clusterCIDR", clusterCIDR.Name)
+		}
+	}
+	r.capacityChanged()
+}
+
+// restoreStickyCIDRs requires the caller to hold r.lock.
+// restoreStickyCIDRs reserves the podCIDRs the node had before it was
+// released, if they are still free, including quarantined, and the node still
+// matches their ClusterCIDR. It returns nil if there are none to restore. The
+// allocation is remembered until completeStickyRestore is called with the
+// outcome of the podCIDRs patch.
+func (r *multiCIDRRangeAllocator) restoreStickyCIDRs(logger klog.Logger, node *corev1.Node) ([]*net.IPNet, *cidrset.ClusterCIDR, *stickyAllocation) {
+	allocation := r.stickyAllocations.lookup(node)
+	if allocation == nil {
+		return nil, nil, nil
+	}
+	cidrs, clusterCIDR, reason := r.stickyCIDRs(logger, node, allocation)
+	if reason != "" {
+		logger.V(2).Info("Previous podCIDRs of node can not be restored", "node", klog.KObj(node), "clusterCIDR", allocation.clusterCIDR, "podCIDRs", allocation.podCIDRs, "reason", reason)
+		stickyReallocations.WithLabelValues(stickyUnavailable).Inc()
+		return nil, nil, nil
+	}
+	for i, cidr := range cidrs {
+		if err := r.Occupy(clusterCIDR, cidr); err != nil {
+			logger.Error(err, "Failed to occupy the previous podCIDRs of node", "node", klog.KObj(node))
+			// The podCIDRs already occupied stay held for the node.
+			r.releaseReservedCIDRs(logger, cidrs[:i], repeatClusterCIDR(clusterCIDR, i))
+			r.holdStickyCIDRs(logger, allocation, clusterCIDR, cidrs[:i])
+			stickyReallocations.WithLabelValues(stickyUnavailable).Inc()
+			return nil, nil, nil
+		}
+	}
+	logger.Info("Restoring the previous podCIDRs of node", "node", klog.KObj(node), "clusterCIDR", clusterCIDR.Name, "podCIDRs", allocation.podCIDRs, "releasedAt", allocation.releasedAt)
+	return cidrs, clusterCIDR, allocation
+}
+
+// completeStickyRestore requires the caller to hold r.lock.
+// completeStickyRestore forgets the sticky allocation once its podCIDRs are
+// patched on the node. Otherwise they are held again for the node, so that
+// they are not handed out to another node before its next sync.
+func (r *multiCIDRRangeAllocator) completeStickyRestore(logger klog.Logger, allocation *stickyAllocation, clusterCIDR *cidrset.ClusterCIDR, cidrs []*net.IPNet, err error) {
+	if err != nil {
+		r.holdStickyCIDRs(logger, allocation, clusterCIDR, cidrs)
+		return
+	}
+	r.stickyAllocations.forget(allocation)
+	stickyReallocations.WithLabelValues(stickyRestored).Inc()
+}
+
+// stickyCIDRs requires the caller to hold r.lock.
+// stickyCIDRs returns the podCIDRs of the sticky allocation and their
+// ClusterCIDR, or the reason why they can not be restored to the node.
+func (r *multiCIDRRangeAllocator) stickyCIDRs(logger klog.Logger, node *corev1.Node, allocation *stickyAllocation) ([]*net.IPNet, *cidrset.ClusterCIDR, string) {
+	clusterCIDR := clusterCIDRByName(allocation.clusterCIDR, r.cidrMap)
+	if clusterCIDR == nil {
+		return nil, nil, "ClusterCIDR not found"
+	}
+	if clusterCIDR.Terminating {
+		return nil, nil, "ClusterCIDR terminating"
+	}
+	if !r.ownsClusterCIDRShard(clusterCIDR.Name) {
+		return nil, nil, "ClusterCIDR of another shard"
+	}
+	if r.shadowedClusterCIDR(clusterCIDR, r.cidrMap) {
+		return nil, nil, "ClusterCIDR overlapping an older one of another shard"
+	}
+	matching, err := r.orderedMatchingClusterCIDRs(node, false, r.cidrMap)
+	if err != nil || !slices.Contains(matching, clusterCIDR) {
+		return nil, nil, "ClusterCIDR no longer matches the node"
+	}
+
+	cidrs := make([]*net.IPNet, 0, len(allocation.podCIDRs))
+	for _, podCIDR := range allocation.podCIDRs {
+		_, cidr, err := netutil.ParseCIDRSloppy(podCIDR)
+		if err != nil {
+			return nil, nil, "invalid podCIDR"
+		}
+		if cidrSet, err := r.associatedCIDRSet(clusterCIDR, cidr); err != nil || cidrSet == nil || !cidrSet.ClusterCIDR.Contains(cidr.IP) {
+			return nil, nil, "podCIDR " + podCIDR + " not in the ClusterCIDR"
+		}
+		if r.cidrInAllocatedList(logger, cidr, r.cidrMap) || r.cidrOverlapWithAllocatedList(logger, cidr, r.cidrMap) {
+			return nil, nil, "podCIDR " + podCIDR + " allocated to another node"
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, clusterCIDR, ""
+}
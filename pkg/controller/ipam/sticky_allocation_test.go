@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+	testingclock "k8s.io/utils/clock/testing"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/test"
+)
+
+func withProviderID(node *corev1.Node, providerID string) *corev1.Node {
+	node.Spec.ProviderID = providerID
+	return node
+}
+
+// releaseNode occupies the podCIDRs of the node and releases them, as if the
+// node was deleted.
+func releaseNode(ctx context.Context, t *testing.T, ra *multiCIDRRangeAllocator, node *corev1.Node) {
+	t.Helper()
+
+	ra.lock.Lock()
+	_, err := ra.occupyCIDRs(klog.FromContext(ctx), node, ra.cidrMap)
+	ra.lock.Unlock()
+	require.NoError(t, err)
+	require.NoError(t, ra.ReleaseCIDR(ctx, node))
+}
+
+func TestStickyAllocation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		recreated   *corev1.Node
+		elapsed     time.Duration
+		taken       bool
+		wantPodCIDR string
+	}{
+		{
+			name:        "same name and providerID",
+			recreated:   withProviderID(makeNode("node", nil), "metal://rack1/node"),
+			wantPodCIDR: "10.10.1.0/24",
+		},
+		{
+			name:        "same providerID",
+			recreated:   withProviderID(makeNode("renamed", nil), "metal://rack1/node"),
+			wantPodCIDR: "10.10.1.0/24",
+		},
+		{
+			name:        "same name without providerID",
+			recreated:   makeNode("node", nil),
+			wantPodCIDR: "10.10.1.0/24",
+		},
+		{
+			name:        "same name and other providerID",
+			recreated:   withProviderID(makeNode("node", nil), "metal://rack2/node"),
+			wantPodCIDR: "10.10.0.0/24",
+		},
+		{
+			name:        "window elapsed",
+			recreated:   withProviderID(makeNode("node", nil), "metal://rack1/node"),
+			elapsed:     time.Hour,
+			wantPodCIDR: "10.10.0.0/24",
+		},
+		{
+			name:        "podCIDR taken",
+			recreated:   withProviderID(makeNode("node", nil), "metal://rack1/node"),
+			taken:       true,
+			wantPodCIDR: "10.10.0.0/24",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{tc.recreated}, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+			fakeClock := testingclock.NewFakePassiveClock(time.Now())
+			ra.stickyAllocations = newStickyAllocationStore(fakeClock, time.Hour)
+			require.NoError(t, ra.bootstrap(ctx))
+
+			releaseNode(ctx, t, ra, withProviderID(makeAllocatedNode("node", nil, "10.10.1.0/24"), "metal://rack1/node"))
+			fakeClock.SetTime(fakeClock.Now().Add(tc.elapsed))
+			if tc.taken {
+				ra.lock.Lock()
+				_, err := ra.occupyCIDRs(klog.FromContext(ctx), makeAllocatedNode("other", nil, "10.10.1.0/24"), ra.cidrMap)
+				ra.lock.Unlock()
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, ra.syncNode(ctx, tc.recreated.Name))
+			assert.Equal(t, []string{tc.wantPodCIDR}, updatedNode(t, ra, tc.recreated.Name).Spec.PodCIDRs)
+			decision, ok := ra.decisions.get(tc.recreated.Name)
+			require.True(t, ok)
+			assert.Equal(t, tc.wantPodCIDR == "10.10.1.0/24", decision.Rule == stickyRule, decision.summary())
+		})
+	}
+}
+
+func TestStickyAllocationHeld(t *testing.T) {
+	for _, reuseCooldownSeconds := range []int32{0, 3600} {
+		t.Run(fmt.Sprintf("reuse cooldown %ds", reuseCooldownSeconds), func(t *testing.T) {
+			_, ctx := ktesting.NewTestContext(t)
+			// Two podCIDRs, one of them allocated.
+			clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/23", "", 8, nil)
+			clusterCIDR.Spec.ReuseCooldownSeconds = reuseCooldownSeconds
+			nodes := []*corev1.Node{
+				makeAllocatedNode("allocated", nil, "10.10.0.0/24"),
+				makeNode("new", nil),
+				withProviderID(makeNode("node", nil), "metal://rack1/node"),
+			}
+			ra := newBootstrapTestAllocator(t, ctx, nodes, clusterCIDR)
+			ra.stickyAllocations = newStickyAllocationStore(testingclock.NewFakePassiveClock(time.Now()), time.Hour)
+			require.NoError(t, ra.bootstrap(ctx))
+
+			releaseNode(ctx, t, ra, withProviderID(makeAllocatedNode("node", nil, "10.10.1.0/24"), "metal://rack1/node"))
+
+			// The released podCIDR is held for its previous owner, whatever
+			// the reuse cooldown.
+			cidrSet := clusterCIDRByName("cc", ra.cidrMap).IPv4CIDRSet
+			assert.Equal(t, 1, cidrSet.QuarantinedCount())
+			require.Error(t, ra.syncNode(ctx, "new"))
+			require.NoError(t, ra.syncNode(ctx, "node"))
+			assert.Equal(t, []string{"10.10.1.0/24"}, updatedNode(t, ra, "node").Spec.PodCIDRs)
+
+			_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.1.0/24")
+			assert.True(t, cidrSet.CIDRAllocated(podCIDR))
+			assert.Zero(t, cidrSet.QuarantinedCount())
+		})
+	}
+}
+
+func TestStickyAllocationPatchFailed(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+	node := withProviderID(makeNode("node", nil), "metal://rack1/node")
+	node.ResourceVersion = "1"
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, nil))
+	ra.stickyAllocations = newStickyAllocationStore(testingclock.NewFakePassiveClock(time.Now()), time.Hour)
+	// The node changed since it was read, the podCIDRs patch conflicts.
+	ra.allocatorParams.Shards = 1
+	changed := node.DeepCopy()
+	changed.ResourceVersion = "2"
+	ra.client.(*test.FakeNodeHandler).UpdatedNodes = []*corev1.Node{changed}
+	require.NoError(t, ra.bootstrap(ctx))
+	ra.AcquireShard(ctx, 0)
+
+	releaseNode(ctx, t, ra, withProviderID(makeAllocatedNode("node", nil, "10.10.1.0/24"), "metal://rack1/node"))
+	require.Error(t, ra.syncNode(ctx, "node"))
+
+	// The podCIDR is still remembered and held for the node.
+	ra.lock.Lock()
+	assert.NotNil(t, ra.stickyAllocations.lookup(node))
+	ra.lock.Unlock()
+	cidrSet := clusterCIDRByName("cc", ra.cidrMap).IPv4CIDRSet
+	_, podCIDR, _ := utilnet.ParseCIDRSloppy("10.10.1.0/24")
+	assert.False(t, cidrSet.CIDRAllocated(podCIDR))
+	assert.Equal(t, 1, cidrSet.QuarantinedCount())
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/utils/clock"
+)
+
+// instrumentationScope is the name of the tracer of the allocator.
+const instrumentationScope = "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam"
+
+// queueWaitTracker records when keys were added to a workqueue, so that the
+// time they waited in the queue can be traced.
+type queueWaitTracker struct {
+	clock clock.PassiveClock
+	// lock guards addedAt.
+	lock sync.Mutex
+	// addedAt maps the keys in the queue to the time they were first added
+	// since they were last taken from the queue.
+	addedAt map[string]time.Time
+}
+
+func newQueueWaitTracker(clock clock.PassiveClock) *queueWaitTracker {
+	return &queueWaitTracker{
+		clock:   clock,
+		addedAt: make(map[string]time.Time),
+	}
+}
+
+// added records that key was added to the queue, unless it is already queued.
+func (t *queueWaitTracker) added(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.addedAt[key]; !ok {
+		t.addedAt[key] = t.clock.Now()
+	}
+}
+
+// taken returns when key was added to the queue and forgets it.
+func (t *queueWaitTracker) taken(key string) (time.Time, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	addedAt, ok := t.addedAt[key]
+	delete(t.addedAt, key)
+	return addedAt, ok
+}
+
+// startSyncSpan starts the root span of the sync of a queue key. If the time
+// the key was added to the queue is known, the span starts then and has a
+// child span covering the time spent in the queue.
+func (r *multiCIDRRangeAllocator) startSyncSpan(ctx context.Context, name string, queueWait *queueWaitTracker, key string) (context.Context, trace.Span) {
+	attrs := trace.WithAttributes(attribute.String("key", key))
+	addedAt, ok := queueWait.taken(key)
+	if !ok {
+		return r.tracer.Start(ctx, name, attrs)
+	}
+
+	ctx, span := r.tracer.Start(ctx, name, attrs, trace.WithTimestamp(addedAt))
+	_, waitSpan := r.tracer.Start(ctx, "queueWait", trace.WithTimestamp(addedAt))
+	waitSpan.End()
+	return ctx, span
+}
+
+// lockWithSpan acquires r.lock and traces the time spent waiting for it.
+func (r *multiCIDRRangeAllocator) lockWithSpan(ctx context.Context) {
+	_, span := r.tracer.Start(ctx, "lockWait")
+	r.lock.Lock()
+	span.End()
+}
+
+// endSpan records err, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2/ktesting"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestQueueWaitTracker(t *testing.T) {
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	tracker := newQueueWaitTracker(fakeClock)
+	start := fakeClock.Now()
+
+	tracker.added("node")
+	// Adding a key that is already queued keeps the first time.
+	fakeClock.SetTime(start.Add(time.Second))
+	tracker.added("node")
+
+	addedAt, ok := tracker.taken("node")
+	assert.True(t, ok)
+	assert.Equal(t, start, addedAt)
+
+	_, ok = tracker.taken("node")
+	assert.False(t, ok)
+}
+
+func TestSyncNodeSpans(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("cc", "10.10.0.0/16", "", 8, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	node := makeNode("node", map[string]string{"pool": "a"})
+
+	ra := newBootstrapTestAllocator(t, ctx, []*corev1.Node{node}, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+
+	exporter := tracetest.NewInMemoryExporter()
+	ra.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer(instrumentationScope)
+
+	ra.enqueueNode("node")
+	require.True(t, ra.processNextNodeWorkItem(ctx))
+
+	spans := exporter.GetSpans()
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	assert.ElementsMatch(t, []string{"syncNode", "queueWait", "lockWait", "matchClusterCIDRs", "allocateCIDR", "PatchNodeCIDRs", "PatchNodeCondition"}, names)
+
+	var root tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "syncNode" {
+			root = span
+		}
+	}
+	for _, span := range spans {
+		assert.Equal(t, root.SpanContext.TraceID(), span.SpanContext.TraceID(), "span %s", span.Name)
+	}
+}
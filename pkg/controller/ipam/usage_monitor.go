@@ -0,0 +1,237 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	cidrset "sigs.k8s.io/node-ipam-controller/pkg/controller/ipam/multicidrset"
+)
+
+const (
+	// usageCheckPeriod is the interval at which the usage of the CIDR sets is
+	// sampled and compared to the warning thresholds.
+	usageCheckPeriod = 30 * time.Second
+	// DefaultUsageForecastWindow is the default period over which the allocation
+	// rate is measured to forecast the exhaustion of a CIDR set.
+	DefaultUsageForecastWindow = time.Hour
+	// noExhaustion is the forecast of sets that are not filling up.
+	noExhaustion = time.Duration(math.MaxInt64)
+)
+
+// usageSetKey identifies a CIDR set of a ClusterCIDR.
+type usageSetKey struct {
+	clusterCIDRName string
+	cidr            string
+}
+
+// usageSample is the number of allocated CIDRs of a set at a point in time.
+type usageSample struct {
+	time      time.Time
+	allocated int
+}
+
+// usageObservation is the result of sampling the usage of a CIDR set.
+type usageObservation struct {
+	// usage is the percentage of allocated CIDRs.
+	usage float64
+	// timeToExhaustion is the estimated time until the set is exhausted,
+	// noExhaustion if the set is not filling up.
+	timeToExhaustion time.Duration
+	// crossedThreshold is the highest warning threshold the usage rose above
+	// since the last observation, 0 if none.
+	crossedThreshold float64
+}
+
+// usageMonitor forecasts the exhaustion of the CIDR sets from the change of
+// their usage over a sliding window, and detects when their usage rises above
+// one of the warning thresholds. It is not safe for concurrent use.
+type usageMonitor struct {
+	clock  clock.PassiveClock
+	window time.Duration
+	// thresholds are the warning thresholds in percent, in ascending order.
+	thresholds []float64
+	samples    map[usageSetKey][]usageSample
+	// warned holds the highest threshold that was reported for each set.
+	warned map[usageSetKey]float64
+}
+
+func newUsageMonitor(clock clock.PassiveClock, window time.Duration, thresholds []float64) *usageMonitor {
+	sorted := slices.Clone(thresholds)
+	slices.Sort(sorted)
+	return &usageMonitor{
+		clock:      clock,
+		window:     window,
+		thresholds: sorted,
+		samples:    make(map[usageSetKey][]usageSample),
+		warned:     make(map[usageSetKey]float64),
+	}
+}
+
+// validateUsageWarningThresholds checks that the thresholds are percentages.
+func validateUsageWarningThresholds(thresholds []float64) error {
+	for _, threshold := range thresholds {
+		if threshold <= 0 || threshold > 100 {
+			return fmt.Errorf("invalid CIDR usage warning threshold %v: must be in (0, 100]", threshold)
+		}
+	}
+	return nil
+}
+
+// observe records the number of allocated CIDRs of the set.
+func (m *usageMonitor) observe(key usageSetKey, allocated, maxCIDRs int) usageObservation {
+	now := m.clock.Now()
+
+	samples := append(m.samples[key], usageSample{time: now, allocated: allocated})
+	start := 0
+	for start < len(samples)-1 && now.Sub(samples[start].time) > m.window {
+		start++
+	}
+	samples = samples[start:]
+	m.samples[key] = samples
+
+	observation := usageObservation{
+		usage:            100 * float64(allocated) / float64(maxCIDRs),
+		timeToExhaustion: noExhaustion,
+	}
+
+	free := maxCIDRs - allocated
+	oldest := samples[0]
+	elapsed := now.Sub(oldest.time)
+	switch {
+	case free <= 0:
+		observation.timeToExhaustion = 0
+	case elapsed > 0 && allocated > oldest.allocated:
+		rate := float64(allocated-oldest.allocated) / elapsed.Seconds()
+		if seconds := float64(free) / rate; seconds < noExhaustion.Seconds() {
+			observation.timeToExhaustion = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	var reached float64
+	for _, threshold := range m.thresholds {
+		if observation.usage >= threshold {
+			reached = threshold
+		}
+	}
+	if reached > m.warned[key] {
+		observation.crossedThreshold = reached
+	}
+	m.warned[key] = reached
+
+	return observation
+}
+
+// forget drops the state of the sets that are not in keep.
+func (m *usageMonitor) forget(keep sets.Set[usageSetKey]) []usageSetKey {
+	var forgotten []usageSetKey
+	for key := range m.samples {
+		if !keep.Has(key) {
+			delete(m.samples, key)
+			delete(m.warned, key)
+			forgotten = append(forgotten, key)
+		}
+	}
+	return forgotten
+}
+
+// usageWarning is a warning to be reported on a ClusterCIDR.
+type usageWarning struct {
+	clusterCIDRName string
+	message         string
+}
+
+// checkUsage samples the usage of every CIDR set, updates the exhaustion
+// forecast and emits a Warning event on the ClusterCIDR when a set rises above
+// a warning threshold.
+func (r *multiCIDRRangeAllocator) checkUsage(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+
+	warnings := r.observeUsage()
+	if r.standby.Load() {
+		// The leader reports the usage.
+		return
+	}
+	for _, warning := range warnings {
+		logger.Info("ClusterCIDR usage is high", "clusterCIDR", warning.clusterCIDRName, "message", warning.message)
+		clusterCIDR, err := r.clusterCIDRLister.Get(warning.clusterCIDRName)
+		if err != nil {
+			logger.V(2).Info("Unable to get ClusterCIDR to record usage event", "clusterCIDR", warning.clusterCIDRName, "err", err)
+			continue
+		}
+		r.recorder.Event(clusterCIDR, corev1.EventTypeWarning, "ClusterCIDRUsageHigh", warning.message)
+	}
+}
+
+// observeUsage feeds the usage of every CIDR set to the usageMonitor and
+// returns the warnings to be reported.
+func (r *multiCIDRRangeAllocator) observeUsage() []usageWarning {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var warnings []usageWarning
+	seen := sets.New[usageSetKey]()
+	for _, clusterCIDRs := range r.cidrMap {
+		for _, clusterCIDR := range clusterCIDRs {
+			for _, cidrSet := range []*cidrset.MultiCIDRSet{clusterCIDR.IPv4CIDRSet, clusterCIDR.IPv6CIDRSet} {
+				if cidrSet == nil {
+					continue
+				}
+				key := usageSetKey{clusterCIDRName: clusterCIDR.Name, cidr: cidrSet.Label}
+				seen.Insert(key)
+				// Quarantined CIDRs can not be allocated either, so they count
+				// as used. Counting them also lifts the expired quarantines,
+				// which refreshes their metric.
+				used := cidrSet.AllocatedCount() + cidrSet.QuarantinedCount()
+
+				observation := r.usageMonitor.observe(key, used, cidrSet.MaxCIDRs)
+				cidrSetTimeToExhaustion.WithLabelValues(key.cidr, key.clusterCIDRName).Set(timeToExhaustionSeconds(observation.timeToExhaustion))
+				if observation.crossedThreshold == 0 {
+					continue
+				}
+
+				message := fmt.Sprintf("Usage of %s is %.1f%%, above the warning threshold of %v%%", key.cidr, observation.usage, observation.crossedThreshold)
+				if observation.timeToExhaustion != noExhaustion {
+					message += fmt.Sprintf(", estimated time to exhaustion is %s", observation.timeToExhaustion.Round(time.Second))
+				}
+				warnings = append(warnings, usageWarning{clusterCIDRName: clusterCIDR.Name, message: message})
+			}
+		}
+	}
+
+	for _, key := range r.usageMonitor.forget(seen) {
+		cidrSetTimeToExhaustion.DeleteLabelValues(key.cidr, key.clusterCIDRName)
+	}
+
+	return warnings
+}
+
+func timeToExhaustionSeconds(d time.Duration) float64 {
+	if d == noExhaustion {
+		return math.Inf(1)
+	}
+	return d.Seconds()
+}
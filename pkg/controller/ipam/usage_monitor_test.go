@@ -0,0 +1,158 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+	testingclock "k8s.io/utils/clock/testing"
+	utilnet "k8s.io/utils/net"
+)
+
+func TestUsageMonitorForecast(t *testing.T) {
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	monitor := newUsageMonitor(fakeClock, 10*time.Minute, nil)
+	key := usageSetKey{clusterCIDRName: "cc", cidr: "10.0.0.0/16"}
+
+	// A single sample does not give a rate.
+	observation := monitor.observe(key, 10, 100)
+	assert.Equal(t, noExhaustion, observation.timeToExhaustion)
+	assert.InDelta(t, 10, observation.usage, 0.001)
+
+	// 10 allocations per minute, 80 free CIDRs left.
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	observation = monitor.observe(key, 20, 100)
+	assert.Equal(t, 8*time.Minute, observation.timeToExhaustion)
+
+	// Samples older than the window are dropped: the rate is measured from
+	// the 20 allocated CIDRs 10 minutes ago.
+	fakeClock.SetTime(fakeClock.Now().Add(10 * time.Minute))
+	observation = monitor.observe(key, 40, 100)
+	assert.Equal(t, 30*time.Minute, observation.timeToExhaustion)
+
+	// Releases stop the forecast.
+	fakeClock.SetTime(fakeClock.Now().Add(10 * time.Minute))
+	observation = monitor.observe(key, 30, 100)
+	assert.Equal(t, noExhaustion, observation.timeToExhaustion)
+
+	observation = monitor.observe(key, 100, 100)
+	assert.Equal(t, time.Duration(0), observation.timeToExhaustion)
+
+	assert.Equal(t, []usageSetKey{key}, monitor.forget(sets.New[usageSetKey]()))
+	assert.Empty(t, monitor.samples)
+}
+
+func TestUsageMonitorThresholds(t *testing.T) {
+	fakeClock := testingclock.NewFakePassiveClock(time.Now())
+	monitor := newUsageMonitor(fakeClock, time.Hour, []float64{95, 80})
+	key := usageSetKey{clusterCIDRName: "cc", cidr: "10.0.0.0/16"}
+
+	for _, tc := range []struct {
+		allocated int
+		crossed   float64
+	}{
+		{allocated: 50, crossed: 0},
+		{allocated: 80, crossed: 80},
+		{allocated: 85, crossed: 0},
+		{allocated: 96, crossed: 95},
+		{allocated: 97, crossed: 0},
+		// Falling below a threshold and rising above it again warns again.
+		{allocated: 70, crossed: 0},
+		{allocated: 99, crossed: 95},
+	} {
+		observation := monitor.observe(key, tc.allocated, 100)
+		assert.InDelta(t, tc.crossed, observation.crossedThreshold, 0, "allocated %d", tc.allocated)
+	}
+}
+
+func TestValidateUsageWarningThresholds(t *testing.T) {
+	assert.NoError(t, validateUsageWarningThresholds([]float64{80, 95, 100}))
+	assert.Error(t, validateUsageWarningThresholds([]float64{0}))
+	assert.Error(t, validateUsageWarningThresholds([]float64{101}))
+}
+
+func TestCheckUsage(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("small-cc", "10.10.0.0/30", "", 0, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+
+	ra := newBootstrapTestAllocator(t, ctx, nil, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+	ra.usageMonitor = newUsageMonitor(testingclock.NewFakePassiveClock(time.Now()), time.Hour, []float64{50})
+	recorder := record.NewFakeRecorder(10)
+	ra.recorder = recorder
+
+	ra.checkUsage(ctx)
+	assert.Empty(t, recorder.Events)
+	assert.True(t, math.IsInf(testutil.ToFloat64(cidrSetTimeToExhaustion.WithLabelValues("10.10.0.0/30", "small-cc")), 1))
+
+	clusterCIDRSet := ra.cidrMap[firstKey(ra.cidrMap)][0].IPv4CIDRSet
+	for _, cidr := range []string{"10.10.0.0/32", "10.10.0.1/32"} {
+		_, c, _ := utilnet.ParseCIDRSloppy(cidr)
+		require.NoError(t, clusterCIDRSet.Occupy(c))
+	}
+
+	ra.checkUsage(ctx)
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning ClusterCIDRUsageHigh Usage of 10.10.0.0/30 is 50.0%"), event)
+}
+
+func TestCheckUsageQuarantined(t *testing.T) {
+	_, ctx := ktesting.NewTestContext(t)
+
+	clusterCIDR := makeSyncedClusterCIDR("small-cc", "10.10.0.0/30", "", 0, makeNodeSelector("pool", corev1.NodeSelectorOpIn, []string{"a"}))
+	clusterCIDR.Spec.ReuseCooldownSeconds = 300
+	var nodes []*corev1.Node
+	for i, cidr := range []string{"10.10.0.0/32", "10.10.0.1/32"} {
+		node := makeAllocatedNode(fmt.Sprintf("node-%d", i), map[string]string{"pool": "a"}, cidr)
+		nodes = append(nodes, node)
+	}
+
+	ra := newBootstrapTestAllocator(t, ctx, nodes, clusterCIDR)
+	require.NoError(t, ra.bootstrap(ctx))
+	ra.usageMonitor = newUsageMonitor(testingclock.NewFakePassiveClock(time.Now()), time.Hour, []float64{50})
+	recorder := record.NewFakeRecorder(10)
+	ra.recorder = recorder
+
+	// The released CIDRs can not be allocated until their cooldown elapsed.
+	for _, node := range nodes {
+		require.NoError(t, ra.ReleaseCIDR(ctx, node))
+	}
+	ra.checkUsage(ctx)
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning ClusterCIDRUsageHigh Usage of 10.10.0.0/30 is 50.0%"), event)
+}
+
+func firstKey[V any](m map[string]V) string {
+	for k := range m {
+		return k
+	}
+	return ""
+}
@@ -17,16 +17,27 @@ package leaderelection
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	nodeutil "k8s.io/component-helpers/node/util"
 	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
 )
 
+// leaseRenewalTolerance is how long the lease may stay expired before the
+// leader election healthz check fails.
+const leaseRenewalTolerance = 20 * time.Second
+
 // Config holds the configuration parameters for leader election
 type Config struct {
 	EnableLeaderElection    bool          `long:"enable-leader-election" description:"Enable leader election for the controller manager. Ensures there is only one active controller manager." env:"IPAM_ENABLE_LEADER_ELECTION"`
@@ -37,15 +48,34 @@ type Config struct {
 	RetryPeriod             time.Duration `long:"leader-elect-retry-period" default:"2s" description:"Duration the clients should wait between attempting acquisition and renewal of a leadership (duration string)." env:"IPAM_LEADER_ELECT_RETRY_PERIOD"`
 	ResourceLock            string        `long:"leader-elect-resource-lock" default:"leases" description:"The type of resource object that is used for locking. Supported options are 'leases', 'endpoints', 'configmaps'." env:"IPAM_RESOURCE_LOCK_NAME"`
 	ResourceName            string        `long:"leader-elect-resource-name" default:"node-ipam-controller" description:"The name of the resource object that is used for locking." env:"IPAM_RESOURCE_NAME"`
+	Coordinated             bool          `long:"leader-elect-coordinated" description:"Use coordinated leader election: every replica registers a LeaseCandidate and the API server picks the leader, preferring the newest binary version among the candidates with the oldest emulation version. Requires the leases resource lock and the CoordinatedLeaderElection feature of the API server." env:"IPAM_LEADER_ELECT_COORDINATED"`
+	EmulationVersion        string        `long:"leader-elect-emulation-version" description:"Emulation version of the LeaseCandidate for coordinated leader election. Defaults to the binary version." env:"IPAM_LEADER_ELECT_EMULATION_VERSION"`
+	WarmStandby             bool          `long:"leader-elect-warm-standby" description:"Keep the informers and the allocator state of the replicas that are not the leader up to date, so that a new leader only has to sync the nodes and ClusterCIDRs again before allocating." env:"IPAM_LEADER_ELECT_WARM_STANDBY"`
+	Shards                  int           `long:"leader-elect-shards" default:"0" description:"Number of shards the ClusterCIDRs are partitioned into, each with its own lease named <resource-name>-shard-<i>. Every replica allocates from the ClusterCIDRs of the shards it holds. A single leader is elected if 0." env:"IPAM_LEADER_ELECT_SHARDS"`
+	// BinaryVersion is the version of the controller, advertised in the
+	// LeaseCandidate for coordinated leader election.
+	BinaryVersion string `no-flag:"true"`
 }
 
-// StartLeaderElection starts the leader election process
+// StartLeaderElection runs the leader election process until ctx is cancelled.
+// runFunc is called once the lease is acquired and its context is cancelled
+// with ctx or when the lease is lost. Once ctx is cancelled, the lease is only
+// released after runFunc returned, so that the work in progress is drained
+// before another replica takes over. A liveness check that fails when the
+// leader can not renew its lease is added to registry. Configuration errors are
+// returned before the election starts.
 func StartLeaderElection(
-	ctx context.Context, kubeClient kubernetes.Interface, config Config,
+	ctx context.Context, kubeClient kubernetes.Interface, config Config, registry server.CheckRegistry,
 	cancel context.CancelFunc, runFunc func(context.Context),
-) {
-	id := lockID(config.LeaderElectionID)
-	namespace := lockNamespace(config.LeaderElectionNamespace)
+) error {
+	id, err := lockID(config.LeaderElectionID)
+	if err != nil {
+		return err
+	}
+	namespace, err := lockNamespace(config.LeaderElectionNamespace)
+	if err != nil {
+		return err
+	}
 	klog.Infof("leader election id: %s, namespace: %s", id, namespace)
 
 	rl, err := resourcelock.New(
@@ -59,19 +89,36 @@ func StartLeaderElection(
 		},
 	)
 	if err != nil {
-		klog.Fatalf("failed to create leader election lock: %v", err)
+		return fmt.Errorf("failed to create leader election lock: %w", err)
 	}
 
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+	// The election outlives ctx until runFunc returned, see above.
+	electionCtx, cancelElection := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelElection()
+	// leading is set once the lease is acquired, stopped is closed once
+	// runFunc returned.
+	var leading atomic.Bool
+	stopped := make(chan struct{})
+
+	watchDog := leaderelection.NewLeaderHealthzAdaptor(leaseRenewalTolerance)
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
 		Lock:            rl,
+		WatchDog:        watchDog,
 		LeaseDuration:   config.LeaseDuration,
 		RenewDeadline:   config.RenewDeadline,
 		RetryPeriod:     config.RetryPeriod,
 		ReleaseOnCancel: true,
+		Name:            config.ResourceName,
+		Coordinated:     config.Coordinated,
 		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
+			OnStartedLeading: func(leadingCtx context.Context) {
+				leading.Store(true)
+				defer close(stopped)
+				runCtx, cancelRun := context.WithCancel(leadingCtx)
+				defer cancelRun()
+				defer context.AfterFunc(ctx, cancelRun)()
 				klog.Infof("Started leading as %s", id)
-				runFunc(ctx)
+				runFunc(runCtx)
 			},
 			OnStoppedLeading: func() {
 				klog.Infof("%s stopped leading", id)
@@ -79,6 +126,7 @@ func StartLeaderElection(
 				cancel()
 			},
 			OnNewLeader: func(identity string) {
+				observeLeader(config.ResourceName, identity)
 				if identity == id {
 					klog.Infof("I am the new leader: %s", id)
 				} else {
@@ -87,31 +135,98 @@ func StartLeaderElection(
 			},
 		},
 	})
+	if err != nil {
+		return fmt.Errorf("invalid leader election configuration: %w", err)
+	}
+
+	if config.Coordinated {
+		candidate, err := newLeaseCandidate(kubeClient, namespace, id, config)
+		if err != nil {
+			return err
+		}
+		go candidate.Run(ctx)
+	}
+
+	go func() {
+		<-ctx.Done()
+		if le.IsLeader() {
+			klog.Infof("Waiting for the controllers to stop before releasing the lease")
+			<-stopped
+		}
+		klog.Infof("Releasing the lease")
+		cancelElection()
+	}()
+
+	watchDog.SetLeaderElection(le)
+	registry.AddHealthzChecks(watchDog)
+	le.Run(electionCtx)
+	// Wait for the controllers to stop when the lease was lost.
+	if leading.Load() {
+		<-stopped
+	}
+	return nil
+}
+
+// newLeaseCandidate returns the LeaseCandidate of the replica for coordinated
+// leader election. The OldestEmulationVersion strategy keeps the leader on the
+// oldest emulation version and, among those, prefers the newest binary version,
+// so that a rolling upgrade hands the leadership over to the upgraded replicas.
+func newLeaseCandidate(kubeClient kubernetes.Interface, namespace, id string, config Config) (*leaderelection.LeaseCandidate, error) {
+	if config.ResourceLock != resourcelock.LeasesResourceLock {
+		return nil, fmt.Errorf("coordinated leader election requires the %q resource lock, got %q", resourcelock.LeasesResourceLock, config.ResourceLock)
+	}
+	binaryVersion, err := version.ParseSemantic(config.BinaryVersion)
+	if err != nil {
+		return nil, fmt.Errorf("coordinated leader election requires a semantic binary version: %w", err)
+	}
+	emulationVersion := binaryVersion
+	if config.EmulationVersion != "" {
+		emulationVersion, err = version.ParseSemantic(config.EmulationVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid leader election emulation version: %w", err)
+		}
+	}
+	if binaryVersion.LessThan(emulationVersion) {
+		return nil, fmt.Errorf("leader election emulation version %s must not be newer than the binary version %s", emulationVersion, binaryVersion)
+	}
+
+	candidate, _, err := leaderelection.NewCandidate(
+		kubeClient,
+		namespace,
+		fmt.Sprintf("%s-%s", config.ResourceName, id),
+		config.ResourceName,
+		binaryVersion.String(),
+		emulationVersion.String(),
+		coordinationv1.OldestEmulationVersion,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lease candidate: %w", err)
+	}
+	return candidate, nil
 }
 
-func lockID(leaderElectionID string) string {
+func lockID(leaderElectionID string) (string, error) {
 	if len(leaderElectionID) > 0 {
-		return leaderElectionID
+		return leaderElectionID, nil
 	}
 
 	id := os.Getenv("POD_NAME")
 	hostname, err := nodeutil.GetHostname(id)
 	if err != nil {
-		klog.Fatalf("failed to get leader election id: %s", err)
+		return "", fmt.Errorf("failed to get leader election id: %w", err)
 	}
-	id = hostname
 
-	return id
+	return hostname, nil
 }
 
-func lockNamespace(leaderElectionNamespace string) string {
+func lockNamespace(leaderElectionNamespace string) (string, error) {
 	if len(leaderElectionNamespace) > 0 {
-		return leaderElectionNamespace
+		return leaderElectionNamespace, nil
 	}
 	ns := os.Getenv("POD_NAMESPACE")
 	if ns == "" {
-		klog.Fatalf("leader election namespace should be provided")
+		return "", errors.New("leader election namespace should be provided")
 	}
 
-	return ns
+	return ns, nil
 }
@@ -0,0 +1,159 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
+)
+
+type fakeCheckRegistry struct {
+	healthz []server.HealthChecker
+}
+
+func (r *fakeCheckRegistry) AddHealthzChecks(checks ...server.HealthChecker) {
+	r.healthz = append(r.healthz, checks...)
+}
+
+func (r *fakeCheckRegistry) AddReadyzChecks(...server.HealthChecker) {}
+
+func TestStartLeaderElectionConfigErrors(t *testing.T) {
+	valid := Config{
+		LeaderElectionID:        "replica-a",
+		LeaderElectionNamespace: "kube-system",
+		LeaseDuration:           15 * time.Second,
+		RenewDeadline:           10 * time.Second,
+		RetryPeriod:             2 * time.Second,
+		ResourceLock:            "leases",
+		ResourceName:            "node-ipam-controller",
+		BinaryVersion:           "v0.3.1",
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{
+			name:   "no namespace",
+			modify: func(c *Config) { c.LeaderElectionNamespace = "" },
+		},
+		{
+			name:   "unknown resource lock",
+			modify: func(c *Config) { c.ResourceLock = "secrets" },
+		},
+		{
+			name:   "renew deadline above lease duration",
+			modify: func(c *Config) { c.RenewDeadline = time.Minute },
+		},
+		{
+			name: "coordinated without semantic version",
+			modify: func(c *Config) {
+				c.Coordinated = true
+				c.BinaryVersion = "abc123-dirty"
+			},
+		},
+		{
+			name: "coordinated with newer emulation version",
+			modify: func(c *Config) {
+				c.Coordinated = true
+				c.EmulationVersion = "0.4.0"
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "")
+			config := valid
+			tc.modify(&config)
+			registry := &fakeCheckRegistry{}
+			err := StartLeaderElection(context.Background(), fake.NewClientset(), config, registry, func() {}, func(context.Context) {
+				t.Error("must not start leading")
+			})
+			assert.Error(t, err)
+			assert.Empty(t, registry.healthz)
+		})
+	}
+}
+
+func TestNewLeaseCandidate(t *testing.T) {
+	config := Config{ResourceLock: "leases", ResourceName: "node-ipam-controller", BinaryVersion: "v0.3.1-2-gabcdef", EmulationVersion: "0.3.0"}
+	candidate, err := newLeaseCandidate(fake.NewClientset(), "kube-system", "replica-a", config)
+	require.NoError(t, err)
+	assert.NotNil(t, candidate)
+
+	config.ResourceLock = "configmaps"
+	_, err = newLeaseCandidate(fake.NewClientset(), "kube-system", "replica-a", config)
+	assert.Error(t, err)
+}
+
+func TestObserveLeader(t *testing.T) {
+	observeLeader("test-lease", "replica-a")
+	observeLeader("test-lease", "replica-b")
+
+	assert.InDelta(t, 2, testutil.ToFloat64(leaderTransitions.WithLabelValues("test-lease")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(currentLeader.WithLabelValues("test-lease", "replica-b")), 0)
+	// Only the current leader is reported.
+	assert.Equal(t, 1, testutil.CollectAndCount(currentLeader))
+}
+
+func TestStartLeaderElectionReleasesLeaseAfterRunFunc(t *testing.T) {
+	config := Config{
+		LeaderElectionID:        "replica-a",
+		LeaderElectionNamespace: "kube-system",
+		LeaseDuration:           15 * time.Second,
+		RenewDeadline:           10 * time.Second,
+		RetryPeriod:             2 * time.Second,
+		ResourceLock:            "leases",
+		ResourceName:            "node-ipam-controller",
+	}
+	client := fake.NewClientset()
+	holder := func() string {
+		lease, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), "node-ipam-controller", metav1.GetOptions{})
+		require.NoError(t, err)
+		return ptr.Deref(lease.Spec.HolderIdentity, "")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	var holderWhileDraining string
+	done := make(chan error)
+	go func() {
+		done <- StartLeaderElection(ctx, client, config, &fakeCheckRegistry{}, cancel, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			// The lease is still held while draining.
+			time.Sleep(100 * time.Millisecond)
+			holderWhileDraining = holder()
+		})
+	}()
+
+	<-started
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, "replica-a", holderWhileDraining)
+	assert.Empty(t, holder())
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+const leaderElectionSubsystem = "leader_election"
+
+// Leader election metrics, labeled with the name of the lease. masterStatus
+// and slowpathTotal match the ones of k8s.io/component-base/metrics/prometheus/clientgo/leaderelection.
+var (
+	masterStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: leaderElectionSubsystem,
+			Name:      "master_status",
+			Help:      "Gauge of if the reporting system is master of the relevant lease, 0 indicates backup, 1 indicates master. 'name' is the string used to identify the lease.",
+		},
+		[]string{"name"},
+	)
+	slowpathTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: leaderElectionSubsystem,
+			Name:      "slowpath_total",
+			Help:      "Total number of slow path exercised in renewing leader leases. 'name' is the string used to identify the lease.",
+		},
+		[]string{"name"},
+	)
+	leaderTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: leaderElectionSubsystem,
+			Name:      "leader_transitions_total",
+			Help:      "Counter of the leader changes observed by the replica, including the first leader it observes.",
+		},
+		[]string{"name"},
+	)
+	currentLeader = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: leaderElectionSubsystem,
+			Name:      "leader",
+			Help:      "Gauge set to 1 for the identity of the leader of the lease last observed by the replica.",
+		},
+		[]string{"name", "identity"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(masterStatus)
+	prometheus.MustRegister(slowpathTotal)
+	prometheus.MustRegister(leaderTransitions)
+	prometheus.MustRegister(currentLeader)
+	leaderelection.SetProvider(leaderMetricsProvider{})
+}
+
+// observeLeader records a new leader of the lease.
+func observeLeader(name, identity string) {
+	leaderTransitions.WithLabelValues(name).Inc()
+	currentLeader.DeletePartialMatch(prometheus.Labels{"name": name})
+	currentLeader.WithLabelValues(name, identity).Set(1)
+}
+
+// leaderMetricsProvider exports the metrics of the client-go leader electors
+// through the default prometheus registry.
+type leaderMetricsProvider struct{}
+
+func (leaderMetricsProvider) NewLeaderMetric() leaderelection.LeaderMetric {
+	return leaderMetric{}
+}
+
+type leaderMetric struct{}
+
+func (leaderMetric) On(name string) {
+	masterStatus.WithLabelValues(name).Set(1)
+}
+
+func (leaderMetric) Off(name string) {
+	masterStatus.WithLabelValues(name).Set(0)
+}
+
+func (leaderMetric) SlowpathExercised(name string) {
+	slowpathTotal.WithLabelValues(name).Inc()
+}
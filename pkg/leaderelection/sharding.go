@@ -0,0 +1,323 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/node-ipam-controller/pkg/util/server"
+)
+
+// ShardMemberLabelKey labels the membership leases of the replicas sharing
+// the shards, its value is the ResourceName.
+const ShardMemberLabelKey = "networking.x-k8s.io/node-ipam-shard-member"
+
+// ShardHandler is notified of the shards the replica acquires and releases.
+type ShardHandler interface {
+	// AcquireShard is called once the replica holds the lease of the shard.
+	AcquireShard(ctx context.Context, shard int)
+	// ReleaseShard is called before the lease of the shard is released, or
+	// once it could not be renewed. It must stop using the shard on return.
+	ReleaseShard(ctx context.Context, shard int)
+}
+
+// shardElector runs the leader election of one shard.
+type shardElector struct {
+	cancel context.CancelFunc
+	// done is closed once the lease of the shard is released.
+	done chan struct{}
+}
+
+// shardManager spreads the shards across the live replicas. Every replica
+// renews a membership lease, the owner of a shard is picked among the live
+// members by rendezvous hashing and holds the lease of the shard, so a
+// replica joining or leaving only moves the shards it gains or loses.
+type shardManager struct {
+	client    kubernetes.Interface
+	config    Config
+	id        string
+	namespace string
+	handler   ShardHandler
+	// electors holds the leader elections of the shards the replica is the
+	// owner of.
+	electors map[int]*shardElector
+	// lastRenewal is the time of the last successful membership renewal.
+	lastRenewal atomic.Pointer[time.Time]
+}
+
+// RunShards takes part in the sharded leader election until ctx is cancelled:
+// the config.Shards shards are handed out to the live replicas, each with its
+// own lease, and the handler is notified of the shards the replica holds. A
+// liveness check that fails when the membership can not be renewed is added to
+// registry.
+func RunShards(
+	ctx context.Context, kubeClient kubernetes.Interface, config Config, registry server.CheckRegistry, handler ShardHandler,
+) error {
+	if config.ResourceLock != resourcelock.LeasesResourceLock {
+		return fmt.Errorf("sharding requires the %q resource lock, got %q", resourcelock.LeasesResourceLock, config.ResourceLock)
+	}
+	if config.Coordinated {
+		return errors.New("sharding does not support coordinated leader election")
+	}
+	id, err := lockID(config.LeaderElectionID)
+	if err != nil {
+		return err
+	}
+	namespace, err := lockNamespace(config.LeaderElectionNamespace)
+	if err != nil {
+		return err
+	}
+
+	m := &shardManager{
+		client:    kubeClient,
+		config:    config,
+		id:        id,
+		namespace: namespace,
+		handler:   handler,
+		electors:  make(map[int]*shardElector),
+	}
+	klog.Infof("sharded leader election id: %s, namespace: %s, shards: %d", m.id, m.namespace, config.Shards)
+	registry.AddHealthzChecks(server.NamedCheck("shard-membership", m.check))
+
+	wait.UntilWithContext(ctx, m.rebalance, config.RetryPeriod)
+	m.leave()
+	return nil
+}
+
+// check fails when the membership lease was not renewed for longer than its
+// duration.
+func (m *shardManager) check(_ *http.Request) error {
+	lastRenewal := m.lastRenewal.Load()
+	if lastRenewal == nil {
+		return nil
+	}
+	if since := time.Since(*lastRenewal); since > m.config.LeaseDuration+leaseRenewalTolerance {
+		return fmt.Errorf("shard membership not renewed for %v", since)
+	}
+	return nil
+}
+
+// rebalance renews the membership of the replica and starts or stops the
+// leader elections of the shards it gains or loses.
+func (m *shardManager) rebalance(ctx context.Context) {
+	if err := m.renewMembership(ctx); err != nil {
+		klog.Errorf("failed to renew shard membership: %v", err)
+		return
+	}
+	members, err := m.liveMembers(ctx)
+	if err != nil {
+		klog.Errorf("failed to list shard members: %v", err)
+		return
+	}
+
+	for shard := 0; shard < m.config.Shards; shard++ {
+		elector, running := m.electors[shard]
+		if running {
+			select {
+			case <-elector.done:
+				// The lease could not be renewed, elect again.
+				delete(m.electors, shard)
+				running = false
+			default:
+			}
+		}
+
+		owner := shardOwner(members, shard)
+		switch {
+		case owner == m.id && !running:
+			klog.Infof("taking over shard %d", shard)
+			m.startElector(ctx, shard)
+		case owner != m.id && running:
+			klog.Infof("handing off shard %d to %s", shard, owner)
+			m.stopElector(ctx, shard)
+		}
+	}
+}
+
+// startElector starts the leader election of the shard.
+func (m *shardManager) startElector(ctx context.Context, shard int) {
+	name := shardLeaseName(m.config.ResourceName, shard)
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: m.namespace, Name: name},
+			Client:     m.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: m.id},
+		},
+		LeaseDuration:   m.config.LeaseDuration,
+		RenewDeadline:   m.config.RenewDeadline,
+		RetryPeriod:     m.config.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				m.handler.AcquireShard(ctx, shard)
+				<-ctx.Done()
+				m.handler.ReleaseShard(ctx, shard)
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("%s stopped leading shard %d", m.id, shard)
+			},
+			OnNewLeader: func(identity string) {
+				observeLeader(name, identity)
+			},
+		},
+	})
+	if err != nil {
+		klog.Errorf("failed to create leader elector of shard %d: %v", shard, err)
+		return
+	}
+
+	// The elector is only cancelled by stopElector, once the shard is
+	// released, so that the lease outlives ctx until the allocation in
+	// progress completed.
+	electorCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	elector := &shardElector{cancel: cancel, done: make(chan struct{})}
+	m.electors[shard] = elector
+	go func() {
+		defer close(elector.done)
+		le.Run(electorCtx)
+	}()
+}
+
+// stopElector stops using the shard and releases its lease, so that its new
+// owner can take it over without waiting for the lease to expire.
+func (m *shardManager) stopElector(ctx context.Context, shard int) {
+	elector := m.electors[shard]
+	delete(m.electors, shard)
+	m.handler.ReleaseShard(ctx, shard)
+	elector.cancel()
+	<-elector.done
+}
+
+// leave releases the leases of the shards and the membership of the replica.
+func (m *shardManager) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.RenewDeadline)
+	defer cancel()
+
+	for shard := range m.electors {
+		m.stopElector(ctx, shard)
+	}
+	err := m.client.CoordinationV1().Leases(m.namespace).Delete(ctx, memberLeaseName(m.config.ResourceName, m.id), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("failed to delete shard membership lease: %v", err)
+	}
+}
+
+// renewMembership creates or renews the membership lease of the replica.
+func (m *shardManager) renewMembership(ctx context.Context) error {
+	leases := m.client.CoordinationV1().Leases(m.namespace)
+	name := memberLeaseName(m.config.ResourceName, m.id)
+	now := metav1.NewMicroTime(time.Now())
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &m.id,
+		LeaseDurationSeconds: ptr.To(int32(m.config.LeaseDuration / time.Second)),
+		RenewTime:            &now,
+	}
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{ShardMemberLabelKey: m.config.ResourceName},
+			},
+			Spec: spec,
+		}, metav1.CreateOptions{})
+	case err == nil:
+		lease.Spec = spec
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	m.lastRenewal.Store(ptr.To(now.Time))
+	return nil
+}
+
+// liveMembers returns the identities of the replicas whose membership lease
+// has not expired, sorted.
+func (m *shardManager) liveMembers(ctx context.Context) ([]string, error) {
+	selector := labels.SelectorFromSet(labels.Set{ShardMemberLabelKey: m.config.ResourceName})
+	leases, err := m.client.CoordinationV1().Leases(m.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	members := []string{m.id}
+	now := time.Now()
+	for _, lease := range leases.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		if spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second).Before(now) {
+			continue
+		}
+		if !slices.Contains(members, *spec.HolderIdentity) {
+			members = append(members, *spec.HolderIdentity)
+		}
+	}
+	slices.Sort(members)
+	return members, nil
+}
+
+// shardOwner returns the member owning the shard by rendezvous hashing: the
+// member with the highest hash for the shard wins, so that the shards of a
+// member leaving are spread over the others and a member joining only takes
+// shards over.
+func shardOwner(members []string, shard int) string {
+	var owner string
+	var ownerHash uint64
+	for _, member := range members {
+		sum := sha256.Sum256([]byte(member + "/" + strconv.Itoa(shard)))
+		if sum := binary.BigEndian.Uint64(sum[:8]); owner == "" || sum > ownerHash || (sum == ownerHash && member < owner) {
+			owner, ownerHash = member, sum
+		}
+	}
+	return owner
+}
+
+// shardLeaseName returns the name of the lease of the shard.
+func shardLeaseName(resourceName string, shard int) string {
+	return fmt.Sprintf("%s-shard-%d", resourceName, shard)
+}
+
+// memberLeaseName returns the name of the membership lease of the replica.
+func memberLeaseName(resourceName, id string) string {
+	return fmt.Sprintf("%s-member-%s", resourceName, id)
+}
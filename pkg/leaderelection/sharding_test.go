@@ -0,0 +1,85 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func TestShardOwner(t *testing.T) {
+	const shards = 64
+	members := []string{"a", "b", "c", "d"}
+
+	owners := make(map[int]string, shards)
+	counts := make(map[string]int)
+	for shard := 0; shard < shards; shard++ {
+		owners[shard] = shardOwner(members, shard)
+		counts[owners[shard]]++
+	}
+	for _, member := range members {
+		assert.Positive(t, counts[member], member)
+	}
+
+	// Only the shards of the leaving member move.
+	for shard := 0; shard < shards; shard++ {
+		owner := shardOwner([]string{"a", "b", "c"}, shard)
+		if owners[shard] != "d" {
+			assert.Equal(t, owners[shard], owner, "shard %d", shard)
+		} else {
+			assert.NotEqual(t, "d", owner)
+		}
+	}
+}
+
+func TestLiveMembers(t *testing.T) {
+	ctx := context.Background()
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      memberLeaseName("node-ipam-controller", "gone"),
+			Namespace: "kube-system",
+			Labels:    map[string]string{ShardMemberLabelKey: "node-ipam-controller"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("gone"),
+			LeaseDurationSeconds: ptr.To[int32](15),
+			RenewTime:            &expired,
+		},
+	})
+
+	config := Config{LeaseDuration: 15 * time.Second, ResourceName: "node-ipam-controller"}
+	a := &shardManager{client: client, config: config, id: "a", namespace: "kube-system"}
+	b := &shardManager{client: client, config: config, id: "b", namespace: "kube-system"}
+	require.NoError(t, a.renewMembership(ctx))
+	require.NoError(t, b.renewMembership(ctx))
+	// Renewing updates the existing lease.
+	require.NoError(t, a.renewMembership(ctx))
+
+	members, err := a.liveMembers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	assert.NoError(t, a.check(nil))
+}
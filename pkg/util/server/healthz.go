@@ -0,0 +1,187 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// The health checks are modeled on k8s.io/apiserver/pkg/server/healthz, which
+// can not be used directly without pulling in the whole apiserver.
+
+// HealthChecker is a named health check.
+type HealthChecker interface {
+	Name() string
+	Check(req *http.Request) error
+}
+
+// CheckRegistry is implemented by servers that accept health checks. Checks
+// can be registered at any time, also after the server started.
+type CheckRegistry interface {
+	// AddHealthzChecks adds liveness checks served at `/healthz`.
+	AddHealthzChecks(checks ...HealthChecker)
+	// AddReadyzChecks adds readiness checks served at `/readyz`.
+	AddReadyzChecks(checks ...HealthChecker)
+}
+
+// PingHealthz returns true automatically when checked.
+var PingHealthz HealthChecker = ping{}
+
+// ping implements the simplest possible health checker.
+type ping struct{}
+
+func (ping) Name() string {
+	return "ping"
+}
+
+// Check is a health check that returns true.
+func (ping) Check(_ *http.Request) error {
+	return nil
+}
+
+// NamedCheck returns a health checker for the given name and function.
+func NamedCheck(name string, check func(r *http.Request) error) HealthChecker {
+	return &healthzCheck{name, check}
+}
+
+// healthzCheck implements HealthChecker on an arbitrary name and check function.
+type healthzCheck struct {
+	name  string
+	check func(r *http.Request) error
+}
+
+func (c *healthzCheck) Name() string {
+	return c.name
+}
+
+func (c *healthzCheck) Check(r *http.Request) error {
+	return c.check(r)
+}
+
+// checkGroup is a named group of health checks, e.g. the readyz checks.
+type checkGroup struct {
+	name string
+	// lock guards checks.
+	lock   sync.RWMutex
+	checks []HealthChecker
+}
+
+func (g *checkGroup) add(checks ...HealthChecker) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.checks = append(g.checks, checks...)
+}
+
+func (g *checkGroup) list() []HealthChecker {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.checks
+}
+
+// install registers the handler for the group at /<name> and the handlers for
+// the individual checks at /<name>/<check>.
+func (g *checkGroup) install(mux *http.ServeMux) {
+	mux.Handle("/"+g.name, g.handleRootHealth())
+	mux.Handle("/"+g.name+"/{check}", g.handleSingleCheck())
+}
+
+// handleRootHealth returns a handler that runs all the checks of the group.
+// The output is only detailed if the check fails or `verbose` is set. Checks
+// can be skipped with the `exclude` query parameter.
+func (g *checkGroup) handleRootHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		excluded := sets.New[string]()
+		for _, e := range r.URL.Query()["exclude"] {
+			excluded.Insert(strings.TrimSpace(e))
+		}
+
+		failed := false
+		var individualCheckOutput bytes.Buffer
+		for _, check := range g.list() {
+			if excluded.Has(check.Name()) {
+				excluded.Delete(check.Name())
+				fmt.Fprintf(&individualCheckOutput, "[+]%s excluded: ok\n", check.Name())
+				continue
+			}
+			if err := check.Check(r); err != nil {
+				klog.V(4).Infof("%s check %q failed: %v", g.name, check.Name(), err)
+				fmt.Fprintf(&individualCheckOutput, "[-]%s failed: %v\n", check.Name(), err)
+				failed = true
+			} else {
+				fmt.Fprintf(&individualCheckOutput, "[+]%s ok\n", check.Name())
+			}
+		}
+		if excluded.Len() > 0 {
+			fmt.Fprintf(&individualCheckOutput, "warn: some %s checks cannot be excluded: no matches for %s\n",
+				g.name, formatQuoted(sets.List(excluded)...))
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "%s%s check failed\n", individualCheckOutput.String(), g.name) //nolint: errcheck
+			return
+		}
+
+		if _, found := r.URL.Query()["verbose"]; !found {
+			fmt.Fprint(w, "ok") //nolint: errcheck
+			return
+		}
+
+		fmt.Fprintf(w, "%s%s check passed\n", individualCheckOutput.String(), g.name) //nolint: errcheck
+	}
+}
+
+// handleSingleCheck returns a handler that runs the check named by the path.
+func (g *checkGroup) handleSingleCheck() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("check")
+		for _, check := range g.list() {
+			if check.Name() != name {
+				continue
+			}
+			if err := check.Check(r); err != nil {
+				http.Error(w, fmt.Sprintf("internal server error: %v", err), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, "ok") //nolint: errcheck
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// formatQuoted returns a formatted string of the health check names,
+// preserving the order passed in.
+func formatQuoted(names ...string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("%q", name))
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCheckGroup(checks ...HealthChecker) *http.ServeMux {
+	group := &checkGroup{name: "readyz"}
+	group.add(checks...)
+	mux := http.NewServeMux()
+	group.install(mux)
+	return mux
+}
+
+func serve(mux *http.ServeMux, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestRootHealth(t *testing.T) {
+	failing := NamedCheck("bootstrap", func(_ *http.Request) error {
+		return errors.New("not bootstrapped")
+	})
+
+	testCases := []struct {
+		name     string
+		checks   []HealthChecker
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "no checks",
+			path:     "/readyz",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "passing",
+			checks:   []HealthChecker{PingHealthz},
+			path:     "/readyz",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "passing verbose",
+			checks:   []HealthChecker{PingHealthz},
+			path:     "/readyz?verbose",
+			wantCode: http.StatusOK,
+			wantBody: "[+]ping ok\nreadyz check passed\n",
+		},
+		{
+			name:     "failing",
+			checks:   []HealthChecker{PingHealthz, failing},
+			path:     "/readyz",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "[+]ping ok\n[-]bootstrap failed: not bootstrapped\nreadyz check failed\n",
+		},
+		{
+			name:     "failing excluded",
+			checks:   []HealthChecker{PingHealthz, failing},
+			path:     "/readyz?exclude=bootstrap&verbose",
+			wantCode: http.StatusOK,
+			wantBody: "[+]ping ok\n[+]bootstrap excluded: ok\nreadyz check passed\n",
+		},
+		{
+			name:     "unknown excluded",
+			checks:   []HealthChecker{PingHealthz},
+			path:     "/readyz?exclude=missing&exclude=ping&verbose",
+			wantCode: http.StatusOK,
+			wantBody: "[+]ping excluded: ok\nwarn: some readyz checks cannot be excluded: no matches for \"missing\"\nreadyz check passed\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(newTestCheckGroup(tc.checks...), tc.path)
+			assert.Equal(t, tc.wantCode, rec.Code)
+			assert.Equal(t, tc.wantBody, rec.Body.String())
+			assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestSingleCheck(t *testing.T) {
+	mux := newTestCheckGroup(PingHealthz, NamedCheck("bootstrap", func(_ *http.Request) error {
+		return errors.New("not bootstrapped")
+	}))
+
+	rec := serve(mux, "/readyz/ping")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+
+	rec = serve(mux, "/readyz/bootstrap")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "internal server error: not bootstrapped\n", rec.Body.String())
+
+	rec = serve(mux, "/readyz/missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestChecksAddedAfterInstall(t *testing.T) {
+	group := &checkGroup{name: "healthz"}
+	mux := http.NewServeMux()
+	group.install(mux)
+
+	assert.Equal(t, http.StatusNotFound, serve(mux, "/healthz/ping").Code)
+	group.add(PingHealthz)
+	assert.Equal(t, http.StatusOK, serve(mux, "/healthz/ping").Code)
+	assert.Equal(t, "[+]ping ok\nhealthz check passed\n", serve(mux, "/healthz?verbose").Body.String())
+}
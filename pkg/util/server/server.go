@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -15,18 +16,55 @@ import (
 
 const defaultTimeout = 5 * time.Second
 
+// profilingWriteTimeout is the write timeout used when profiling is enabled,
+// it leaves room for the default 30 seconds CPU profile.
+const profilingWriteTimeout = 60 * time.Second
+
+// WebServer combines the probes and metrics servers.
+type WebServer struct {
+	mux     *http.ServeMux
+	healthz *checkGroup
+	readyz  *checkGroup
+}
+
+var _ CheckRegistry = &WebServer{}
+
+// HandlerRegistry is implemented by servers that accept additional handlers,
+// e.g. for debug endpoints. It is satisfied by *http.ServeMux.
+type HandlerRegistry interface {
+	Handle(pattern string, handler http.Handler)
+}
+
 // StartWebServer starts a new web server that combines probes and metrics servers and has
-// `/readyz`, `/healthz` endpoints that always respond 200 OK and `/metrics` endpoint.
-func StartWebServer(ctx context.Context, addr string) {
+// `/readyz`, `/healthz` and `/metrics` endpoints. `/healthz` and `/readyz` respond 200 OK
+// only when all the checks added with AddHealthzChecks and AddReadyzChecks respectively pass.
+// Every check is also served on its own at `/healthz/<name>` and `/readyz/<name>`.
+// If enableProfiling is set, the `net/http/pprof` handlers are served at `/debug/pprof/`.
+func StartWebServer(ctx context.Context, addr string, enableProfiling bool) *WebServer {
 	mux := http.NewServeMux()
-	mux.Handle("/readyz", makeHealthHandler())
-	mux.Handle("/healthz", makeHealthHandler())
+	s := &WebServer{
+		mux:     mux,
+		healthz: &checkGroup{name: "healthz", checks: []HealthChecker{PingHealthz}},
+		readyz:  &checkGroup{name: "readyz", checks: []HealthChecker{PingHealthz}},
+	}
+
+	s.readyz.install(mux)
+	s.healthz.install(mux)
 	mux.Handle("/metrics", promhttp.Handler())
+	writeTimeout := defaultTimeout
+	if enableProfiling {
+		writeTimeout = profilingWriteTimeout
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
 	server := &http.Server{
 		Addr:         addr,
 		Handler:      mux,
 		ReadTimeout:  defaultTimeout,
-		WriteTimeout: defaultTimeout,
+		WriteTimeout: writeTimeout,
 		IdleTimeout:  defaultTimeout,
 	}
 
@@ -49,13 +87,21 @@ func StartWebServer(ctx context.Context, addr string) {
 			klog.Errorf("Error stopping health server: %v", err)
 		}
 	}()
+
+	return s
 }
 
-// makeHealthHandler returns 200/OK when healthy.
-func makeHealthHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close() //nolint: errcheck
+// Handle registers an additional handler for the given pattern.
+func (s *WebServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
 
-		w.WriteHeader(http.StatusOK)
-	}
+// AddHealthzChecks adds liveness checks to the `/healthz` endpoint.
+func (s *WebServer) AddHealthzChecks(checks ...HealthChecker) {
+	s.healthz.add(checks...)
+}
+
+// AddReadyzChecks adds readiness checks to the `/readyz` endpoint.
+func (s *WebServer) AddReadyzChecks(checks ...HealthChecker) {
+	s.readyz.add(checks...)
 }